@@ -0,0 +1,107 @@
+// Команда import-sqlite переносит содержимое JSON-хранилища (storage/jsons)
+// во встроенную базу SQLite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+	"myapp/internal/storage/sqlstore"
+)
+
+func main() {
+	from := flag.String("from", "storage/jsons", "directory with the JSON stores")
+	to := flag.String("to", "storage/app.db", "path to the SQLite database")
+	force := flag.Bool("force", false, "overwrite a database that already has users")
+	flag.Parse()
+
+	// Сервер не должен менять JSON-файлы, пока они читаются
+	lock, err := storage.LockDir(*from)
+	if err != nil {
+		log.Fatalf("failed to lock %s: %v", *from, err)
+	}
+	defer lock.Unlock()
+
+	src, err := storage.NewJSONBackend(*from)
+	if err != nil {
+		log.Fatalf("open JSON stores: %v", err)
+	}
+	defer src.Close()
+
+	if err := checkExisting(*to, *force); err != nil {
+		log.Fatal(err)
+	}
+
+	// Импорт идёт во временную базу рядом и заменяет *to только целиком:
+	// прерванный импорт не оставляет полузаполненную базу, которую откроет сервер
+	tmp := *to + ".import"
+	removeDB(tmp)
+	dst, err := sqlstore.Open(tmp)
+	if err != nil {
+		log.Fatalf("open database: %v", err)
+	}
+	err = storage.Copy(dst, src)
+	if err == nil {
+		err = storage.AppendAuditLog(dst, src)
+	}
+	// Перечитываем пользователей из новой базы: так до замены видно, что она читается
+	var users []models.User
+	if err == nil {
+		users, err = dst.Users().GetAllUsers()
+	}
+	if err != nil {
+		dst.Close()
+		removeDB(tmp)
+		log.Fatalf("import failed, %s is unchanged: %v", *to, err)
+	}
+	if err := dst.Close(); err != nil {
+		removeDB(tmp)
+		log.Fatalf("close database: %v", err)
+	}
+
+	// Журнал старой базы применился бы к новой, поэтому удаляется до замены
+	removeFiles(*to+"-wal", *to+"-shm")
+	if err := os.Rename(tmp, *to); err != nil {
+		log.Fatalf("replace database: %v", err)
+	}
+	log.Printf("imported %d users from %s into %s", len(users), *from, *to)
+}
+
+// checkExisting не даёт без -force заменить базу, в которой уже есть пользователи
+func checkExisting(path string, force bool) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) || force {
+		return nil
+	}
+
+	db, err := sqlstore.Open(path)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer db.Close()
+
+	existing, err := db.Users().GetAllUsers()
+	if err != nil {
+		return fmt.Errorf("read database: %w", err)
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("database %s already has %d users, use -force to overwrite", path, len(existing))
+	}
+	return nil
+}
+
+// removeDB удаляет файл базы SQLite вместе с файлами журнала WAL
+func removeDB(path string) {
+	removeFiles(path, path+"-wal", path+"-shm")
+}
+
+func removeFiles(names ...string) {
+	for _, name := range names {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("remove %s: %v", name, err)
+		}
+	}
+}
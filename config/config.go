@@ -1 +1,522 @@
 package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJWTSecret - секрет для локальной разработки; вне режима dev запрещён
+const DefaultJWTSecret = "we-will-rock-you"
+
+// exampleSecrets - заглушки из прежних версий config.example.yaml. Они
+// опубликованы вместе с кодом, поэтому вне режима dev запрещены, как и
+// DefaultJWTSecret, хотя и длиннее 32 символов.
+var exampleSecrets = []string{
+	"change-me-to-a-random-string-of-32-plus-chars",
+	"another-random-string-of-32-plus-chars",
+}
+
+// publishedSecret сообщает, что секрет известен всем: это значение по
+// умолчанию или заглушка из примера настроек
+func publishedSecret(secret string) bool {
+	return secret == DefaultJWTSecret || slices.Contains(exampleSecrets, secret)
+}
+
+// Режимы работы сервера
+const (
+	ModeDev  = "dev"
+	ModeProd = "prod"
+)
+
+// Config - настройки сервера. Источники применяются по возрастанию
+// приоритета: значения по умолчанию, YAML-файл, переменные окружения APP_*,
+// флаги командной строки.
+type Config struct {
+	Mode   string `yaml:"mode"`
+	Listen string `yaml:"listen"`
+
+	Auth    AuthConfig    `yaml:"auth"`
+	CORS    CORSConfig    `yaml:"cors"`
+	Storage StorageConfig `yaml:"storage"`
+	Backup  BackupConfig  `yaml:"backup"`
+}
+
+// AuthConfig - настройки токенов
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwtSecret"`
+	AccessTokenTTL  time.Duration `yaml:"accessTokenTTL"`
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTTL"`
+
+	// Защита входа от перебора
+	MaxLoginFailures   int           `yaml:"maxLoginFailures"`   // неудач подряд до блокировки логина
+	MaxIPLoginFailures int           `yaml:"maxIPLoginFailures"` // неудач с одного адреса до задержек для него
+	LoginDelay         time.Duration `yaml:"loginDelay"`         // задержка после первой неудачи, дальше удваивается
+	LoginLockout       time.Duration `yaml:"loginLockout"`       // срок блокировки логина
+
+	PasswordResetTTL time.Duration `yaml:"passwordResetTTL"` // срок действия кода сброса пароля
+	TOTPIssuer       string        `yaml:"totpIssuer"`       // название сервиса в приложении-аутентификаторе
+
+	// Подпись токенов доступа
+	Issuer     string      `yaml:"issuer"`     // claim iss
+	Audience   string      `yaml:"audience"`   // claim aud
+	SigningKey string      `yaml:"signingKey"` // id ключа, которым подписываются новые токены
+	Keys       []KeyConfig `yaml:"keys"`       // пусто - один ключ HS256 "default" из jwtSecret
+
+	// Подпись ссылок на PDF уроков, независимая от ключей токенов
+	FileLinkKey  string          `yaml:"fileLinkKey"`  // id ключа, которым подписываются новые ссылки
+	FileLinkKeys []LinkKeyConfig `yaml:"fileLinkKeys"` // пусто - один ключ "default" из jwtSecret
+}
+
+// KeyConfig - ключ подписи токенов. Ключ, которым больше не подписывают,
+// оставляют в списке (для RS256 и EdDSA достаточно publicKeyFile), пока не
+// истекут выданные им токены.
+type KeyConfig struct {
+	ID             string `yaml:"id"`             // kid в заголовке токена
+	Alg            string `yaml:"alg"`            // HS256, RS256 или EdDSA
+	Secret         string `yaml:"secret"`         // HS256
+	PrivateKeyFile string `yaml:"privateKeyFile"` // RS256, EdDSA: PEM закрытого ключа
+	PublicKeyFile  string `yaml:"publicKeyFile"`  // RS256, EdDSA: PEM открытого ключа, только проверка
+}
+
+// LinkKeyConfig - секрет подписи ссылок на PDF уроков. Прежний ключ
+// оставляют в списке на срок storage.fileLinkTTL, чтобы выданные ссылки
+// продолжали открываться.
+type LinkKeyConfig struct {
+	ID     string `yaml:"id"`     // kid в подписи ссылки
+	Secret string `yaml:"secret"` // не короче 32 символов вне режима dev
+}
+
+// DefaultKeyID - id ключа из jwtSecret, когда auth.keys или auth.fileLinkKeys не заданы
+const DefaultKeyID = "default"
+
+// TokenKeys возвращает ключи подписи токенов и id подписывающего ключа
+func (a AuthConfig) TokenKeys() (signingID string, keys []KeyConfig) {
+	keys = a.Keys
+	if len(keys) == 0 {
+		keys = []KeyConfig{{ID: DefaultKeyID, Alg: "HS256", Secret: a.JWTSecret}}
+	}
+	signingID = a.SigningKey
+	if signingID == "" {
+		signingID = keys[0].ID
+	}
+	return signingID, keys
+}
+
+// LinkKeys возвращает ключи подписи ссылок на файлы и id подписывающего ключа
+func (a AuthConfig) LinkKeys() (signingID string, keys []LinkKeyConfig) {
+	keys = a.FileLinkKeys
+	if len(keys) == 0 {
+		keys = []LinkKeyConfig{{ID: DefaultKeyID, Secret: a.JWTSecret}}
+	}
+	signingID = a.FileLinkKey
+	if signingID == "" {
+		signingID = keys[0].ID
+	}
+	return signingID, keys
+}
+
+// needsJWTSecret сообщает, используется ли jwtSecret: он служит ключом по
+// умолчанию и для токенов, и для ссылок на файлы
+func (a AuthConfig) needsJWTSecret() bool {
+	return len(a.Keys) == 0 || len(a.FileLinkKeys) == 0
+}
+
+// CORSConfig - разрешённые источники запросов браузера
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+// StorageConfig - где лежат данные
+type StorageConfig struct {
+	Backend  string `yaml:"backend"`  // json или sqlite
+	JSONDir  string `yaml:"jsonDir"`  // каталог JSON-хранилищ
+	FilesDir string `yaml:"filesDir"` // каталог PDF уроков
+	CacheDir string `yaml:"cacheDir"` // каталог PDF с водяными знаками
+	DBPath   string `yaml:"dbPath"`   // файл базы SQLite
+
+	MaxUploadMB int           `yaml:"maxUploadMB"` // предельный размер загружаемого файла урока
+	FileLinkTTL time.Duration `yaml:"fileLinkTTL"` // срок действия подписанной ссылки на PDF урока
+}
+
+// BackupConfig - резервные копии по расписанию
+type BackupConfig struct {
+	Dir      string        `yaml:"dir"`      // каталог архивов
+	Interval time.Duration `yaml:"interval"` // период между копиями; 0 отключает расписание
+	Keep     int           `yaml:"keep"`     // сколько последних копий хранить
+
+	// Пределы распаковки восстанавливаемого архива
+	MaxEntryMB int `yaml:"maxEntryMB"` // одного файла
+	MaxTotalMB int `yaml:"maxTotalMB"` // всех файлов вместе
+}
+
+// Default возвращает настройки по умолчанию
+func Default() Config {
+	return Config{
+		Mode:   ModeProd,
+		Listen: ":8080",
+		Auth: AuthConfig{
+			JWTSecret:       DefaultJWTSecret,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+
+			MaxLoginFailures:   5,
+			MaxIPLoginFailures: 20,
+			LoginDelay:         time.Second,
+			LoginLockout:       15 * time.Minute,
+
+			PasswordResetTTL: 24 * time.Hour,
+			TOTPIssuer:       "myapp",
+
+			Issuer:   "myapp",
+			Audience: "myapp-api",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+		},
+		Storage: StorageConfig{
+			Backend:  "json",
+			JSONDir:  "storage/jsons",
+			FilesDir: "storage/files",
+			CacheDir: "storage/cache",
+			DBPath:   "storage/app.db",
+
+			MaxUploadMB: 50,
+			FileLinkTTL: 5 * time.Minute,
+		},
+		Backup: BackupConfig{
+			Dir:      "storage/backups",
+			Interval: 24 * time.Hour,
+			Keep:     7,
+
+			MaxEntryMB: 1024,
+			MaxTotalMB: 16 << 10,
+		},
+	}
+}
+
+// Load собирает настройки из файла, окружения и флагов args и проверяет их
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("myapp", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to the YAML config file (env APP_CONFIG, default config.yaml if present)")
+	mode := fs.String("mode", "", "server mode: dev or prod")
+	listen := fs.String("listen", "", "listen address, e.g. :8080")
+	backend := fs.String("storage", "", "storage backend: json or sqlite")
+	dbPath := fs.String("db", "", "path to the SQLite database")
+	jsonDir := fs.String("json-dir", "", "directory with the JSON stores")
+	filesDir := fs.String("files-dir", "", "directory with lesson PDFs")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	// 1. Файл
+	path, required := *configPath, true
+	if path == "" {
+		path, required = os.Getenv("APP_CONFIG"), true
+	}
+	if path == "" {
+		path, required = "config.yaml", false
+	}
+	if err := loadFile(&cfg, path, required); err != nil {
+		return Config{}, err
+	}
+
+	// 2. Окружение
+	if err := applyEnv(&cfg); err != nil {
+		return Config{}, err
+	}
+
+	// 3. Флаги - только явно заданные
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mode":
+			cfg.Mode = *mode
+		case "listen":
+			cfg.Listen = *listen
+		case "storage":
+			cfg.Storage.Backend = *backend
+		case "db":
+			cfg.Storage.DBPath = *dbPath
+		case "json-dir":
+			cfg.Storage.JSONDir = *jsonDir
+		case "files-dir":
+			cfg.Storage.FilesDir = *filesDir
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string, required bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) && !required {
+			return nil
+		}
+		return fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	strVars := map[string]*string{
+		"APP_MODE":              &cfg.Mode,
+		"APP_LISTEN":            &cfg.Listen,
+		"APP_JWT_SECRET":        &cfg.Auth.JWTSecret,
+		"APP_TOTP_ISSUER":       &cfg.Auth.TOTPIssuer,
+		"APP_JWT_ISSUER":        &cfg.Auth.Issuer,
+		"APP_JWT_AUDIENCE":      &cfg.Auth.Audience,
+		"APP_JWT_SIGNING_KEY":   &cfg.Auth.SigningKey,
+		"APP_FILE_LINK_KEY":     &cfg.Auth.FileLinkKey,
+		"APP_STORAGE_BACKEND":   &cfg.Storage.Backend,
+		"APP_STORAGE_JSON_DIR":  &cfg.Storage.JSONDir,
+		"APP_STORAGE_FILES_DIR": &cfg.Storage.FilesDir,
+		"APP_STORAGE_CACHE_DIR": &cfg.Storage.CacheDir,
+		"APP_STORAGE_DB_PATH":   &cfg.Storage.DBPath,
+		"APP_BACKUP_DIR":        &cfg.Backup.Dir,
+	}
+	for name, dst := range strVars {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+
+	durVars := map[string]*time.Duration{
+		"APP_ACCESS_TOKEN_TTL":   &cfg.Auth.AccessTokenTTL,
+		"APP_REFRESH_TOKEN_TTL":  &cfg.Auth.RefreshTokenTTL,
+		"APP_FILE_LINK_TTL":      &cfg.Storage.FileLinkTTL,
+		"APP_BACKUP_INTERVAL":    &cfg.Backup.Interval,
+		"APP_LOGIN_DELAY":        &cfg.Auth.LoginDelay,
+		"APP_LOGIN_LOCKOUT":      &cfg.Auth.LoginLockout,
+		"APP_PASSWORD_RESET_TTL": &cfg.Auth.PasswordResetTTL,
+	}
+	for name, dst := range durVars {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = d
+		}
+	}
+
+	intVars := map[string]*int{
+		"APP_STORAGE_MAX_UPLOAD_MB": &cfg.Storage.MaxUploadMB,
+		"APP_BACKUP_KEEP":           &cfg.Backup.Keep,
+		"APP_BACKUP_MAX_ENTRY_MB":   &cfg.Backup.MaxEntryMB,
+		"APP_BACKUP_MAX_TOTAL_MB":   &cfg.Backup.MaxTotalMB,
+		"APP_MAX_LOGIN_FAILURES":    &cfg.Auth.MaxLoginFailures,
+		"APP_MAX_IP_LOGIN_FAILURES": &cfg.Auth.MaxIPLoginFailures,
+	}
+	for name, dst := range intVars {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = n
+		}
+	}
+
+	if v, ok := os.LookupEnv("APP_CORS_ORIGINS"); ok {
+		cfg.CORS.AllowedOrigins = splitList(v)
+	}
+	return nil
+}
+
+// validateKeys проверяет список ключей подписи; сами файлы ключей читаются при запуске
+func (c Config) validateKeys() []error {
+	var errs []error
+	signingID, keys := c.Auth.TokenKeys()
+	ids := map[string]KeyConfig{}
+	for i, k := range keys {
+		name := fmt.Sprintf("auth.keys[%d]", i)
+		if k.ID == "" {
+			errs = append(errs, fmt.Errorf("%s: id is required", name))
+		} else if _, ok := ids[k.ID]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate id %q", name, k.ID))
+		}
+		ids[k.ID] = k
+
+		switch k.Alg {
+		case "HS256":
+			switch {
+			case len(c.Auth.Keys) == 0:
+				// Ключ по умолчанию - это jwtSecret, он проверен выше
+			case k.Secret == "":
+				errs = append(errs, fmt.Errorf("%s: HS256 secret is required", name))
+			case c.Mode != ModeDev && publishedSecret(k.Secret):
+				errs = append(errs, fmt.Errorf("%s: HS256 secret is an example value, generate a new one outside dev mode", name))
+			case c.Mode != ModeDev && len(k.Secret) < 32:
+				errs = append(errs, fmt.Errorf("%s: HS256 secret must be at least 32 characters outside dev mode", name))
+			}
+		case "RS256", "EdDSA":
+			if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+				errs = append(errs, fmt.Errorf("%s: privateKeyFile or publicKeyFile is required for %s", name, k.Alg))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: alg must be HS256, RS256 or EdDSA, got %q", name, k.Alg))
+		}
+	}
+
+	switch k, ok := ids[signingID]; {
+	case !ok:
+		errs = append(errs, fmt.Errorf("auth.signingKey %q is not in auth.keys", signingID))
+	case k.Alg != "HS256" && k.PrivateKeyFile == "":
+		errs = append(errs, fmt.Errorf("auth.signingKey %q needs a privateKeyFile", signingID))
+	}
+	return errs
+}
+
+func splitList(v string) []string {
+	var result []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// validateLinkKeys проверяет ключи подписи ссылок на файлы
+func (c Config) validateLinkKeys() []error {
+	var errs []error
+	signingID, keys := c.Auth.LinkKeys()
+	ids := map[string]bool{}
+	for i, k := range c.Auth.FileLinkKeys {
+		name := fmt.Sprintf("auth.fileLinkKeys[%d]", i)
+		switch {
+		case k.ID == "":
+			errs = append(errs, fmt.Errorf("%s: id is required", name))
+		case ids[k.ID]:
+			errs = append(errs, fmt.Errorf("%s: duplicate id %q", name, k.ID))
+		}
+		ids[k.ID] = true
+
+		switch {
+		case k.Secret == "":
+			errs = append(errs, fmt.Errorf("%s: secret is required", name))
+		case c.Mode != ModeDev && publishedSecret(k.Secret):
+			errs = append(errs, fmt.Errorf("%s: secret is an example value, generate a new one outside dev mode", name))
+		case c.Mode != ModeDev && len(k.Secret) < 32:
+			errs = append(errs, fmt.Errorf("%s: secret must be at least 32 characters outside dev mode", name))
+		}
+	}
+
+	if !slices.ContainsFunc(keys, func(k LinkKeyConfig) bool { return k.ID == signingID }) {
+		errs = append(errs, fmt.Errorf("auth.fileLinkKey %q is not in auth.fileLinkKeys", signingID))
+	}
+	return errs
+}
+
+// Validate проверяет настройки перед запуском
+func (c Config) Validate() error {
+	var errs []error
+
+	switch c.Mode {
+	case ModeDev, ModeProd:
+	default:
+		errs = append(errs, fmt.Errorf("mode must be %q or %q, got %q", ModeDev, ModeProd, c.Mode))
+	}
+
+	if c.Listen == "" {
+		errs = append(errs, errors.New("listen address is required"))
+	}
+
+	switch {
+	case !c.Auth.needsJWTSecret():
+		// Токены и ссылки подписываются своими ключами
+	case c.Auth.JWTSecret == "":
+		errs = append(errs, errors.New("auth.jwtSecret is required unless both auth.keys and auth.fileLinkKeys are set"))
+	case c.Mode != ModeDev && publishedSecret(c.Auth.JWTSecret):
+		errs = append(errs, errors.New("auth.jwtSecret must be changed from the default or example value outside dev mode (set APP_JWT_SECRET)"))
+	case c.Mode != ModeDev && len(c.Auth.JWTSecret) < 32:
+		errs = append(errs, errors.New("auth.jwtSecret must be at least 32 characters outside dev mode"))
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.accessTokenTTL must be positive"))
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refreshTokenTTL must be longer than auth.accessTokenTTL"))
+	}
+	if c.Auth.MaxLoginFailures <= 0 || c.Auth.MaxIPLoginFailures <= 0 {
+		errs = append(errs, errors.New("auth.maxLoginFailures and auth.maxIPLoginFailures must be positive"))
+	}
+	if c.Auth.LoginDelay <= 0 || c.Auth.LoginLockout < c.Auth.LoginDelay {
+		errs = append(errs, errors.New("auth.loginDelay must be positive and not longer than auth.loginLockout"))
+	}
+	if c.Auth.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("auth.passwordResetTTL must be positive"))
+	}
+	if strings.TrimSpace(c.Auth.TOTPIssuer) == "" || strings.Contains(c.Auth.TOTPIssuer, ":") {
+		errs = append(errs, errors.New("auth.totpIssuer is required and must not contain ':'"))
+	}
+	if c.Auth.Issuer == "" || c.Auth.Audience == "" {
+		errs = append(errs, errors.New("auth.issuer and auth.audience are required"))
+	}
+	errs = append(errs, c.validateKeys()...)
+	errs = append(errs, c.validateLinkKeys()...)
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allowedOrigins must not be empty"))
+	}
+
+	switch c.Storage.Backend {
+	case "json", "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend must be json or sqlite, got %q", c.Storage.Backend))
+	}
+	if c.Storage.JSONDir == "" || c.Storage.FilesDir == "" || c.Storage.CacheDir == "" {
+		errs = append(errs, errors.New("storage.jsonDir, storage.filesDir and storage.cacheDir are required"))
+	}
+	if c.Storage.MaxUploadMB <= 0 {
+		errs = append(errs, errors.New("storage.maxUploadMB must be positive"))
+	}
+	if c.Storage.FileLinkTTL <= 0 {
+		errs = append(errs, errors.New("storage.fileLinkTTL must be positive"))
+	}
+	if c.Storage.Backend == "sqlite" && c.Storage.DBPath == "" {
+		errs = append(errs, errors.New("storage.dbPath is required for the sqlite backend"))
+	}
+
+	if c.Backup.Dir == "" {
+		errs = append(errs, errors.New("backup.dir is required"))
+	}
+	if c.Backup.Interval < 0 {
+		errs = append(errs, errors.New("backup.interval must not be negative"))
+	}
+	if c.Backup.Keep <= 0 {
+		errs = append(errs, errors.New("backup.keep must be positive"))
+	}
+	if c.Backup.MaxEntryMB <= 0 || c.Backup.MaxTotalMB <= 0 {
+		errs = append(errs, errors.New("backup.maxEntryMB and backup.maxTotalMB must be positive"))
+	} else if c.Backup.MaxEntryMB > c.Backup.MaxTotalMB {
+		errs = append(errs, errors.New("backup.maxEntryMB must not exceed backup.maxTotalMB"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
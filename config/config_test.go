@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef-test"
+
+// TestValidatePublishedSecrets: секреты из кода и примера настроек не
+// проходят проверку вне режима dev, хотя и достаточно длинные
+func TestValidatePublishedSecrets(t *testing.T) {
+	for _, secret := range append([]string{DefaultJWTSecret}, exampleSecrets...) {
+		cfg := Default()
+		cfg.Auth.JWTSecret = secret
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "auth.jwtSecret") {
+			t.Errorf("jwtSecret %q: Validate = %v, want an auth.jwtSecret error", secret, err)
+		}
+		cfg.Mode = ModeDev
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("jwtSecret %q in dev mode: Validate = %v", secret, err)
+		}
+
+		cfg = Default()
+		cfg.Auth.JWTSecret = testSecret
+		cfg.Auth.Keys = []KeyConfig{{ID: "k1", Alg: "HS256", Secret: secret}}
+		cfg.Auth.FileLinkKeys = []LinkKeyConfig{{ID: "l1", Secret: secret}}
+		err := cfg.Validate()
+		for _, field := range []string{"auth.keys[0]", "auth.fileLinkKeys[0]"} {
+			if err == nil || !strings.Contains(err.Error(), field) {
+				t.Errorf("secret %q: Validate = %v, want an error for %s", secret, err, field)
+			}
+		}
+	}
+
+	cfg := Default()
+	cfg.Auth.JWTSecret = testSecret
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate with a generated secret = %v", err)
+	}
+}
+
+// TestExampleConfig: пример настроек без изменений не запускает сервер в prod
+func TestExampleConfig(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("..", "config.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("config.example.yaml: %v", err)
+	}
+	t.Setenv("APP_JWT_SECRET", "")
+	os.Unsetenv("APP_JWT_SECRET")
+
+	if _, err := Load([]string{"-config", path}); err == nil || !strings.Contains(err.Error(), "auth.jwtSecret") {
+		t.Errorf("Load(config.example.yaml) = %v, want an auth.jwtSecret error", err)
+	}
+	if _, err := Load([]string{"-config", path, "-mode", "dev"}); err == nil {
+		t.Error("Load(config.example.yaml) in dev mode succeeded with an empty jwtSecret")
+	}
+}
@@ -0,0 +1,47 @@
+package dto
+
+// LockoutResponse - логин, вход под которым временно заблокирован после
+// неудачных попыток. UserID и Name пусты, если такого пользователя нет.
+type LockoutResponse struct {
+	Login       string `json:"login"`
+	UserID      string `json:"userId,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Failures    int    `json:"failures"`
+	LockedUntil int64  `json:"lockedUntil"` // миллисекунды Unix
+}
+
+// PasswordChangeRequest - смена своего пароля; CurrentPassword может быть кодом сброса
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordResetResponse - код сброса пароля; показывается один раз
+type PasswordResetResponse struct {
+	UserID    string `json:"userId"`
+	Code      string `json:"code"`
+	ExpiresAt int64  `json:"expiresAt"` // миллисекунды Unix
+}
+
+// LoginTwoFactorRequest - второй шаг входа: вызов из ответа /login и код
+// из приложения-аутентификатора или код восстановления
+type LoginTwoFactorRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// TwoFactorCodeRequest - код из приложения-аутентификатора (или код восстановления)
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TwoFactorSetupResponse - новый секрет TOTP; URI кодируется в QR-код
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodesResponse - коды восстановления; показываются один раз
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
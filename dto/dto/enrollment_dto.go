@@ -0,0 +1,45 @@
+package dto
+
+import "myapp/internal/models"
+
+// EnrollmentRequest - запись ученика на модуль к тьютору
+type EnrollmentRequest struct {
+	StudentID string `json:"studentId"`
+	Module    int    `json:"module"`
+	TutorID   string `json:"tutorId"`
+}
+
+// EnrollmentTutorRequest - смена тьютора ученика
+type EnrollmentTutorRequest struct {
+	TutorID string `json:"tutorId"`
+}
+
+// LessonProgressRequest - отметка об уроке; пустое состояние снимает отметку
+type LessonProgressRequest struct {
+	State models.LessonState `json:"state"`
+}
+
+// EnrollmentResponse - запись на модуль с прогрессом по урокам модуля
+type EnrollmentResponse struct {
+	ID          string                   `json:"id"`
+	StudentID   string                   `json:"studentId"`
+	StudentName string                   `json:"studentName"`
+	Filial      string                   `json:"filial"`
+	Module      int                      `json:"module"`
+	ModuleName  string                   `json:"moduleName"`
+	TutorID     string                   `json:"tutorId"`
+	TutorName   string                   `json:"tutorName"`
+	Status      models.EnrollmentStatus  `json:"status"`
+	EnrolledAt  int64                    `json:"enrolledAt"`
+	Completed   int                      `json:"completed"` // завершённых уроков
+	Total       int                      `json:"total"`     // уроков в модуле
+	Lessons     []LessonProgressResponse `json:"lessons"`
+}
+
+// LessonProgressResponse - урок модуля и отметка ученика по нему
+type LessonProgressResponse struct {
+	Title     string             `json:"title"`
+	FileName  string             `json:"fileName"`
+	State     models.LessonState `json:"state,omitempty"`
+	UpdatedAt int64              `json:"updatedAt,omitempty"`
+}
@@ -0,0 +1,17 @@
+package dto
+
+// FileLinkResponse - подписанная ссылка на PDF урока, которую можно
+// открыть без bearer-токена до ExpiresAt (миллисекунды Unix)
+type FileLinkResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// RestoreResponse - итог восстановления из резервной копии
+type RestoreResponse struct {
+	CreatedAt       int64    `json:"createdAt"`       // когда создан восстановленный архив, миллисекунды Unix
+	Files           int      `json:"files"`           // число восстановленных PDF уроков
+	MissingFiles    []string `json:"missingFiles"`    // файлы из индекса модулей, которых не было в архиве
+	PreRestore      string   `json:"preRestore"`      // архив с данными, которые были до восстановления
+	RevokedSessions int      `json:"revokedSessions"` // число отозванных сессий; войти нужно заново
+}
@@ -0,0 +1,31 @@
+package dto
+
+import "myapp/internal/models"
+
+// FilialRequest - поля филиала при создании и изменении.
+// Пустой ID при создании - следующий свободный числовой ID;
+// Active не меняется, если не передан (новый филиал активен).
+type FilialRequest struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Timezone string `json:"timezone"`
+	Active   *bool  `json:"active,omitempty"`
+}
+
+// UserFilialRequest - перевод пользователя в другой филиал
+type UserFilialRequest struct {
+	Filial string `json:"filial"`
+}
+
+// FilialStats - число пользователей филиала по ролям и статусам.
+// Registered=false - ID встречается у пользователей, но филиала нет в справочнике.
+type FilialStats struct {
+	Filial     string                    `json:"filial"`
+	Name       string                    `json:"name,omitempty"`
+	Registered bool                      `json:"registered"`
+	Active     bool                      `json:"active"`
+	Total      int                       `json:"total"`
+	ByRole     map[models.UserRole]int   `json:"byRole"`
+	ByStatus   map[models.UserStatus]int `json:"byStatus"`
+}
@@ -0,0 +1,42 @@
+package dto
+
+// GrantRequest - выдача доступа к модулю. Срок задаётся либо датой until
+// (миллисекунды Unix), либо числом дней days от текущего момента.
+type GrantRequest struct {
+	Module int   `json:"module"`
+	Until  int64 `json:"until,omitempty"`
+	Days   int   `json:"days,omitempty"`
+}
+
+// GrantExtendRequest - продление доступа: новая дата until или days дней
+// к текущему сроку (к текущему моменту, если срок уже истёк)
+type GrantExtendRequest struct {
+	Until int64 `json:"until,omitempty"`
+	Days  int   `json:"days,omitempty"`
+}
+
+// FilialGrantRequest - выдача модуля всем активным тьюторам филиала
+type FilialGrantRequest struct {
+	Filial string `json:"filial"`
+	Until  int64  `json:"until,omitempty"`
+	Days   int    `json:"days,omitempty"`
+}
+
+// GrantResponse - доступ тьютора к модулю
+type GrantResponse struct {
+	TutorID    string `json:"tutorId"`
+	TutorName  string `json:"tutorName,omitempty"`
+	Filial     string `json:"filial,omitempty"`
+	Module     int    `json:"module"`
+	ModuleName string `json:"moduleName,omitempty"`
+	Until      int64  `json:"until"`
+}
+
+// FilialGrantResult - итог выдачи модуля одному тьютору филиала. Changed
+// ложно, если у тьютора уже был доступ не короче запрошенного; Error
+// заполнено, если доступ сохранить не удалось.
+type FilialGrantResult struct {
+	GrantResponse
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
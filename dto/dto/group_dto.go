@@ -0,0 +1,37 @@
+package dto
+
+import "myapp/internal/models"
+
+// GroupRequest - поля группы при создании и изменении.
+// Пустой filial при создании означает филиал текущего пользователя.
+type GroupRequest struct {
+	Name       string                `json:"name"`
+	Filial     string                `json:"filial"`
+	Module     int                   `json:"module"`
+	TutorID    string                `json:"tutorId"`
+	StudentIDs []string              `json:"studentIds"`
+	Schedule   []models.ScheduleSlot `json:"schedule"`
+	StartsOn   string                `json:"startsOn"`
+	EndsOn     string                `json:"endsOn,omitempty"`
+}
+
+// AttendanceRequest - отметки о посещении одного занятия группы
+type AttendanceRequest struct {
+	Date  string           `json:"date"`
+	Start string           `json:"start"`
+	Marks []AttendanceMark `json:"marks"`
+}
+
+// AttendanceMark - отметка одного ученика
+type AttendanceMark struct {
+	StudentID string                  `json:"studentId"`
+	Status    models.AttendanceStatus `json:"status"`
+}
+
+// ClassResponse - занятие группы по расписанию с отметками о посещении
+type ClassResponse struct {
+	Date     string              `json:"date"`
+	Start    string              `json:"start"`
+	Duration int                 `json:"duration"`
+	Marks    []models.Attendance `json:"marks"`
+}
@@ -0,0 +1,24 @@
+package dto
+
+// ModuleRequest - поля модуля при создании и изменении.
+// При изменении Version - версия, которую клиент прочитал перед правкой.
+type ModuleRequest struct {
+	Name           string `json:"name"`
+	DescriptionMin string `json:"descriptionMin"`
+	DescriptionMax string `json:"descriptionMax"`
+	TotalClasses   int    `json:"totalClasses"`
+	TotalDuration  string `json:"totalDuration"`
+	LinkToFolder   string `json:"linkToFolder"`
+	Version        int    `json:"version"`
+}
+
+// ModuleArchiveRequest - перенос модуля в архив или возврат из него
+type ModuleArchiveRequest struct {
+	Archived bool `json:"archived"`
+	Version  int  `json:"version"`
+}
+
+// ModuleOrderRequest - новый порядок модулей каталога
+type ModuleOrderRequest struct {
+	IDs []int `json:"ids"`
+}
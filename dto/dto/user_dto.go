@@ -10,4 +10,23 @@ type UserResponse struct {
 	Role     models.UserRole   `json:"role"`
 	Password string            `json:"password"`
 	Status   models.UserStatus `json:"status"`
+
+	MustChangePassword bool `json:"mustChangePassword,omitempty"` // выдан код сброса, пароль ещё не сменён
+}
+
+// UserUpdateRequest - изменяемые поля учётной записи; пустые поля не меняются
+type UserUpdateRequest struct {
+	Name     string `json:"name,omitempty"`
+	Filial   string `json:"filial,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// UserStatusRequest - смена статуса пользователя
+type UserStatusRequest struct {
+	Status models.UserStatus `json:"status"`
+}
+
+// UserRoleRequest - смена роли пользователя
+type UserRoleRequest struct {
+	Role models.UserRole `json:"role"`
 }
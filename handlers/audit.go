@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"myapp/pkg/utils"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// auditSecretFields - поля, значения которых не записываются в журнал аудита
+var auditSecretFields = []string{"password"}
+
+// GetAuditLog возвращает журнал аудита (только owner)
+// (GET /admin/audit?user=ID&actor=ID&action=NAME&from=MS&to=MS).
+// user отбирает записи о целевом пользователе, actor - о том, кто действовал.
+func (h *UserHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionViewAudit, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	userID, actorID, action := query.Get("user"), query.Get("actor"), query.Get("action")
+	var from, to int64
+	for name, dst := range map[string]*int64{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid '"+name+"' parameter", http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+
+	events, err := h.store.AuditLog().List()
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+
+	result := []models.AuditEvent{}
+	for _, e := range events {
+		switch {
+		case userID != "" && e.TargetID != userID,
+			actorID != "" && e.ActorID != actorID,
+			action != "" && e.Action != action,
+			from != 0 && e.At < from,
+			to != 0 && e.At > to:
+			continue
+		}
+		result = append(result, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Вспомогательные функции
+
+// auditEvent создаёт событие action над пользователем target
+func auditEvent(action string, target models.User) models.AuditEvent {
+	return models.AuditEvent{
+		Action:      action,
+		TargetID:    target.ID,
+		TargetLogin: target.Login,
+		Filial:      target.Filial,
+	}
+}
+
+// recordAudit дописывает событие в журнал аудита, заполняя ID, время, актора
+// и адрес клиента. Ошибка журнала не мешает ответу, но попадает в лог.
+func recordAudit(store storage.Backend, r *http.Request, actor models.User, event models.AuditEvent) {
+	id, err := utils.NewID()
+	if err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Action, err)
+		return
+	}
+	event.ID = id
+	event.At = time.Now().UnixMilli()
+	event.ActorID = actor.ID
+	event.ActorLogin = actor.Login
+	if event.Filial == "" {
+		event.Filial = actor.Filial
+	}
+	event.RemoteAddr = remoteHost(r)
+
+	if err := store.AuditLog().Append(event); err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// auditDiff возвращает поля JSON-представления, которые различаются в before
+// и after. Для секретных полей записывается только факт изменения.
+func auditDiff(before, after any) []models.AuditChange {
+	a, errA := jsonFields(before)
+	b, errB := jsonFields(after)
+	if errA != nil || errB != nil {
+		log.Printf("failed to diff audit values: %v", errors.Join(errA, errB))
+		return nil
+	}
+
+	var fields []string
+	for k := range a {
+		fields = append(fields, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
+
+	var changes []models.AuditChange
+	for _, f := range fields {
+		if bytes.Equal(a[f], b[f]) {
+			continue
+		}
+		if slices.Contains(auditSecretFields, f) {
+			changes = append(changes, models.AuditChange{Field: f})
+			continue
+		}
+		changes = append(changes, models.AuditChange{Field: f, Before: a[f], After: b[f]})
+	}
+	return changes
+}
+
+// jsonFields раскладывает объект на поля верхнего уровня его JSON-представления
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// remoteHost возвращает адрес клиента без порта
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
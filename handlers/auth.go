@@ -2,20 +2,30 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
 	"myapp/internal/auth"
 	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"myapp/pkg/utils"
 )
 
 type AuthHandler struct {
 	authService *auth.AuthService
+	store       storage.Backend
+	limiter     *auth.LoginLimiter
 }
 
-func NewAuthHandler(authService *auth.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *auth.AuthService, store storage.Backend, limiter *auth.LoginLimiter) *AuthHandler {
+	return &AuthHandler{authService: authService, store: store, limiter: limiter}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -32,60 +42,65 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Если есть авторизованный пользователь - проверяем его права
-	if requester, ok := r.Context().Value("user").(models.User); ok {
-		// Проверка прав доступа для регистрации
-		switch requester.Role {
-		case models.RoleAdmin:
-			if user.Role == models.RoleOwner || user.Role == models.RoleAdmin {
-				http.Error(w, "Admin can't register owners or admins", http.StatusForbidden)
-				return
-			}
-			if user.Filial != requester.Filial {
-				http.Error(w, "Admin can only register users in their own filial", http.StatusForbidden)
-				return
-			}
-		case models.RoleHelper:
-			if user.Role != models.RoleUser {
-				http.Error(w, "Helper can only register users", http.StatusForbidden)
-				return
-			}
-			if user.Filial != requester.Filial {
-				http.Error(w, "Helper can only register users in their own filial", http.StatusForbidden)
-				return
-			}
-		default:
-			// Для других ролей (кроме owner) запрещаем регистрацию
-			if requester.Role != models.RoleOwner {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
-		}
-	} else {
-		// Если нет авторизованного пользователя - разрешаем регистрацию только обычных пользователей
-		if user.Role != models.RoleUser {
-			http.Error(w, "Only user registration is allowed without authentication", http.StatusForbidden)
-			return
-		}
+	// 3. Проверяем права: без авторизации можно регистрировать только обычных пользователей
+	requester, _ := r.Context().Value("user").(models.User)
+	if err := policy.Can(requester, policy.ActionRegisterUser, &user); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 4. Пароль должен проходить требования к сложности
+	if err := auth.CheckPasswordStrength(user.Password, user.Login); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	user.MustChangePassword, user.ResetExpiresAt = false, 0
 
-	// 4. Проверка уникальности логина
+	// 5. Филиал должен быть в справочнике и активен
+	if !checkFilial(w, h.store.Filials(), user.Filial) {
+		return
+	}
+
+	// 6. Проверка уникальности логина
 	if _, err := h.authService.UserStorage.GetUserByLogin(user.Login); err == nil {
 		http.Error(w, "Login already taken", http.StatusConflict)
 		return
 	}
 
-	// 5. Установка значений по умолчанию
-	user.ID = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	// 7. Установка значений по умолчанию
+	id, err := utils.NewID()
+	if err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	user.ID = id
 	user.Status = models.StatusActive
 
-	// 6. Создание пользователя
+	// 8. Создание пользователя
 	if err := h.authService.Register(user); err != nil {
+		if errors.Is(err, auth.ErrPasswordTooLong) {
+			http.Error(w, "Password is too long", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
+	// 9. Создание профиля в файле данных роли
+	if err := storage.ProvisionUserData(h.store.UserData(), user); err != nil {
+		log.Printf("failed to provision profile data for user %s: %v", user.ID, err)
+	}
+
+	// 10. Журнал аудита; при самостоятельной регистрации актора нет
+	event := auditEvent(models.AuditRegister, user)
+	event.Changes = auditDiff(models.User{}, user)
+	recordAudit(h.store, r, requester, event)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(toUserResponse(user)); err != nil {
+		return
+	}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -99,28 +114,276 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, user, err := h.authService.Login(creds.Login, creds.Password)
+	// Пока действует задержка после неудач, пароль даже не проверяется
+	ip := remoteHost(r)
+	if !h.allowAttempt(w, ip, creds.Login) {
+		return
+	}
+
+	tokens, user, challenge, err := h.authService.Login(creds.Login, creds.Password)
+	if errors.Is(err, auth.ErrAccountInactive) {
+		h.loginFailed(r, ip, creds.Login, "user account is not active")
+		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, auth.ErrInvalidCredentials) {
+		h.loginFailed(r, ip, creds.Login, "invalid login or password")
+		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		return
+	} else if errors.Is(err, auth.ErrResetCodeExpired) {
+		// Проверка кода сброса - тоже попытка подобрать пароль
+		h.loginFailed(r, ip, creds.Login, "password reset code has expired")
+		http.Error(w, "Password reset code has expired", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		h.limiter.Release(ip, creds.Login)
+		log.Printf("login failed: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	// Пароль верен, но вход завершится только после второго фактора (POST /login/2fa);
+	// счётчик неудач до этого не сбрасывается
+	if challenge != nil {
+		h.limiter.Release(ip, creds.Login)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+	h.limiter.Succeed(ip, creds.Login)
+
+	recordAudit(h.store, r, user, auditEvent(models.AuditLogin, user))
+	writeTokens(w, tokens, user)
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, user, err := h.authService.Refresh(req.RefreshToken)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			http.Error(w, "Refresh token reuse detected, session revoked", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	writeTokens(w, tokens, user)
+}
+
+// JWKS публикует открытые ключи проверки токенов доступа (GET /.well-known/jwks.json).
+// Ключи HS256 не публикуются.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := r.Context().Value("sessionID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.authService.Logout(sessionID); err != nil {
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
 		return
 	}
 
-	if user.Status != models.StatusActive {
-		http.Error(w, "User account is not active", http.StatusForbidden)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserSessions отзывает все сессии указанного пользователя (только owner)
+func (h *AuthHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	targetUser, err := h.authService.UserStorage.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
+	if err := policy.Can(currentUser, policy.ActionRevokeSessions, &targetUser); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	revoked, err := h.authService.RevokeUserSessions(userID)
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditRevokeSessions, targetUser))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": userID,
+		"revoked": revoked,
+	}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// ListLockouts возвращает логины, вход под которыми временно заблокирован (GET /auth/lockouts, только owner)
+func (h *AuthHandler) ListLockouts(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionManageLockouts, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	result := []dto.LockoutResponse{}
+	for _, locked := range h.limiter.Locked(time.Now()) {
+		item := dto.LockoutResponse{
+			Login:       locked.Login,
+			Failures:    locked.Failures,
+			LockedUntil: locked.LockedUntil.UnixMilli(),
+		}
+		if user, err := h.authService.UserStorage.GetUserByLogin(locked.Login); err == nil {
+			item.UserID, item.Name = user.ID, user.Name
+		}
+		result = append(result, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// UnlockLogin снимает блокировку входа под логином (DELETE /auth/lockouts/{login}, только owner)
+func (h *AuthHandler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionManageLockouts, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	login := chi.URLParam(r, "login")
+	if !h.limiter.Unlock(login, time.Now()) {
+		http.Error(w, "Login is not locked", http.StatusNotFound)
+		return
+	}
+
+	target, err := h.authService.UserStorage.GetUserByLogin(login)
+	if err != nil {
+		target = models.User{Login: login}
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditLoginUnlocked, target))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginTwoFactor завершает вход пользователя со вторым фактором (POST /login/2fa)
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	// 1. Парсинг входных данных
+	var req dto.LoginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" || req.Code == "" {
+		http.Error(w, "challenge and code are required", http.StatusBadRequest)
+		return
+	}
+
+	// 2. Вызов из первого шага и ограничение попыток для его логина
+	user, err := h.authService.ChallengeUser(req.Challenge)
+	if err != nil {
+		http.Error(w, "Login challenge not found or expired", http.StatusUnauthorized)
+		return
+	}
+	ip := remoteHost(r)
+	if !h.allowAttempt(w, ip, user.Login) {
+		return
+	}
+
+	// 3. Проверка кода и открытие сессии
+	tokens, user, usedRecovery, err := h.authService.CompleteLogin(req.Challenge, req.Code)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCode):
+		h.loginFailed(r, ip, user.Login, "invalid two-factor code")
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrChallengeNotFound):
+		h.limiter.Release(ip, user.Login)
+		http.Error(w, "Login challenge not found or expired", http.StatusUnauthorized)
+		return
+	case err != nil:
+		h.limiter.Release(ip, user.Login)
+		log.Printf("two-factor login failed: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	h.limiter.Succeed(ip, user.Login)
+
+	// 4. Журнал аудита
+	event := auditEvent(models.AuditLogin, user)
+	event.Detail = "two-factor code"
+	if usedRecovery {
+		event.Detail = "recovery code"
+	}
+	recordAudit(h.store, r, user, event)
+
+	writeTokens(w, tokens, user)
+}
+
+// allowAttempt проверяет, не действует ли задержка после неудачных попыток
+// для адреса ip и логина login, и резервирует попытку; её завершает
+// loginFailed, limiter.Fail, limiter.Succeed или limiter.Release.
+// При ошибке ответ уже отправлен.
+func (h *AuthHandler) allowAttempt(w http.ResponseWriter, ip, login string) bool {
+	wait, ok := h.limiter.Allow(ip, login, time.Now())
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// loginFailed учитывает неудачный вход и записывает его в журнал аудита с причиной detail.
+// Попытка под существующим логином попадает в историю этого пользователя.
+func (h *AuthHandler) loginFailed(r *http.Request, ip, login, detail string) {
+	locked := h.limiter.Fail(ip, login, time.Now())
+
+	target, err := h.authService.UserStorage.GetUserByLogin(login)
+	if err != nil {
+		target = models.User{Login: login}
+	}
+	event := auditEvent(models.AuditLoginFailed, target)
+	event.Detail = detail
+	recordAudit(h.store, r, models.User{}, event)
+	if locked {
+		recordAudit(h.store, r, models.User{}, auditEvent(models.AuditLoginLocked, target))
+	}
+}
+
+func writeTokens(w http.ResponseWriter, tokens auth.TokenPair, user models.User) {
 	response := struct {
-		Token string      `json:"token"`
-		User  models.User `json:"user"`
+		auth.TokenPair
+		User models.User `json:"user"`
 	}{
-		Token: token,
-		User:  user,
+		TokenPair: tokens,
+		User:      user,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(response)
-	if err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		return
 	}
 }
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"myapp/dto/dto"
+	"myapp/internal/backup"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxRestoreBytes - предельный размер загружаемого архива
+const maxRestoreBytes = 4 << 30
+
+// GetBackup отдаёт архив со всеми данными и PDF уроков (GET /admin/backup).
+// Архив собирается во временный файл под блокировками и отдаётся уже без них.
+func (h *UserHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем права
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionBackup, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 2. Собираем архив
+	tmp, err := os.CreateTemp("", "backup-*.tar.gz")
+	if err != nil {
+		http.Error(w, "Failed to create backup", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	manifest, err := h.WriteBackup(tmp)
+	if err != nil {
+		log.Printf("backup failed: %v", err)
+		http.Error(w, "Failed to create backup", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. Отправляем
+	recordAudit(h.store, r, currentUser, models.AuditEvent{
+		Action: models.AuditBackup,
+		Detail: fmt.Sprintf("%d files", len(manifest.Files)),
+	})
+	created := time.UnixMilli(manifest.CreatedAt)
+	name := backup.Name(backup.PrefixOnDemand, created)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, name, created, tmp)
+}
+
+// RestoreBackup заменяет все данные и PDF уроков содержимым архива
+// (POST /admin/restore, multipart-поле "file"). Архив проверяется целиком до
+// того, как что-либо меняется; текущие данные перед заменой сохраняются в
+// каталог резервных копий с префиксом pre-restore-, и если замена прервётся,
+// они возвращаются из этого архива. Журнал аудита не заменяется, а после
+// восстановления отзываются все сессии.
+func (h *UserHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем права
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionRestore, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 2. Читаем архив из формы
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreBytes)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Archive is larger than %d MB", maxRestoreBytes>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing 'file' in form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// 3. Распаковываем и проверяем архив рядом с резервными копиями
+	if err := os.MkdirAll(h.cfg.Backup.Dir, 0755); err != nil {
+		http.Error(w, "Failed to prepare restore", http.StatusInternalServerError)
+		return
+	}
+	dir, err := os.MkdirTemp(h.cfg.Backup.Dir, ".restore-*")
+	if err != nil {
+		http.Error(w, "Failed to prepare restore", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := backup.Extract(file, dir, h.extractLimits())
+	var snapshot *storage.JSONBackend
+	var missing []string
+	if err == nil {
+		if snapshot, err = storage.NewJSONBackend(filepath.Join(dir, backup.DataDir)); err != nil {
+			err = fmt.Errorf("%w: %v", backup.ErrInvalidArchive, err)
+		} else {
+			missing, err = backup.Check(snapshot, manifest)
+		}
+	}
+	if errors.Is(err, backup.ErrInvalidArchive) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("restore: failed to extract archive: %v", err)
+		http.Error(w, "Failed to extract archive", http.StatusInternalServerError)
+		return
+	}
+
+	// 4. Дальше данные меняются только целиком
+	unlock := h.lockAll()
+	defer unlock()
+
+	preRestore, err := backup.Save(h.cfg.Backup.Dir, backup.PrefixPreRestore, h.cfg.Backup.Keep, func(w io.Writer) (backup.Manifest, error) {
+		return backup.Write(w, h.store, h.cfg.Storage.FilesDir)
+	})
+	if err != nil {
+		log.Printf("restore: failed to save current data: %v", err)
+		http.Error(w, "Failed to back up current data, nothing was restored", http.StatusInternalServerError)
+		return
+	}
+
+	restored, err := h.importSnapshot(snapshot, filepath.Join(dir, backup.FilesDir))
+
+	// Копии с водяными знаками относятся к прежним файлам и пользователям;
+	// после отката файлы уже могли смениться дважды
+	h.watermarkMu.Lock()
+	os.RemoveAll(filepath.Join(h.cfg.Storage.CacheDir, "watermarks"))
+	h.watermarkMu.Unlock()
+
+	if err != nil {
+		log.Printf("restore: failed to import data: %v", err)
+		if rbErr := h.rollbackRestore(preRestore); rbErr != nil {
+			log.Printf("restore: rollback from %s failed, restore it manually: %v", preRestore, rbErr)
+			http.Error(w, "Restore failed and rollback failed, previous data is saved in "+filepath.Base(preRestore), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Restore failed, previous data was put back", http.StatusInternalServerError)
+		return
+	}
+
+	// Журнал аудита не восстанавливается из архива: он только дополняется
+	recordAudit(h.store, r, currentUser, models.AuditEvent{
+		Action: models.AuditRestore,
+		Detail: fmt.Sprintf("backup created at %d, previous data saved to %s", manifest.CreatedAt, filepath.Base(preRestore)),
+	})
+	log.Printf("data restored by user %s from backup created at %d; previous data saved to %s", currentUser.ID, manifest.CreatedAt, preRestore)
+
+	// 5. Сессии выданы прежним пользователям, после восстановления все входят заново
+	revoked, err := h.authService.RevokeAllSessions()
+	if err != nil {
+		log.Printf("restore: failed to revoke sessions: %v", err)
+		http.Error(w, "Data was restored, but sessions could not be revoked", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dto.RestoreResponse{
+		CreatedAt:       manifest.CreatedAt,
+		Files:           restored,
+		MissingFiles:    missing,
+		PreRestore:      filepath.Base(preRestore),
+		RevokedSessions: revoked,
+	})
+}
+
+// WriteBackup записывает архив всех данных, не допуская изменений через
+// обработчики на время снимка. Используется и для копий по расписанию.
+func (h *UserHandler) WriteBackup(w io.Writer) (backup.Manifest, error) {
+	unlock := h.lockAll()
+	defer unlock()
+	return backup.Write(w, h.store, h.cfg.Storage.FilesDir)
+}
+
+// Вспомогательные функции
+
+// lockAll останавливает изменяющие запросы, в том числе входы и сессии, и
+// берёт блокировки всех изменений данных в одном порядке; enrollMu перед
+// groupsMu, как в переводе пользователя между филиалами
+func (h *UserHandler) lockAll() (unlock func()) {
+	unlockRequests := h.maintenance.Lock()
+	locks := []interface{ Lock() }{&h.filialsMu, &h.filesMu, &h.grantsMu, &h.enrollMu, &h.groupsMu}
+	for _, m := range locks {
+		m.Lock()
+	}
+	return func() {
+		h.groupsMu.Unlock()
+		h.enrollMu.Unlock()
+		h.grantsMu.Unlock()
+		h.filesMu.Unlock()
+		h.filialsMu.Unlock()
+		unlockRequests()
+	}
+}
+
+// extractLimits возвращает пределы распаковки загруженного архива из настроек
+func (h *UserHandler) extractLimits() backup.Limits {
+	return backup.Limits{
+		MaxEntry: int64(h.cfg.Backup.MaxEntryMB) << 20,
+		MaxTotal: int64(h.cfg.Backup.MaxTotalMB) << 20,
+	}
+}
+
+// importSnapshot заменяет данные хранилища снимком snapshot, а PDF уроков -
+// файлами из filesDir. Возвращает число восстановленных файлов.
+func (h *UserHandler) importSnapshot(snapshot storage.Backend, filesDir string) (int, error) {
+	if err := storage.Copy(h.store, snapshot); err != nil {
+		return 0, err
+	}
+	return h.restoreLessonFiles(filesDir)
+}
+
+// rollbackRestore возвращает данные и PDF уроков из архива, сохранённого
+// перед восстановлением. Вызывается под блокировками lockAll.
+func (h *UserHandler) rollbackRestore(archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir, err := os.MkdirTemp(h.cfg.Backup.Dir, ".rollback-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Архив собран этим сервером из текущих данных: пределы к нему не применяются,
+	// иначе их уменьшение сделало бы откат невозможным
+	if _, err := backup.Extract(f, dir, backup.Limits{}); err != nil {
+		return err
+	}
+	snapshot, err := storage.NewJSONBackend(filepath.Join(dir, backup.DataDir))
+	if err != nil {
+		return err
+	}
+	_, err = h.importSnapshot(snapshot, filepath.Join(dir, backup.FilesDir))
+	return err
+}
+
+// restoreLessonFiles заменяет PDF уроков файлами из dir и удаляет PDF,
+// которых нет в архиве. Возвращает число восстановленных файлов.
+func (h *UserHandler) restoreLessonFiles(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(h.cfg.Storage.FilesDir, 0755); err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		f, err := storage.SafeDir(dir).Open(e.Name())
+		if err != nil {
+			return 0, err
+		}
+		_, err = storage.WriteReaderAtomic(filepath.Join(h.cfg.Storage.FilesDir, e.Name()), f, 0644)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		keep[e.Name()] = true
+	}
+
+	current, err := os.ReadDir(h.cfg.Storage.FilesDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range current {
+		if e.Type().IsRegular() && storage.ValidName(e.Name()) && strings.HasSuffix(e.Name(), ".pdf") && !keep[e.Name()] {
+			if err := os.Remove(filepath.Join(h.cfg.Storage.FilesDir, e.Name())); err != nil {
+				log.Printf("restore: failed to remove lesson file %s: %v", e.Name(), err)
+			}
+		}
+	}
+	return len(keep), nil
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"io/fs"
+	"log"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/pkg/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CreateFileLink выдаёт короткоживущую подписанную ссылку на PDF урока
+// (POST /files/{filename}/link), чтобы фронтенд мог встроить файл без токена
+func (h *UserHandler) CreateFileLink(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем пользователя и доступ к файлу
+	user, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(user, policy.ActionViewFile, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	fileName := chi.URLParam(r, "filename")
+	if _, ok := h.checkFileAccess(w, user, fileName); !ok {
+		return
+	}
+
+	// 2. Подписываем ссылку на этого пользователя
+	expires, sig := h.links.Sign(fileName, user.ID, time.Now())
+	query := url.Values{}
+	query.Set("u", user.ID)
+	query.Set("exp", strconv.FormatInt(expires, 10))
+	query.Set("sig", sig)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dto.FileLinkResponse{
+		URL:       "/files/" + url.PathEscape(fileName) + "/signed?" + query.Encode(),
+		ExpiresAt: time.Unix(expires, 0).UnixMilli(),
+	})
+}
+
+// GetSignedFile отдаёт PDF урока по подписанной ссылке (GET /files/{filename}/signed, без авторизации).
+// Доступ пользователя к файлу проверяется заново: отзыв доступа действует и на выданные ссылки.
+func (h *UserHandler) GetSignedFile(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем подпись и срок действия
+	fileName := chi.URLParam(r, "filename")
+	query := r.URL.Query()
+	userID := query.Get("u")
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil || h.links.Verify(fileName, userID, expires, query.Get("sig"), time.Now()) != nil {
+		http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		return
+	}
+
+	// 2. Проверяем пользователя, которому выдана ссылка
+	user, err := h.authService.UserStorage.GetUserByID(userID)
+	if err != nil || user.Status != models.StatusActive {
+		http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		return
+	}
+	if err := policy.Can(user, policy.ActionViewFile, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	moduleID, ok := h.checkFileAccess(w, user, fileName)
+	if !ok {
+		return
+	}
+
+	// 3. Отправляем файл
+	h.serveLessonFile(w, r, user, fileName, moduleID, models.DownloadViaLink)
+}
+
+// GetDownloads возвращает журнал скачиваний PDF уроков
+// (GET /admin/downloads?user=ID&file=NAME&module=N&from=MS&to=MS).
+// Owner видит все записи, admin - скачивания пользователей своего филиала.
+func (h *UserHandler) GetDownloads(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !policy.Allowed(currentUser.Role, policy.ActionViewDownloads) {
+		http.Error(w, "Forbidden: action is not allowed for your role", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	userID, fileName := query.Get("user"), query.Get("file")
+	var moduleID int
+	var from, to int64
+	for name, dst := range map[string]*int64{"from": &from, "to": &to} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid '"+name+"' parameter", http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+	}
+	if v := query.Get("module"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid module ID", http.StatusBadRequest)
+			return
+		}
+		moduleID = n
+	}
+
+	downloads, err := h.store.Downloads().List()
+	if err != nil {
+		http.Error(w, "Failed to load download log", http.StatusInternalServerError)
+		return
+	}
+
+	// Права проверяются по скачавшему пользователю. Записи о безвозвратно
+	// удалённых пользователях видит только тот, чьё правило не ограничено филиалом.
+	allUsers, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+	visible := make(map[string]bool)
+	for _, u := range policy.Filter(currentUser, policy.ActionViewDownloads, allUsers) {
+		visible[u.ID] = true
+	}
+	seeAll := policy.Can(currentUser, policy.ActionViewDownloads, &models.User{}) == nil
+
+	result := []models.Download{}
+	for _, d := range downloads {
+		switch {
+		case userID != "" && d.UserID != userID,
+			fileName != "" && d.FileName != fileName,
+			moduleID != 0 && d.Module != moduleID,
+			from != 0 && d.At < from,
+			to != 0 && d.At > to,
+			!visible[d.UserID] && !seeAll:
+			continue
+		}
+		result = append(result, d)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Вспомогательные функции
+
+// checkFileAccess находит модуль, к которому относится файл, и проверяет
+// доступ к нему: owner видит файлы всех модулей, тьютор - только модулей
+// с действующим доступом. Возвращает ID модуля; при ошибке ответ уже отправлен.
+func (h *UserHandler) checkFileAccess(w http.ResponseWriter, user models.User, fileName string) (int, bool) {
+	groups, err := h.store.ModuleFiles().List()
+	if err != nil {
+		http.Error(w, "Failed to load module files", http.StatusInternalServerError)
+		return 0, false
+	}
+	var moduleIDs []int
+	for _, g := range groups {
+		if slices.ContainsFunc(g.Files, func(f models.FileItem) bool { return f.FileName == fileName }) {
+			moduleIDs = append(moduleIDs, g.ID)
+		}
+	}
+	if len(moduleIDs) == 0 {
+		http.Error(w, "PDF file not found", http.StatusNotFound)
+		return 0, false
+	}
+
+	if policy.Can(user, policy.ActionManageFiles, nil) == nil {
+		return moduleIDs[0], true
+	}
+
+	if user.Status != models.StatusActive {
+		http.Error(w, "Forbidden: user is not active", http.StatusForbidden)
+		return 0, false
+	}
+	data, err := h.store.UserData().Get(user.Role, user.ID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
+		return 0, false
+	}
+	now := time.Now().UnixMilli()
+	for _, id := range moduleIDs {
+		granted := slices.ContainsFunc(data.Modules, func(m models.ModuleInfo) bool { return m.Module == id && m.Date > now })
+		if !granted {
+			continue
+		}
+		// Архивный модуль тьюторам больше не показывается
+		if module, err := h.store.Modules().Get(id); err == nil && !module.Archived {
+			return id, true
+		}
+	}
+
+	http.Error(w, "Forbidden: module not available", http.StatusForbidden)
+	return 0, false
+}
+
+// serveLessonFile отправляет PDF урока с водяным знаком пользователя, с поддержкой
+// Range, и записывает скачивание в журнал. Без знака файл не отдаётся.
+func (h *UserHandler) serveLessonFile(w http.ResponseWriter, r *http.Request, user models.User, fileName string, moduleID int, via string) {
+	f, err := h.watermarkedFile(user, fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "PDF file not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("failed to watermark %s for user %s: %v", fileName, user.ID, err)
+		http.Error(w, "Failed to prepare PDF file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Error accessing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Просмотрщик PDF дочитывает большой файл частями; в журнал попадает
+	// только запрос с начала файла, а не каждая часть
+	if rng := r.Header.Get("Range"); rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+		h.logDownload(r, user, fileName, moduleID, via)
+		recordAudit(h.store, r, user, models.AuditEvent{
+			Action: models.AuditDownloadFile,
+			Detail: fmt.Sprintf("%s (module %d, via %s)", fileName, moduleID, via),
+		})
+	}
+
+	// Защитные заголовки
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "inline; filename=\"presentation.pdf\"")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	http.ServeContent(w, r, fileName+".pdf", info.ModTime(), f)
+}
+
+// logDownload записывает скачивание в журнал; ошибка журнала не мешает отдаче файла
+func (h *UserHandler) logDownload(r *http.Request, user models.User, fileName string, moduleID int, via string) {
+	id, err := utils.NewID()
+	if err != nil {
+		log.Printf("failed to log download of %s by user %s: %v", fileName, user.ID, err)
+		return
+	}
+	err = h.store.Downloads().Append(models.Download{
+		ID:         id,
+		At:         time.Now().UnixMilli(),
+		UserID:     user.ID,
+		UserLogin:  user.Login,
+		FileName:   fileName,
+		Module:     moduleID,
+		Via:        via,
+		RemoteAddr: remoteHost(r),
+	})
+	if err != nil {
+		log.Printf("failed to log download of %s by user %s: %v", fileName, user.ID, err)
+	}
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/pkg/utils"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CreateEnrollment записывает ученика на модуль к тьютору (POST /enrollments)
+func (h *UserHandler) CreateEnrollment(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.EnrollmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 2. Проверяем ученика и права на него
+	student, err := h.authService.UserStorage.GetUserByID(req.StudentID)
+	if err != nil {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionEnroll, &student); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if student.Status != models.StatusActive {
+		http.Error(w, "Student is not active", http.StatusConflict)
+		return
+	}
+
+	// 3. Проверяем модуль и тьютора
+	module, ok := h.loadGrantableModule(w, req.Module)
+	if !ok {
+		return
+	}
+	if !h.checkTutor(w, req.TutorID, student.Filial, module.ID) {
+		return
+	}
+
+	// 4. Ученик не может быть записан на один модуль дважды
+	h.enrollMu.Lock()
+	defer h.enrollMu.Unlock()
+
+	enrollments, err := h.store.Enrollments().List()
+	if err != nil {
+		http.Error(w, "Failed to load enrollments", http.StatusInternalServerError)
+		return
+	}
+	for _, e := range enrollments {
+		if e.StudentID == student.ID && e.Module == module.ID && e.Status == models.EnrollmentActive {
+			http.Error(w, "Student is already enrolled in this module", http.StatusConflict)
+			return
+		}
+	}
+
+	// 5. Сохраняем запись
+	id, err := utils.NewID()
+	if err != nil {
+		http.Error(w, "Failed to generate enrollment ID", http.StatusInternalServerError)
+		return
+	}
+	enrollment := models.Enrollment{
+		ID:         id,
+		StudentID:  student.ID,
+		Module:     module.ID,
+		TutorID:    req.TutorID,
+		Status:     models.EnrollmentActive,
+		EnrolledAt: time.Now().UnixMilli(),
+		EnrolledBy: currentUser.ID,
+		Progress:   []models.LessonProgress{},
+	}
+	if err := h.store.Enrollments().Create(enrollment); err != nil {
+		http.Error(w, "Failed to save enrollment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.sendEnrollment(w, http.StatusCreated, enrollment)
+}
+
+// ListEnrollments возвращает доступные пользователю записи на модули
+// (GET /enrollments?student=ID&tutor=ID&module=N&status=active)
+func (h *UserHandler) ListEnrollments(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	moduleID := 0
+	if v := query.Get("module"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid module ID", http.StatusBadRequest)
+			return
+		}
+		moduleID = n
+	}
+
+	enrollments, err := h.store.Enrollments().List()
+	if err != nil {
+		http.Error(w, "Failed to load enrollments", http.StatusInternalServerError)
+		return
+	}
+	lookup, err := h.newEnrollmentLookup()
+	if err != nil {
+		http.Error(w, "Failed to load enrollment details", http.StatusInternalServerError)
+		return
+	}
+
+	result := []dto.EnrollmentResponse{}
+	for _, e := range enrollments {
+		switch {
+		case query.Get("student") != "" && e.StudentID != query.Get("student"),
+			query.Get("tutor") != "" && e.TutorID != query.Get("tutor"),
+			query.Get("status") != "" && string(e.Status) != query.Get("status"),
+			moduleID != 0 && e.Module != moduleID:
+			continue
+		}
+
+		student, ok := lookup.users[e.StudentID]
+		if !ok || policy.CanAccessEnrollment(currentUser, policy.ActionViewProgress, student, e.TutorID) != nil {
+			continue
+		}
+		result = append(result, lookup.response(e))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetEnrollment возвращает запись на модуль с прогрессом (GET /enrollments/{id})
+func (h *UserHandler) GetEnrollment(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	enrollment, _, ok := h.loadEnrollment(w, r, currentUser, policy.ActionViewProgress)
+	if !ok {
+		return
+	}
+
+	h.sendEnrollment(w, http.StatusOK, enrollment)
+}
+
+// ChangeEnrollmentTutor назначает ученику другого тьютора (PUT /enrollments/{id}/tutor)
+func (h *UserHandler) ChangeEnrollmentTutor(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.EnrollmentTutorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.enrollMu.Lock()
+	defer h.enrollMu.Unlock()
+
+	enrollment, student, ok := h.loadEnrollment(w, r, currentUser, policy.ActionEnroll)
+	if !ok {
+		return
+	}
+	if !h.checkTutor(w, req.TutorID, student.Filial, enrollment.Module) {
+		return
+	}
+
+	enrollment.TutorID = req.TutorID
+	if err := h.store.Enrollments().Update(enrollment); err != nil {
+		http.Error(w, "Failed to save enrollment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.sendEnrollment(w, http.StatusOK, enrollment)
+}
+
+// DropEnrollment отчисляет ученика с модуля, сохраняя прогресс (DELETE /enrollments/{id})
+func (h *UserHandler) DropEnrollment(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.enrollMu.Lock()
+	defer h.enrollMu.Unlock()
+
+	enrollment, _, ok := h.loadEnrollment(w, r, currentUser, policy.ActionEnroll)
+	if !ok {
+		return
+	}
+
+	enrollment.Status = models.EnrollmentDropped
+	if err := h.store.Enrollments().Update(enrollment); err != nil {
+		http.Error(w, "Failed to save enrollment: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetLessonProgress отмечает урок начатым или завершённым; пустое состояние
+// снимает отметку (PUT /enrollments/{id}/lessons/{filename})
+func (h *UserHandler) SetLessonProgress(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.LessonProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.State != "" && !models.IsValidLessonState(req.State) {
+		http.Error(w, "Invalid lesson state", http.StatusBadRequest)
+		return
+	}
+
+	h.enrollMu.Lock()
+	defer h.enrollMu.Unlock()
+
+	// 2. Проверяем запись и права
+	enrollment, _, ok := h.loadEnrollment(w, r, currentUser, policy.ActionUpdateProgress)
+	if !ok {
+		return
+	}
+	if enrollment.Status != models.EnrollmentActive {
+		http.Error(w, "Enrollment is not active", http.StatusConflict)
+		return
+	}
+
+	// 3. Урок должен быть в списке файлов модуля
+	fileName := chi.URLParam(r, "filename")
+	files, err := h.store.ModuleFiles().GetByModule(enrollment.Module)
+	if err != nil {
+		http.Error(w, "Failed to load module files", http.StatusInternalServerError)
+		return
+	}
+	if !slices.ContainsFunc(files, func(f models.FileItem) bool { return f.FileName == fileName }) {
+		http.Error(w, "Lesson not found in module", http.StatusNotFound)
+		return
+	}
+
+	// 4. Обновляем отметку
+	progress := slices.DeleteFunc(slices.Clone(enrollment.Progress), func(p models.LessonProgress) bool {
+		return p.FileName == fileName
+	})
+	if req.State != "" {
+		progress = append(progress, models.LessonProgress{
+			FileName:  fileName,
+			State:     req.State,
+			UpdatedAt: time.Now().UnixMilli(),
+			UpdatedBy: currentUser.ID,
+		})
+	}
+	enrollment.Progress = progress
+
+	if err := h.store.Enrollments().Update(enrollment); err != nil {
+		http.Error(w, "Failed to save progress: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.sendEnrollment(w, http.StatusOK, enrollment)
+}
+
+// Вспомогательные функции
+
+// loadEnrollment находит запись из URL и проверяет право action; при ошибке ответ уже отправлен
+func (h *UserHandler) loadEnrollment(w http.ResponseWriter, r *http.Request, currentUser models.User, action policy.Action) (models.Enrollment, models.User, bool) {
+	enrollment, err := h.store.Enrollments().Get(chi.URLParam(r, "id"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Enrollment not found", http.StatusNotFound)
+		return models.Enrollment{}, models.User{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load enrollment", http.StatusInternalServerError)
+		return models.Enrollment{}, models.User{}, false
+	}
+
+	student, err := h.authService.UserStorage.GetUserByID(enrollment.StudentID)
+	if err != nil {
+		http.Error(w, "Student not found", http.StatusNotFound)
+		return models.Enrollment{}, models.User{}, false
+	}
+
+	if err := policy.CanAccessEnrollment(currentUser, action, student, enrollment.TutorID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return models.Enrollment{}, models.User{}, false
+	}
+	return enrollment, student, true
+}
+
+// checkTutor проверяет, что тьютор активен, работает в филиале filial
+// и имеет действующий доступ к модулю; при ошибке ответ уже отправлен
+func (h *UserHandler) checkTutor(w http.ResponseWriter, tutorID, filial string, moduleID int) bool {
+	tutor, err := h.authService.UserStorage.GetUserByID(tutorID)
+	if err != nil || tutor.Role != models.RoleTutor {
+		http.Error(w, "Tutor not found", http.StatusNotFound)
+		return false
+	}
+	if tutor.Status != models.StatusActive {
+		http.Error(w, "Tutor is not active", http.StatusConflict)
+		return false
+	}
+	if tutor.Filial != filial {
+		http.Error(w, "Tutor must be in filial "+filial, http.StatusConflict)
+		return false
+	}
+
+	data, err := h.store.UserData().Get(tutor.Role, tutor.ID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
+		return false
+	}
+	now := time.Now().UnixMilli()
+	if !slices.ContainsFunc(data.Modules, func(m models.ModuleInfo) bool { return m.Module == moduleID && m.Date > now }) {
+		http.Error(w, "Tutor has no access to this module", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+func (h *UserHandler) sendEnrollment(w http.ResponseWriter, status int, enrollment models.Enrollment) {
+	lookup, err := h.newEnrollmentLookup()
+	if err != nil {
+		http.Error(w, "Failed to load enrollment details", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(lookup.response(enrollment))
+}
+
+// enrollmentLookup - пользователи, модули и уроки для сборки ответов о записях
+type enrollmentLookup struct {
+	users   map[string]models.User
+	modules map[int]models.Module
+	files   map[int][]models.FileItem
+}
+
+func (h *UserHandler) newEnrollmentLookup() (enrollmentLookup, error) {
+	lookup := enrollmentLookup{
+		users:   make(map[string]models.User),
+		modules: make(map[int]models.Module),
+		files:   make(map[int][]models.FileItem),
+	}
+
+	users, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		return lookup, err
+	}
+	for _, u := range users {
+		lookup.users[u.ID] = u
+	}
+
+	modules, err := h.store.Modules().List()
+	if err != nil {
+		return lookup, err
+	}
+	for _, m := range modules {
+		lookup.modules[m.ID] = m
+	}
+
+	groups, err := h.store.ModuleFiles().List()
+	if err != nil {
+		return lookup, err
+	}
+	for _, g := range groups {
+		lookup.files[g.ID] = g.Files
+	}
+	return lookup, nil
+}
+
+// response собирает запись с уроками модуля в их текущем порядке.
+// Отметки об уроках, убранных из модуля, сохраняются, но не показываются.
+func (l enrollmentLookup) response(e models.Enrollment) dto.EnrollmentResponse {
+	student, tutor := l.users[e.StudentID], l.users[e.TutorID]
+	resp := dto.EnrollmentResponse{
+		ID:          e.ID,
+		StudentID:   e.StudentID,
+		StudentName: student.Name,
+		Filial:      student.Filial,
+		Module:      e.Module,
+		ModuleName:  l.modules[e.Module].Name,
+		TutorID:     e.TutorID,
+		TutorName:   tutor.Name,
+		Status:      e.Status,
+		EnrolledAt:  e.EnrolledAt,
+		Lessons:     []dto.LessonProgressResponse{},
+	}
+
+	for _, f := range l.files[e.Module] {
+		lesson := dto.LessonProgressResponse{Title: f.Title, FileName: f.FileName}
+		if i := slices.IndexFunc(e.Progress, func(p models.LessonProgress) bool { return p.FileName == f.FileName }); i >= 0 {
+			lesson.State, lesson.UpdatedAt = e.Progress[i].State, e.Progress[i].UpdatedAt
+		}
+		if lesson.State == models.LessonCompleted {
+			resp.Completed++
+		}
+		resp.Lessons = append(resp.Lessons, lesson)
+	}
+	resp.Total = len(resp.Lessons)
+	return resp
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ListFilials возвращает справочник филиалов (GET /filials).
+// Неактивные филиалы видит только owner.
+func (h *UserHandler) ListFilials(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filials, err := h.store.Filials().List()
+	if err != nil {
+		http.Error(w, "Failed to load filials", http.StatusInternalServerError)
+		return
+	}
+	if policy.Can(currentUser, policy.ActionManageFilials, nil) != nil {
+		filials = slices.DeleteFunc(filials, func(f models.Filial) bool { return !f.Active })
+	}
+	if filials == nil {
+		filials = []models.Filial{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(filials); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GetFilial возвращает филиал (GET /filials/{id})
+func (h *UserHandler) GetFilial(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filial, ok := h.loadFilial(w, r)
+	if !ok {
+		return
+	}
+	if !filial.Active && policy.Can(currentUser, policy.ActionManageFilials, nil) != nil {
+		http.Error(w, "Filial not found", http.StatusNotFound)
+		return
+	}
+
+	sendFilial(w, http.StatusOK, filial)
+}
+
+// CreateFilial добавляет филиал в справочник (POST /filials, только owner)
+func (h *UserHandler) CreateFilial(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем права и разбираем запрос
+	if !h.canManageFilials(w, r) {
+		return
+	}
+
+	var req dto.FilialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.filialsMu.Lock()
+	defer h.filialsMu.Unlock()
+
+	// 2. Назначаем ID и проверяем поля
+	filials, err := h.store.Filials().List()
+	if err != nil {
+		http.Error(w, "Failed to load filials", http.StatusInternalServerError)
+		return
+	}
+	filial := applyFilialRequest(models.Filial{ID: strings.TrimSpace(req.ID), Active: true}, req)
+	if filial.ID == "" {
+		filial.ID = nextFilialID(filials)
+	}
+	if err := models.ValidateFilial(filial); err != nil {
+		http.Error(w, "Invalid filial: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if slices.ContainsFunc(filials, func(f models.Filial) bool { return f.ID == filial.ID }) {
+		http.Error(w, fmt.Sprintf("Filial %s already exists", filial.ID), http.StatusConflict)
+		return
+	}
+
+	// 3. Сохраняем
+	if err := h.store.Filials().Create(filial); err != nil {
+		http.Error(w, "Failed to save filial: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendFilial(w, http.StatusCreated, filial)
+}
+
+// UpdateFilial изменяет название, адрес, часовой пояс и активность филиала (PUT /filials/{id}, только owner)
+func (h *UserHandler) UpdateFilial(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageFilials(w, r) {
+		return
+	}
+
+	var req dto.FilialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.filialsMu.Lock()
+	defer h.filialsMu.Unlock()
+
+	current, ok := h.loadFilial(w, r)
+	if !ok {
+		return
+	}
+
+	filial := applyFilialRequest(current, req)
+	if err := models.ValidateFilial(filial); err != nil {
+		http.Error(w, "Invalid filial: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Filials().Update(filial); err != nil {
+		http.Error(w, "Failed to save filial: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendFilial(w, http.StatusOK, filial)
+}
+
+// DeleteFilial удаляет филиал из справочника (DELETE /filials/{id}, только owner).
+// Филиал, на который ссылаются пользователи или группы, можно только деактивировать.
+func (h *UserHandler) DeleteFilial(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageFilials(w, r) {
+		return
+	}
+
+	h.filialsMu.Lock()
+	defer h.filialsMu.Unlock()
+
+	filial, ok := h.loadFilial(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to load users", http.StatusInternalServerError)
+		return
+	}
+	groups, err := h.store.Groups().List()
+	if err != nil {
+		http.Error(w, "Failed to load groups", http.StatusInternalServerError)
+		return
+	}
+	if slices.ContainsFunc(users, func(u models.User) bool { return u.Filial == filial.ID }) ||
+		slices.ContainsFunc(groups, func(g models.Group) bool { return g.Filial == filial.ID }) {
+		http.Error(w, "Filial has users or groups, deactivate it instead", http.StatusConflict)
+		return
+	}
+
+	if err := h.store.Filials().Delete(filial.ID); err != nil {
+		http.Error(w, "Failed to delete filial: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFilialStats возвращает число пользователей по ролям и статусам в каждом филиале
+// (GET /filials/stats). Owner видит все филиалы, admin - только свой.
+func (h *UserHandler) GetFilialStats(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionFilialStats, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	filials, err := h.store.Filials().List()
+	if err != nil {
+		http.Error(w, "Failed to load filials", http.StatusInternalServerError)
+		return
+	}
+	users, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to load users", http.StatusInternalServerError)
+		return
+	}
+
+	// Сначала филиалы справочника в его порядке, затем ID, известные только по пользователям
+	var stats []*dto.FilialStats
+	byID := make(map[string]*dto.FilialStats)
+	add := func(s *dto.FilialStats) *dto.FilialStats {
+		s.ByRole = map[models.UserRole]int{}
+		s.ByStatus = map[models.UserStatus]int{}
+		stats = append(stats, s)
+		byID[s.Filial] = s
+		return s
+	}
+	for _, f := range filials {
+		add(&dto.FilialStats{Filial: f.ID, Name: f.Name, Registered: true, Active: f.Active})
+	}
+	for _, u := range users {
+		s, ok := byID[u.Filial]
+		if !ok {
+			s = add(&dto.FilialStats{Filial: u.Filial})
+		}
+		s.Total++
+		s.ByRole[u.Role]++
+		s.ByStatus[u.Status]++
+	}
+
+	result := []*dto.FilialStats{}
+	for _, s := range stats {
+		if policy.CanInFilial(currentUser, policy.ActionFilialStats, s.Filial) == nil {
+			result = append(result, s)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// TransferUser переводит пользователя в другой филиал (PUT /users/{id}/filial, только owner)
+func (h *UserHandler) TransferUser(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.UserFilialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Filial = strings.TrimSpace(req.Filial)
+
+	// 2. Проверяем права
+	target, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionTransferUser, &target); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if target.Filial == req.Filial {
+		sendUpdatedUserResponse(w, target)
+		return
+	}
+
+	// 3. Проверяем новый филиал и связи пользователя со старым
+	h.enrollMu.Lock()
+	defer h.enrollMu.Unlock()
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	if !h.checkTransfer(w, target, req.Filial) {
+		return
+	}
+
+	// 4. Сохраняем
+	updated := target
+	updated.Filial = req.Filial
+	if !h.saveUser(w, updated) {
+		return
+	}
+	h.auditUserChange(r, currentUser, models.AuditTransferUser, target, updated)
+
+	sendUpdatedUserResponse(w, updated)
+}
+
+// Вспомогательные функции
+
+// canManageFilials проверяет право на изменение справочника; при отказе ответ уже отправлен
+func (h *UserHandler) canManageFilials(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if err := policy.Can(user, policy.ActionManageFilials, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// loadFilial находит филиал из URL; при ошибке ответ уже отправлен
+func (h *UserHandler) loadFilial(w http.ResponseWriter, r *http.Request) (models.Filial, bool) {
+	filial, err := h.store.Filials().Get(chi.URLParam(r, "id"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Filial not found", http.StatusNotFound)
+		return models.Filial{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load filial", http.StatusInternalServerError)
+		return models.Filial{}, false
+	}
+	return filial, true
+}
+
+// checkFilial проверяет, что филиал есть в справочнике и активен,
+// чтобы опечатка в ID не создавала новый филиал. При ошибке ответ уже отправлен.
+func checkFilial(w http.ResponseWriter, repo storage.FilialRepository, id string) bool {
+	filial, err := repo.Get(id)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("Unknown filial %q", id), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load filial", http.StatusInternalServerError)
+		return false
+	}
+	if !filial.Active {
+		http.Error(w, fmt.Sprintf("Filial %s is not active", id), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// checkTransfer проверяет перевод user в филиал filial: филиал должен быть
+// активен, а у пользователя не должно оставаться действующих групп и записей
+// на модули, которые после перевода окажутся в чужом филиале.
+// Вызывается под enrollMu и groupsMu; при ошибке ответ уже отправлен.
+func (h *UserHandler) checkTransfer(w http.ResponseWriter, user models.User, filial string) bool {
+	if !checkFilial(w, h.store.Filials(), filial) {
+		return false
+	}
+
+	groups, err := h.store.Groups().List()
+	if err != nil {
+		http.Error(w, "Failed to load groups", http.StatusInternalServerError)
+		return false
+	}
+	var groupIDs []string
+	for _, g := range groups {
+		member := g.TutorID == user.ID || slices.Contains(g.StudentIDs, user.ID)
+		if member && !g.Archived && g.Filial != filial {
+			groupIDs = append(groupIDs, g.ID)
+		}
+	}
+
+	enrollments, err := h.store.Enrollments().List()
+	if err != nil {
+		http.Error(w, "Failed to load enrollments", http.StatusInternalServerError)
+		return false
+	}
+	var enrollmentIDs []string
+	for _, e := range enrollments {
+		if e.Status != models.EnrollmentActive {
+			continue
+		}
+		var otherID string
+		switch user.ID {
+		case e.StudentID:
+			otherID = e.TutorID
+		case e.TutorID:
+			otherID = e.StudentID
+		default:
+			continue
+		}
+		if other, err := h.authService.UserStorage.GetUserByID(otherID); err != nil || other.Filial != filial {
+			enrollmentIDs = append(enrollmentIDs, e.ID)
+		}
+	}
+
+	if len(groupIDs) > 0 || len(enrollmentIDs) > 0 {
+		http.Error(w, fmt.Sprintf("User is still linked to filial %s, reassign them first: groups %v, enrollments %v",
+			user.Filial, groupIDs, enrollmentIDs), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// nextFilialID возвращает следующий числовой ID после наибольшего числового ID справочника
+func nextFilialID(filials []models.Filial) string {
+	next := 1
+	for _, f := range filials {
+		if n, err := strconv.Atoi(f.ID); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return strconv.Itoa(next)
+}
+
+func applyFilialRequest(filial models.Filial, req dto.FilialRequest) models.Filial {
+	filial.Name = strings.TrimSpace(req.Name)
+	filial.Address = strings.TrimSpace(req.Address)
+	filial.Timezone = strings.TrimSpace(req.Timezone)
+	if req.Active != nil {
+		filial.Active = *req.Active
+	}
+	return filial
+}
+
+func sendFilial(w http.ResponseWriter, status int, filial models.Filial) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(filial)
+}
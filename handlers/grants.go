@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/pkg/utils"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	dayMillis          = int64(24 * time.Hour / time.Millisecond)
+	maxGrantDays       = 5 * 365
+	defaultExpiringDay = 7
+)
+
+var (
+	// errGrantNotFound - у тьютора нет записи о доступе к модулю
+	errGrantNotFound = errors.New("grant not found")
+	// errExpiryNotLater - продление не сдвигает срок вперёд
+	errExpiryNotLater = errors.New("new expiry must be later than the current one")
+	// errGrantTooLong - доступ заканчивается позже, чем через maxGrantDays
+	errGrantTooLong = fmt.Errorf("grant cannot end more than %d days from now", maxGrantDays)
+)
+
+// GrantModule выдаёт тьютору доступ к модулю или задаёт срок заново (POST /tutors/{id}/grants)
+func (h *UserHandler) GrantModule(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.GrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 2. Проверяем тьютора, модуль и срок
+	tutor, ok := h.loadGrantTutor(w, r, currentUser)
+	if !ok {
+		return
+	}
+	module, ok := h.loadGrantableModule(w, req.Module)
+	if !ok {
+		return
+	}
+	until, ok := grantUntil(w, req.Until, req.Days, time.Now().UnixMilli())
+	if !ok {
+		return
+	}
+
+	// 3. Сохраняем доступ и запись в журнале
+	grant, err := h.changeGrant(currentUser, tutor, module.ID, func(prev int64, exists bool) (int64, models.GrantAction, error) {
+		return until, models.GrantGranted, nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to save grant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendGrant(w, http.StatusCreated, tutor, module, grant)
+}
+
+// ExtendGrant продлевает доступ тьютора к модулю (PUT /tutors/{id}/grants/{module})
+func (h *UserHandler) ExtendGrant(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.GrantExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.Until > 0) == (req.Days > 0) {
+		http.Error(w, "Either 'until' or 'days' must be set", http.StatusBadRequest)
+		return
+	}
+
+	tutor, ok := h.loadGrantTutor(w, r, currentUser)
+	if !ok {
+		return
+	}
+	moduleID, err := strconv.Atoi(chi.URLParam(r, "module"))
+	if err != nil {
+		http.Error(w, "Invalid module ID", http.StatusBadRequest)
+		return
+	}
+	module, ok := h.loadGrantableModule(w, moduleID)
+	if !ok {
+		return
+	}
+
+	// Новый срок считается от текущего, а для истёкшего доступа - от текущего момента;
+	// в любом случае он не дальше maxGrantDays от сегодняшнего дня
+	grant, err := h.changeGrant(currentUser, tutor, module.ID, func(prev int64, exists bool) (int64, models.GrantAction, error) {
+		if !exists {
+			return 0, "", errGrantNotFound
+		}
+		now := time.Now().UnixMilli()
+		base, limit := max(prev, now), now+maxGrantDays*dayMillis
+		until := req.Until
+		if req.Days > 0 {
+			until = min(base+int64(min(req.Days, maxGrantDays))*dayMillis, limit)
+		}
+		if until > limit {
+			return 0, "", errGrantTooLong
+		}
+		if until <= base {
+			return 0, "", errExpiryNotLater
+		}
+		return until, models.GrantExtended, nil
+	})
+	if errors.Is(err, errGrantNotFound) {
+		http.Error(w, "Tutor has no access to this module", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errExpiryNotLater) || errors.Is(err, errGrantTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to extend grant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendGrant(w, http.StatusOK, tutor, module, grant)
+}
+
+// RevokeGrant отзывает доступ тьютора к модулю (DELETE /tutors/{id}/grants/{module})
+func (h *UserHandler) RevokeGrant(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tutor, ok := h.loadGrantTutor(w, r, currentUser)
+	if !ok {
+		return
+	}
+	moduleID, err := strconv.Atoi(chi.URLParam(r, "module"))
+	if err != nil {
+		http.Error(w, "Invalid module ID", http.StatusBadRequest)
+		return
+	}
+
+	// Отозвать можно и доступ к архивному модулю
+	_, err = h.changeGrant(currentUser, tutor, moduleID, func(prev int64, exists bool) (int64, models.GrantAction, error) {
+		if !exists {
+			return 0, "", errGrantNotFound
+		}
+		return 0, models.GrantRevoked, nil
+	})
+	if errors.Is(err, errGrantNotFound) {
+		http.Error(w, "Tutor has no access to this module", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke grant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GrantModuleToFilial выдаёт модуль всем активным тьюторам филиала (POST /modules/{id}/grants)
+func (h *UserHandler) GrantModuleToFilial(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !policy.Allowed(currentUser.Role, policy.ActionGrantModules) {
+		http.Error(w, "Forbidden: action is not allowed for your role", http.StatusForbidden)
+		return
+	}
+
+	var req dto.FilialGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Filial == "" {
+		http.Error(w, "Filial is required", http.StatusBadRequest)
+		return
+	}
+
+	// 2. Проверяем модуль и срок
+	module, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+	if module.Archived {
+		http.Error(w, "Module is archived", http.StatusConflict)
+		return
+	}
+	until, ok := grantUntil(w, req.Until, req.Days, time.Now().UnixMilli())
+	if !ok {
+		return
+	}
+
+	// 3. Отбираем активных тьюторов филиала, доступных актору
+	allUsers, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+	var tutors []models.User
+	for _, u := range policy.Filter(currentUser, policy.ActionGrantModules, allUsers) {
+		if u.Filial == req.Filial && u.Status == models.StatusActive {
+			tutors = append(tutors, u)
+		}
+	}
+	if len(tutors) == 0 {
+		http.Error(w, "No active tutors in this filial are available to you", http.StatusNotFound)
+		return
+	}
+
+	// 4. Выдаём доступ каждому. Более длинный срок, в том числе бессрочный,
+	// не укорачивается. Ошибка у одного тьютора не прерывает выдачу
+	// остальным: итог по каждому возвращается в ответе.
+	results := make([]dto.FilialGrantResult, 0, len(tutors))
+	status := http.StatusCreated
+	for _, tutor := range tutors {
+		changed := false
+		grant, err := h.changeGrant(currentUser, tutor, module.ID, func(prev int64, exists bool) (int64, models.GrantAction, error) {
+			switch {
+			case !exists:
+				changed = true
+				return until, models.GrantGranted, nil
+			case prev < until:
+				changed = true
+				return until, models.GrantExtended, nil
+			default:
+				return prev, "", nil
+			}
+		})
+		result := dto.FilialGrantResult{GrantResponse: toGrantResponse(tutor, module, grant), Changed: changed}
+		if err != nil {
+			log.Printf("failed to grant module %d to tutor %s: %v", module.ID, tutor.ID, err)
+			result.Until, result.Changed, result.Error = 0, false, "failed to save grant"
+			status = http.StatusMultiStatus
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
+
+// GetExpiringGrants возвращает доступы, истекающие в ближайшие days дней (GET /grants/expiring?days=7)
+func (h *UserHandler) GetExpiringGrants(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !policy.Allowed(currentUser.Role, policy.ActionGrantModules) {
+		http.Error(w, "Forbidden: action is not allowed for your role", http.StatusForbidden)
+		return
+	}
+
+	days := defaultExpiringDay
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			http.Error(w, "Invalid 'days', must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	now := time.Now().UnixMilli()
+	deadline := now + int64(days)*dayMillis
+
+	allUsers, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+	tutors := policy.Filter(currentUser, policy.ActionGrantModules, allUsers)
+
+	modules, err := h.store.Modules().List()
+	if err != nil {
+		http.Error(w, "Failed to load module data", http.StatusInternalServerError)
+		return
+	}
+	moduleNames := make(map[int]string, len(modules))
+	for _, m := range modules {
+		moduleNames[m.ID] = m.Name
+	}
+
+	result := []dto.GrantResponse{}
+	for _, tutor := range tutors {
+		data, err := h.store.UserData().Get(tutor.Role, tutor.ID)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Failed to load user data", http.StatusInternalServerError)
+			return
+		}
+		for _, info := range data.Modules {
+			if info.Date > now && info.Date <= deadline {
+				result = append(result, dto.GrantResponse{
+					TutorID:    tutor.ID,
+					TutorName:  tutor.Name,
+					Filial:     tutor.Filial,
+					Module:     info.Module,
+					ModuleName: moduleNames[info.Module],
+					Until:      info.Date,
+				})
+			}
+		}
+	}
+	slices.SortFunc(result, func(a, b dto.GrantResponse) int { return cmp.Compare(a.Until, b.Until) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetGrantAudit возвращает журнал выдачи доступа (GET /grants/audit?tutor=ID&module=N).
+// Admin видит только записи о тьюторах своего филиала.
+func (h *UserHandler) GetGrantAudit(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !policy.Allowed(currentUser.Role, policy.ActionGrantModules) {
+		http.Error(w, "Forbidden: action is not allowed for your role", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	tutorID := query.Get("tutor")
+	moduleID := 0
+	if v := query.Get("module"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid module ID", http.StatusBadRequest)
+			return
+		}
+		moduleID = n
+	}
+
+	events, err := h.store.GrantAudit().List()
+	if err != nil {
+		http.Error(w, "Failed to load grant audit", http.StatusInternalServerError)
+		return
+	}
+
+	// Права проверяются по тьютору. Записи о безвозвратно удалённых тьюторах
+	// видит только тот, чьё правило не ограничено филиалом.
+	allUsers, err := h.authService.UserStorage.GetAllUsers()
+	if err != nil {
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+	visible := make(map[string]bool)
+	for _, u := range policy.Filter(currentUser, policy.ActionGrantModules, allUsers) {
+		visible[u.ID] = true
+	}
+	seeAll := policy.Can(currentUser, policy.ActionGrantModules, &models.User{Role: models.RoleTutor}) == nil
+
+	result := []models.GrantEvent{}
+	for _, e := range events {
+		if tutorID != "" && e.TutorID != tutorID {
+			continue
+		}
+		if moduleID != 0 && e.Module != moduleID {
+			continue
+		}
+		if !visible[e.TutorID] && !seeAll {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Вспомогательные функции
+
+// grantChange вычисляет новый срок доступа по старому; until == 0 отзывает доступ,
+// пустое action оставляет доступ как есть
+type grantChange func(prev int64, exists bool) (until int64, action models.GrantAction, err error)
+
+// changeGrant меняет доступ тьютора к модулю и записывает изменение в журнал
+func (h *UserHandler) changeGrant(actor, tutor models.User, moduleID int, change grantChange) (models.ModuleInfo, error) {
+	h.grantsMu.Lock()
+	defer h.grantsMu.Unlock()
+
+	data, err := h.store.UserData().Get(tutor.Role, tutor.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		data = models.UserData{ID: tutor.ID, Links: []models.Link{}}
+	} else if err != nil {
+		return models.ModuleInfo{}, err
+	}
+
+	i := slices.IndexFunc(data.Modules, func(m models.ModuleInfo) bool { return m.Module == moduleID })
+	var prev int64
+	if i >= 0 {
+		prev = data.Modules[i].Date
+	}
+
+	until, action, err := change(prev, i >= 0)
+	if err != nil {
+		return models.ModuleInfo{}, err
+	}
+	if action == "" {
+		return models.ModuleInfo{Module: moduleID, Date: prev}, nil
+	}
+
+	grant := models.ModuleInfo{Module: moduleID, Date: until}
+	modules := slices.Clone(data.Modules)
+	switch {
+	case action == models.GrantRevoked:
+		modules = slices.Delete(modules, i, i+1)
+	case i >= 0:
+		modules[i] = grant
+	default:
+		modules = append(modules, grant)
+	}
+	data.Modules = modules
+
+	if err := h.store.UserData().Upsert(tutor.Role, data); err != nil {
+		return models.ModuleInfo{}, err
+	}
+
+	// Журнал не должен мешать выдаче доступа, но потеря записи видна в логе
+	id, err := utils.NewID()
+	if err == nil {
+		err = h.store.GrantAudit().Append(models.GrantEvent{
+			ID:         id,
+			At:         time.Now().UnixMilli(),
+			ActorID:    actor.ID,
+			ActorLogin: actor.Login,
+			TutorID:    tutor.ID,
+			Module:     moduleID,
+			Action:     action,
+			Until:      until,
+			PrevUntil:  prev,
+		})
+	}
+	if err != nil {
+		log.Printf("failed to record grant audit for tutor %s module %d: %v", tutor.ID, moduleID, err)
+	}
+
+	return grant, nil
+}
+
+// loadGrantTutor находит тьютора из URL и проверяет права; при ошибке ответ уже отправлен
+func (h *UserHandler) loadGrantTutor(w http.ResponseWriter, r *http.Request, currentUser models.User) (models.User, bool) {
+	tutor, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return models.User{}, false
+	}
+
+	if err := policy.Can(currentUser, policy.ActionGrantModules, &tutor); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return models.User{}, false
+	}
+	return tutor, true
+}
+
+// loadGrantableModule находит модуль, доступ к которому можно выдать; при ошибке ответ уже отправлен
+func (h *UserHandler) loadGrantableModule(w http.ResponseWriter, moduleID int) (models.Module, bool) {
+	module, err := h.store.Modules().Get(moduleID)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Module not found", http.StatusNotFound)
+		return models.Module{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load module data", http.StatusInternalServerError)
+		return models.Module{}, false
+	}
+	if module.Archived {
+		http.Error(w, "Module is archived", http.StatusConflict)
+		return models.Module{}, false
+	}
+	return module, true
+}
+
+// grantUntil вычисляет срок доступа из until или days; при ошибке ответ уже отправлен
+func grantUntil(w http.ResponseWriter, until int64, days int, now int64) (int64, bool) {
+	switch {
+	case (until > 0) == (days > 0):
+		http.Error(w, "Either 'until' or 'days' must be set", http.StatusBadRequest)
+		return 0, false
+	case days > maxGrantDays:
+		http.Error(w, "Grant cannot be longer than "+strconv.Itoa(maxGrantDays)+" days", http.StatusBadRequest)
+		return 0, false
+	case days > 0:
+		return now + int64(days)*dayMillis, true
+	case until <= now:
+		http.Error(w, "'until' must be in the future", http.StatusBadRequest)
+		return 0, false
+	case until > now+maxGrantDays*dayMillis:
+		http.Error(w, "Grant cannot be longer than "+strconv.Itoa(maxGrantDays)+" days", http.StatusBadRequest)
+		return 0, false
+	default:
+		return until, true
+	}
+}
+
+func toGrantResponse(tutor models.User, module models.Module, grant models.ModuleInfo) dto.GrantResponse {
+	return dto.GrantResponse{
+		TutorID:    tutor.ID,
+		TutorName:  tutor.Name,
+		Filial:     tutor.Filial,
+		Module:     module.ID,
+		ModuleName: module.Name,
+		Until:      grant.Date,
+	}
+}
+
+func sendGrant(w http.ResponseWriter, status int, tutor models.User, module models.Module, grant models.ModuleInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(toGrantResponse(tutor, module, grant))
+}
@@ -0,0 +1,533 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/pkg/utils"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxClassRangeDays - наибольший период, за который отдаётся список занятий
+const maxClassRangeDays = 366
+
+// CreateGroup создаёт учебную группу (POST /groups)
+func (h *UserHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Filial == "" {
+		req.Filial = currentUser.Filial
+	}
+
+	// 2. Проверяем права на филиал группы
+	if err := policy.CanInFilial(currentUser, policy.ActionManageGroups, req.Filial); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 3. Проверяем группу и её состав
+	id, err := utils.NewID()
+	if err != nil {
+		http.Error(w, "Failed to generate group ID", http.StatusInternalServerError)
+		return
+	}
+	group := applyGroupRequest(models.Group{ID: id}, req)
+	if !h.checkGroup(w, group) {
+		return
+	}
+
+	// 4. Сохраняем
+	if err := h.store.Groups().Create(group); err != nil {
+		http.Error(w, "Failed to save group: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendGroup(w, http.StatusCreated, group)
+}
+
+// ListGroups возвращает доступные пользователю группы (GET /groups?module=N&tutor=ID&archived=true)
+func (h *UserHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groups, err := h.store.Groups().List()
+	if err != nil {
+		http.Error(w, "Failed to load groups", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	withArchived := query.Get("archived") == "true"
+	result := []models.Group{}
+	for _, g := range groups {
+		switch {
+		case g.Archived && !withArchived,
+			query.Get("tutor") != "" && g.TutorID != query.Get("tutor"),
+			query.Get("module") != "" && fmt.Sprint(g.Module) != query.Get("module"),
+			policy.CanAccessGroup(currentUser, policy.ActionViewGroup, g) != nil:
+			continue
+		}
+		result = append(result, g)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetGroup возвращает группу с расписанием (GET /groups/{id})
+func (h *UserHandler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r, currentUser, policy.ActionViewGroup)
+	if !ok {
+		return
+	}
+
+	sendGroup(w, http.StatusOK, group)
+}
+
+// UpdateGroup заменяет название, состав, расписание и даты группы (PUT /groups/{id})
+func (h *UserHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	group, ok := h.loadGroup(w, r, currentUser, policy.ActionManageGroups)
+	if !ok {
+		return
+	}
+
+	// Перенести группу можно только в филиал, которым актор тоже управляет
+	if req.Filial == "" {
+		req.Filial = group.Filial
+	}
+	if err := policy.CanInFilial(currentUser, policy.ActionManageGroups, req.Filial); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	group = applyGroupRequest(group, req)
+	if !h.checkGroup(w, group) {
+		return
+	}
+
+	if err := h.store.Groups().Update(group); err != nil {
+		http.Error(w, "Failed to save group: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendGroup(w, http.StatusOK, group)
+}
+
+// ArchiveGroup переводит группу в архив; посещаемость сохраняется (DELETE /groups/{id})
+func (h *UserHandler) ArchiveGroup(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	group, ok := h.loadGroup(w, r, currentUser, policy.ActionManageGroups)
+	if !ok {
+		return
+	}
+
+	group.Archived = true
+	if err := h.store.Groups().Update(group); err != nil {
+		http.Error(w, "Failed to save group: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGroupClasses возвращает занятия группы по расписанию с отметками о посещении
+// (GET /groups/{id}/classes?from=YYYY-MM-DD&to=YYYY-MM-DD, по умолчанию - текущая неделя)
+func (h *UserHandler) GetGroupClasses(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем доступ к группе
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	group, ok := h.loadGroup(w, r, currentUser, policy.ActionViewGroup)
+	if !ok {
+		return
+	}
+
+	// 2. Определяем период по местному времени филиала группы
+	loc := h.groupLocation(group)
+	today := dateOf(time.Now(), loc)
+	monday := today.AddDate(0, 0, 1-isoWeekday(today))
+	from, ok := queryDate(w, r, "from", monday, loc)
+	if !ok {
+		return
+	}
+	to, ok := queryDate(w, r, "to", monday.AddDate(0, 0, 6), loc)
+	if !ok {
+		return
+	}
+	if to.Before(from) || to.Sub(from) > maxClassRangeDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("Period must be from 1 to %d days", maxClassRangeDays), http.StatusBadRequest)
+		return
+	}
+
+	// 3. Собираем отметки; ученик видит только свои
+	records, err := h.store.Attendance().List()
+	if err != nil {
+		http.Error(w, "Failed to load attendance", http.StatusInternalServerError)
+		return
+	}
+	ownOnly := policy.CanAccessGroup(currentUser, policy.ActionMarkAttendance, group) != nil
+
+	classes := groupClasses(group, from, to, loc)
+	for i := range classes {
+		for _, rec := range records {
+			if rec.GroupID != group.ID || rec.Date != classes[i].Date || rec.Start != classes[i].Start {
+				continue
+			}
+			if ownOnly && rec.StudentID != currentUser.ID {
+				continue
+			}
+			classes[i].Marks = append(classes[i].Marks, rec)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(classes)
+}
+
+// MarkAttendance отмечает посещение занятия группы (PUT /groups/{id}/attendance).
+// Отмечать могут тьютор группы, helper и admin её филиала; повторная отметка заменяет прежнюю.
+func (h *UserHandler) MarkAttendance(w http.ResponseWriter, r *http.Request) {
+	// 1. Разбираем запрос
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.AttendanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Marks) == 0 {
+		http.Error(w, "Marks are required", http.StatusBadRequest)
+		return
+	}
+
+	// 2. Проверяем группу и занятие
+	group, ok := h.loadGroup(w, r, currentUser, policy.ActionMarkAttendance)
+	if !ok {
+		return
+	}
+	if group.Archived {
+		http.Error(w, "Group is archived", http.StatusConflict)
+		return
+	}
+
+	loc := h.groupLocation(group)
+	date, err := time.ParseInLocation(models.DateLayout, req.Date, loc)
+	if err != nil {
+		http.Error(w, "Date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if date.After(dateOf(time.Now(), loc)) {
+		http.Error(w, "Cannot mark attendance for a future class", http.StatusBadRequest)
+		return
+	}
+	if !slices.ContainsFunc(groupClasses(group, date, date, loc), func(c dto.ClassResponse) bool { return c.Start == req.Start }) {
+		http.Error(w, "No class is scheduled for this group at this date and time", http.StatusBadRequest)
+		return
+	}
+
+	// 3. Проверяем отметки
+	now := time.Now().UnixMilli()
+	records := make([]models.Attendance, 0, len(req.Marks))
+	for _, mark := range req.Marks {
+		if !slices.Contains(group.StudentIDs, mark.StudentID) {
+			http.Error(w, fmt.Sprintf("Student %s is not in this group", mark.StudentID), http.StatusBadRequest)
+			return
+		}
+		if !models.IsValidAttendanceStatus(mark.Status) {
+			http.Error(w, "Invalid attendance status", http.StatusBadRequest)
+			return
+		}
+		records = append(records, models.Attendance{
+			GroupID:   group.ID,
+			Date:      req.Date,
+			Start:     req.Start,
+			StudentID: mark.StudentID,
+			Status:    mark.Status,
+			MarkedBy:  currentUser.ID,
+			MarkedAt:  now,
+		})
+	}
+
+	// 4. Сохраняем
+	if err := h.store.Attendance().Mark(records); err != nil {
+		http.Error(w, "Failed to save attendance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// GetStudentAttendance возвращает историю посещений ученика (GET /users/{id}/attendance).
+// Тьютор видит только занятия своих групп.
+func (h *UserHandler) GetStudentAttendance(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	student, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	groups, err := h.store.Groups().List()
+	if err != nil {
+		http.Error(w, "Failed to load groups", http.StatusInternalServerError)
+		return
+	}
+
+	// Группы, отметки которых видит актор: все - для самого ученика и ролей из таблицы,
+	// только свои - для тьютора
+	visible := make(map[string]bool)
+	switch {
+	case currentUser.ID == student.ID || policy.Can(currentUser, policy.ActionViewAttendance, &student) == nil:
+		for _, g := range groups {
+			visible[g.ID] = true
+		}
+	case currentUser.Role == models.RoleTutor:
+		for _, g := range groups {
+			visible[g.ID] = policy.CanAccessGroup(currentUser, policy.ActionMarkAttendance, g) == nil
+		}
+	default:
+		http.Error(w, "Forbidden: cannot view attendance of this user", http.StatusForbidden)
+		return
+	}
+
+	records, err := h.store.Attendance().List()
+	if err != nil {
+		http.Error(w, "Failed to load attendance", http.StatusInternalServerError)
+		return
+	}
+
+	result := []models.Attendance{}
+	for _, rec := range records {
+		if rec.StudentID == student.ID && visible[rec.GroupID] {
+			result = append(result, rec)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b models.Attendance) int {
+		return strings.Compare(a.Date+a.Start, b.Date+b.Start)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Вспомогательные функции
+
+// loadGroup находит группу из URL и проверяет право action; при ошибке ответ уже отправлен
+func (h *UserHandler) loadGroup(w http.ResponseWriter, r *http.Request, currentUser models.User, action policy.Action) (models.Group, bool) {
+	group, err := h.store.Groups().Get(chi.URLParam(r, "id"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return models.Group{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load group", http.StatusInternalServerError)
+		return models.Group{}, false
+	}
+
+	if err := policy.CanAccessGroup(currentUser, action, group); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return models.Group{}, false
+	}
+	return group, true
+}
+
+// checkGroup проверяет расписание, модуль, тьютора и учеников группы:
+// все участники должны быть активны и из филиала группы, а у тьютора -
+// действующий доступ к модулю. При ошибке ответ уже отправлен.
+func (h *UserHandler) checkGroup(w http.ResponseWriter, group models.Group) bool {
+	if err := models.ValidateGroup(group); err != nil {
+		http.Error(w, "Invalid group: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	if !checkFilial(w, h.store.Filials(), group.Filial) {
+		return false
+	}
+
+	if _, ok := h.loadGrantableModule(w, group.Module); !ok {
+		return false
+	}
+
+	if !h.checkTutor(w, group.TutorID, group.Filial, group.Module) {
+		return false
+	}
+
+	for _, id := range group.StudentIDs {
+		student, err := h.authService.UserStorage.GetUserByID(id)
+		if err != nil || student.Role != models.RoleUser {
+			http.Error(w, fmt.Sprintf("Student %s not found", id), http.StatusBadRequest)
+			return false
+		}
+		if student.Status != models.StatusActive || student.Filial != group.Filial {
+			http.Error(w, fmt.Sprintf("Student %s must be active and in filial %s", id, group.Filial), http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+func applyGroupRequest(group models.Group, req dto.GroupRequest) models.Group {
+	group.Name = strings.TrimSpace(req.Name)
+	group.Filial = req.Filial
+	group.Module = req.Module
+	group.TutorID = req.TutorID
+	group.Schedule = req.Schedule
+	group.StartsOn = req.StartsOn
+	group.EndsOn = req.EndsOn
+
+	// Порядок учеников сохраняется, повторы отбрасываются
+	group.StudentIDs = []string{}
+	for _, id := range req.StudentIDs {
+		if !slices.Contains(group.StudentIDs, id) {
+			group.StudentIDs = append(group.StudentIDs, id)
+		}
+	}
+	return group
+}
+
+func sendGroup(w http.ResponseWriter, status int, group models.Group) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(group)
+}
+
+// groupLocation возвращает часовой пояс филиала группы; без пояса или при
+// ошибке - время сервера
+func (h *UserHandler) groupLocation(group models.Group) *time.Location {
+	filial, err := h.store.Filials().Get(group.Filial)
+	if err != nil || filial.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(filial.Timezone)
+	if err != nil {
+		log.Printf("filial %s has unknown timezone %q: %v", filial.ID, filial.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// groupClasses разворачивает еженедельное расписание группы в занятия с from
+// по to включительно; даты считаются в часовом поясе loc
+func groupClasses(group models.Group, from, to time.Time, loc *time.Location) []dto.ClassResponse {
+	startsOn, err := time.ParseInLocation(models.DateLayout, group.StartsOn, loc)
+	if err != nil {
+		return nil
+	}
+	if from.Before(startsOn) {
+		from = startsOn
+	}
+	if group.EndsOn != "" {
+		if endsOn, err := time.ParseInLocation(models.DateLayout, group.EndsOn, loc); err == nil && to.After(endsOn) {
+			to = endsOn
+		}
+	}
+
+	slots := slices.Clone(group.Schedule)
+	slices.SortFunc(slots, func(a, b models.ScheduleSlot) int { return strings.Compare(a.Start, b.Start) })
+
+	classes := []dto.ClassResponse{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, slot := range slots {
+			if slot.Weekday == isoWeekday(day) {
+				classes = append(classes, dto.ClassResponse{
+					Date:     day.Format(models.DateLayout),
+					Start:    slot.Start,
+					Duration: slot.Duration,
+					Marks:    []models.Attendance{},
+				})
+			}
+		}
+	}
+	return classes
+}
+
+// isoWeekday возвращает день недели от 1 (понедельник) до 7 (воскресенье)
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+// dateOf возвращает начало дня t в часовом поясе loc
+func dateOf(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// queryDate читает дату YYYY-MM-DD из параметра запроса; при ошибке ответ уже отправлен
+func queryDate(w http.ResponseWriter, r *http.Request, name string, def time.Time, loc *time.Location) (time.Time, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	date, err := time.ParseInLocation(models.DateLayout, value, loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid '%s', must be YYYY-MM-DD", name), http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return date, true
+}
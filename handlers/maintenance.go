@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Maintenance останавливает изменения данных на время резервного копирования
+// и восстановления. Каждый изменяющий запрос держит разделяемую блокировку,
+// копирование и восстановление берут исключительную.
+type Maintenance struct {
+	mu sync.RWMutex
+}
+
+// Middleware держит разделяемую блокировку до конца запроса, если метод может
+// менять данные: вход, регистрация, смена пароля, 2FA и сессии тоже пишут в
+// хранилище. Чтение не ждёт копирования. Ставится первым, чтобы после
+// восстановления запрос проверялся уже по новым данным.
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			m.mu.RLock()
+			defer m.mu.RUnlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Lock дожидается завершения изменяющих запросов и не пускает новые до
+// вызова unlock. Нельзя вызывать из запроса, прошедшего через Middleware.
+func (m *Maintenance) Lock() (unlock func()) {
+	m.mu.Lock()
+	return m.mu.Unlock
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"mime/multipart"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"myapp/pkg/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxFileTitleLength = 200
+	multipartMemory    = 8 << 20 // остальное multipart держит во временных файлах
+)
+
+// errNotPDF - загруженный файл не является PDF
+var errNotPDF = errors.New("file is not a PDF document")
+
+// UploadModuleFile загружает PDF урока в модуль (POST /modules/{id}/files, только owner).
+// Поля формы: file - PDF, title - название, position - место в списке с 1 (по умолчанию в конец).
+func (h *UserHandler) UploadModuleFile(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем права и модуль
+	if !h.canManageFiles(w, r) {
+		return
+	}
+	module, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+
+	// 2. Разбираем форму с ограничением размера
+	if !h.parseUploadForm(w, r) {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" || utf8.RuneCountInString(title) > maxFileTitleLength {
+		http.Error(w, fmt.Sprintf("Title is required and must be at most %d characters", maxFileTitleLength), http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing 'file' in form", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	h.filesMu.Lock()
+	defer h.filesMu.Unlock()
+
+	files, err := h.store.ModuleFiles().GetByModule(module.ID)
+	if err != nil {
+		http.Error(w, "Failed to load module files", http.StatusInternalServerError)
+		return
+	}
+
+	position, ok := formPosition(w, r, len(files)+1, len(files)+1)
+	if !ok {
+		return
+	}
+
+	// 3. Сохраняем файл на диск под новым именем
+	fileName, err := utils.NewID()
+	if err != nil {
+		http.Error(w, "Failed to generate file name", http.StatusInternalServerError)
+		return
+	}
+	if !h.writeLessonFile(w, fileName, file, header) {
+		return
+	}
+
+	// 4. Добавляем файл в индекс; без записи в индексе файл на диске не нужен
+	files = slices.Insert(files, position-1, models.FileItem{Title: title, FileName: fileName})
+	if err := h.store.ModuleFiles().SetModuleFiles(module.ID, files); err != nil {
+		os.Remove(h.lessonFilePath(fileName))
+		http.Error(w, "Failed to save module files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(files)
+}
+
+// ReplaceModuleFile меняет содержимое, название или место файла урока
+// (PUT /modules/{id}/files/{filename}, только owner). Все поля формы необязательны.
+func (h *UserHandler) ReplaceModuleFile(w http.ResponseWriter, r *http.Request) {
+	// 1. Проверяем права и модуль
+	if !h.canManageFiles(w, r) {
+		return
+	}
+	module, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+
+	// 2. Разбираем форму с ограничением размера
+	if !h.parseUploadForm(w, r) {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	h.filesMu.Lock()
+	defer h.filesMu.Unlock()
+
+	files, index, ok := h.findModuleFile(w, r, module.ID)
+	if !ok {
+		return
+	}
+	item := files[index]
+
+	if title, set := r.MultipartForm.Value["title"]; set {
+		item.Title = strings.TrimSpace(strings.Join(title, ""))
+		if item.Title == "" || utf8.RuneCountInString(item.Title) > maxFileTitleLength {
+			http.Error(w, fmt.Sprintf("Title must be non-empty and at most %d characters", maxFileTitleLength), http.StatusBadRequest)
+			return
+		}
+	}
+
+	position, ok := formPosition(w, r, index+1, len(files))
+	if !ok {
+		return
+	}
+
+	// 3. Новое содержимое атомарно заменяет старое под тем же именем
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if !h.writeLessonFile(w, item.FileName, file, header) {
+			return
+		}
+		h.dropWatermarks(item.FileName)
+	} else if !errors.Is(err, http.ErrMissingFile) {
+		http.Error(w, "Invalid 'file' in form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 4. Обновляем индекс
+	files = slices.Delete(files, index, index+1)
+	files = slices.Insert(files, position-1, item)
+	if err := h.store.ModuleFiles().SetModuleFiles(module.ID, files); err != nil {
+		http.Error(w, "Failed to save module files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// DeleteModuleFile убирает файл из модуля и удаляет его с диска
+// (DELETE /modules/{id}/files/{filename}, только owner)
+func (h *UserHandler) DeleteModuleFile(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageFiles(w, r) {
+		return
+	}
+	module, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+
+	h.filesMu.Lock()
+	defer h.filesMu.Unlock()
+
+	files, index, ok := h.findModuleFile(w, r, module.ID)
+	if !ok {
+		return
+	}
+	fileName := files[index].FileName
+
+	// Сначала индекс: файл без записи станет сиротой, запись без файла - битой ссылкой
+	files = slices.Delete(files, index, index+1)
+	if err := h.store.ModuleFiles().SetModuleFiles(module.ID, files); err != nil {
+		http.Error(w, "Failed to save module files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Старые данные могли ссылаться на один файл из нескольких модулей
+	report, err := h.fileReport()
+	if err == nil && !slices.Contains(report.referenced, fileName) {
+		if err := os.Remove(h.lessonFilePath(fileName)); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove lesson file %s: %v", fileName, err)
+		}
+		h.dropWatermarks(fileName)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFileReport сверяет индекс файлов с диском (GET /admin/files/orphans, только owner):
+// orphaned - PDF на диске, на которые не ссылается ни один модуль,
+// missing - записи индекса, для которых нет файла.
+func (h *UserHandler) GetFileReport(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageFiles(w, r) {
+		return
+	}
+
+	h.filesMu.Lock()
+	report, err := h.fileReport()
+	h.filesMu.Unlock()
+	if err != nil {
+		http.Error(w, "Failed to check lesson files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Вспомогательные функции
+
+type missingFile struct {
+	Module   int    `json:"module"`
+	Title    string `json:"title"`
+	FileName string `json:"fileName"`
+}
+
+type fileReport struct {
+	Orphaned   []string      `json:"orphaned"`
+	Missing    []missingFile `json:"missing"`
+	referenced []string
+}
+
+// fileReport сравнивает modules-files с содержимым каталога файлов. Вызывается под h.filesMu.
+func (h *UserHandler) fileReport() (fileReport, error) {
+	report := fileReport{Orphaned: []string{}, Missing: []missingFile{}}
+
+	groups, err := h.store.ModuleFiles().List()
+	if err != nil {
+		return report, err
+	}
+
+	entries, err := os.ReadDir(h.cfg.Storage.FilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	onDisk := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		// Скрытые файлы - незавершённые загрузки
+		if entry.Type().IsRegular() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".pdf") {
+			onDisk[strings.TrimSuffix(name, ".pdf")] = true
+		}
+	}
+
+	for _, group := range groups {
+		for _, f := range group.Files {
+			report.referenced = append(report.referenced, f.FileName)
+			if !onDisk[f.FileName] {
+				report.Missing = append(report.Missing, missingFile{Module: group.ID, Title: f.Title, FileName: f.FileName})
+			}
+		}
+	}
+
+	for name := range onDisk {
+		if !slices.Contains(report.referenced, name) {
+			report.Orphaned = append(report.Orphaned, name)
+		}
+	}
+	slices.Sort(report.Orphaned)
+
+	return report, nil
+}
+
+// canManageFiles проверяет право на изменение файлов уроков; при отказе ответ уже отправлен
+func (h *UserHandler) canManageFiles(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if err := policy.Can(user, policy.ActionManageFiles, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// parseUploadForm разбирает multipart-форму не больше лимита; при ошибке ответ уже отправлен
+func (h *UserHandler) parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+	// Запас на поля формы и границы multipart
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadBytes()+1<<20)
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("File is larger than %d MB", h.cfg.Storage.MaxUploadMB), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Invalid multipart form: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func (h *UserHandler) maxUploadBytes() int64 {
+	return int64(h.cfg.Storage.MaxUploadMB) << 20
+}
+
+// findModuleFile находит файл из URL в списке модуля; при ошибке ответ уже отправлен
+func (h *UserHandler) findModuleFile(w http.ResponseWriter, r *http.Request, moduleID int) ([]models.FileItem, int, bool) {
+	files, err := h.store.ModuleFiles().GetByModule(moduleID)
+	if err != nil {
+		http.Error(w, "Failed to load module files", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+
+	fileName := chi.URLParam(r, "filename")
+	index := slices.IndexFunc(files, func(f models.FileItem) bool { return f.FileName == fileName })
+	if index < 0 {
+		http.Error(w, "File not found in module", http.StatusNotFound)
+		return nil, 0, false
+	}
+	return files, index, true
+}
+
+// writeLessonFile проверяет размер и тип загруженного файла и атомарно
+// записывает его как <fileName>.pdf; при ошибке ответ уже отправлен
+func (h *UserHandler) writeLessonFile(w http.ResponseWriter, fileName string, file multipart.File, header *multipart.FileHeader) bool {
+	if header.Size > h.maxUploadBytes() {
+		http.Error(w, fmt.Sprintf("File is larger than %d MB", h.cfg.Storage.MaxUploadMB), http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	// Тип определяем по содержимому, а не по имени или заголовку клиента
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		http.Error(w, "Failed to read uploaded file", http.StatusBadRequest)
+		return false
+	}
+	if http.DetectContentType(head[:n]) != "application/pdf" {
+		http.Error(w, errNotPDF.Error(), http.StatusUnsupportedMediaType)
+		return false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+		return false
+	}
+
+	if err := os.MkdirAll(h.cfg.Storage.FilesDir, 0755); err != nil {
+		http.Error(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if _, err := storage.WriteReaderAtomic(h.lessonFilePath(fileName), file, 0644); err != nil {
+		http.Error(w, "Failed to save file: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (h *UserHandler) lessonFilePath(fileName string) string {
+	return filepath.Join(h.cfg.Storage.FilesDir, fileName+".pdf")
+}
+
+// formPosition читает необязательное поле position (с 1); при ошибке ответ уже отправлен
+func formPosition(w http.ResponseWriter, r *http.Request, def, last int) (int, bool) {
+	value := strings.TrimSpace(r.FormValue("position"))
+	if value == "" {
+		return def, true
+	}
+
+	position, err := strconv.Atoi(value)
+	if err != nil || position < 1 || position > last {
+		http.Error(w, fmt.Sprintf("Position must be between 1 and %d", last), http.StatusBadRequest)
+		return 0, false
+	}
+	return position, true
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CreateModule добавляет модуль в конец каталога (POST /modules, только owner)
+func (h *UserHandler) CreateModule(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageModules(w, r) {
+		return
+	}
+
+	var req dto.ModuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	module := applyModuleRequest(models.Module{}, req)
+	if err := models.ValidateModule(module); err != nil {
+		http.Error(w, "Invalid module: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.store.Modules().Create(module)
+	if err != nil {
+		http.Error(w, "Failed to save module: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// UpdateModule изменяет описание модуля (PUT /modules/{id}, только owner).
+// Клиент передаёт прочитанную версию; если модуль успели изменить, ответ 409.
+func (h *UserHandler) UpdateModule(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageModules(w, r) {
+		return
+	}
+
+	var req dto.ModuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+
+	module := applyModuleRequest(current, req)
+	module.Version = req.Version
+	if err := models.ValidateModule(module); err != nil {
+		http.Error(w, "Invalid module: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.saveModule(w, module)
+}
+
+// SetModuleArchived переносит модуль в архив или возвращает из него (PUT /modules/{id}/archive, только owner)
+func (h *UserHandler) SetModuleArchived(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageModules(w, r) {
+		return
+	}
+
+	var req dto.ModuleArchiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	module, ok := h.loadModule(w, r)
+	if !ok {
+		return
+	}
+
+	module.Archived = req.Archived
+	module.Version = req.Version
+	h.saveModule(w, module)
+}
+
+// ReorderModules задаёт порядок модулей в каталоге (PUT /modules/order, только owner)
+func (h *UserHandler) ReorderModules(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageModules(w, r) {
+		return
+	}
+
+	var req dto.ModuleOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.store.Modules().Reorder(req.IDs)
+	if errors.Is(err, storage.ErrInvalidOrder) {
+		http.Error(w, "Invalid order: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save module order: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.listModuleCatalog(w)
+}
+
+// Вспомогательные функции
+
+// canManageModules проверяет право на изменение каталога; при отказе ответ уже отправлен
+func (h *UserHandler) canManageModules(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	if err := policy.Can(user, policy.ActionManageModules, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// loadModule находит модуль из URL; при ошибке ответ уже отправлен
+func (h *UserHandler) loadModule(w http.ResponseWriter, r *http.Request) (models.Module, bool) {
+	moduleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid module ID", http.StatusBadRequest)
+		return models.Module{}, false
+	}
+
+	module, err := h.store.Modules().Get(moduleID)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Module not found", http.StatusNotFound)
+		return models.Module{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load module data", http.StatusInternalServerError)
+		return models.Module{}, false
+	}
+	return module, true
+}
+
+// saveModule сохраняет изменённый модуль и отправляет его в ответ
+func (h *UserHandler) saveModule(w http.ResponseWriter, module models.Module) {
+	updated, err := h.store.Modules().Update(module)
+	switch {
+	case errors.Is(err, storage.ErrVersionConflict):
+		http.Error(w, "Module was changed by someone else, reload it and try again", http.StatusConflict)
+		return
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Module not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to save module: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// listModuleCatalog отправляет весь каталог, включая архивные модули
+func (h *UserHandler) listModuleCatalog(w http.ResponseWriter) {
+	modules, err := h.store.Modules().List()
+	if err != nil {
+		http.Error(w, "Failed to load module data", http.StatusInternalServerError)
+		return
+	}
+	if modules == nil {
+		modules = []models.Module{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(modules); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func applyModuleRequest(module models.Module, req dto.ModuleRequest) models.Module {
+	module.Name = strings.TrimSpace(req.Name)
+	module.DescriptionMin = strings.TrimSpace(req.DescriptionMin)
+	module.DescriptionMax = strings.TrimSpace(req.DescriptionMax)
+	module.TotalClasses = req.TotalClasses
+	module.TotalDuration = strings.TrimSpace(req.TotalDuration)
+	module.LinkToFolder = strings.TrimSpace(req.LinkToFolder)
+	return module
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
+	"myapp/internal/auth"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+)
+
+// ChangePassword меняет пароль текущего пользователя (POST /me/password).
+// Все сессии отзываются, в ответе - токены новой сессии.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	// 1. Текущий пользователь
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 2. Парсинг входных данных
+	var req dto.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "currentPassword and newPassword are required", http.StatusBadRequest)
+		return
+	}
+
+	// 3. Подбор текущего пароля по украденному токену ограничивается так же, как вход
+	ip := remoteHost(r)
+	if !h.allowAttempt(w, ip, currentUser.Login) {
+		return
+	}
+
+	// 4. Смена пароля и отзыв сессий
+	tokens, updated, err := h.authService.ChangePassword(currentUser.ID, req.CurrentPassword, req.NewPassword)
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		h.limiter.Fail(ip, currentUser.Login, time.Now())
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	case errors.Is(err, auth.ErrResetCodeExpired):
+		h.limiter.Fail(ip, currentUser.Login, time.Now())
+		http.Error(w, "Password reset code has expired", http.StatusForbidden)
+		return
+	case errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrPasswordTooLong):
+		h.limiter.Release(ip, currentUser.Login)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		h.limiter.Release(ip, currentUser.Login)
+		log.Printf("failed to change password of user %s: %v", currentUser.ID, err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	h.limiter.Succeed(ip, currentUser.Login)
+
+	// 5. Журнал аудита
+	event := auditEvent(models.AuditChangePassword, updated)
+	event.Changes = auditDiff(currentUser, updated)
+	recordAudit(h.store, r, currentUser, event)
+
+	writeTokens(w, tokens, updated)
+}
+
+// ResetPassword выдаёт пользователю одноразовый код сброса пароля
+// (POST /users/{id}/password-reset). Код заменяет пароль, сессии пользователя
+// отзываются, после входа по коду пароль нужно сменить.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	// 1. Текущий пользователь
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 2. Целевой пользователь и права
+	target, err := h.authService.UserStorage.GetUserByID(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if target.ID == currentUser.ID {
+		http.Error(w, "Use /me/password to change your own password", http.StatusForbidden)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionResetPassword, &target); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// 3. Код сброса вместо пароля
+	updated, code, err := h.authService.ResetPassword(target.ID)
+	if err != nil {
+		log.Printf("failed to reset password of user %s: %v", target.ID, err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// 4. Блокировка входа после неудач больше не нужна: пароль выдан заново
+	h.limiter.Reset(target.Login)
+
+	// 5. Журнал аудита; сам код не записывается
+	event := auditEvent(models.AuditResetPassword, updated)
+	event.Changes = auditDiff(target, updated)
+	recordAudit(h.store, r, currentUser, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(dto.PasswordResetResponse{
+		UserID:    updated.ID,
+		Code:      code,
+		ExpiresAt: updated.ResetExpiresAt,
+	})
+}
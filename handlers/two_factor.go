@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"myapp/dto/dto"
+	"myapp/internal/auth"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+)
+
+// GetTwoFactor возвращает состояние двухфакторной аутентификации текущего пользователя (GET /me/2fa)
+func (h *AuthHandler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.authService.TwoFactorStatus(currentUser)
+	if err != nil {
+		http.Error(w, "Failed to load two-factor settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// SetupTwoFactor выдаёт новый секрет TOTP и otpauth-URI для QR-кода (POST /me/2fa/setup).
+// Второй фактор включается после подтверждения кодом (POST /me/2fa/enable).
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	secret, uri, err := h.authService.SetupTwoFactor(currentUser)
+	if errors.Is(err, auth.ErrTwoFactorEnabled) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("failed to set up two-factor authentication for user %s: %v", currentUser.ID, err)
+		http.Error(w, "Failed to set up two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(dto.TwoFactorSetupResponse{Secret: secret, URI: uri})
+}
+
+// EnableTwoFactor включает второй фактор по первому коду из приложения и
+// возвращает коды восстановления (POST /me/2fa/enable)
+func (h *AuthHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser, code, ok := h.twoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.authService.EnableTwoFactor(currentUser.ID, code)
+	if !h.checkTwoFactorError(w, r, currentUser, err) {
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditEnable2FA, currentUser))
+
+	sendRecoveryCodes(w, codes)
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми (POST /me/2fa/recovery-codes)
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	currentUser, code, ok := h.twoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(currentUser.ID, code)
+	if !h.checkTwoFactorError(w, r, currentUser, err) {
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditRecoveryCodes, currentUser))
+
+	sendRecoveryCodes(w, codes)
+}
+
+// DisableTwoFactor выключает второй фактор по коду TOTP или коду восстановления
+// (DELETE /me/2fa). Для owner и admin он обязателен.
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser, code, ok := h.twoFactorRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.authService.DisableTwoFactor(currentUser, code)
+	if errors.Is(err, auth.ErrTwoFactorRequired) {
+		h.limiter.Release(remoteHost(r), currentUser.Login)
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+	if !h.checkTwoFactorError(w, r, currentUser, err) {
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditDisable2FA, currentUser))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetUserTwoFactor сбрасывает второй фактор пользователя, потерявшего
+// устройство и коды восстановления (DELETE /users/{id}/2fa, только owner).
+// Сессии пользователя отзываются; при следующем входе он настроит 2FA заново.
+func (h *AuthHandler) ResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	target, err := h.authService.UserStorage.GetUserByID(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if target.ID == currentUser.ID {
+		http.Error(w, "Use /me/2fa to manage your own two-factor authentication", http.StatusForbidden)
+		return
+	}
+	if err := policy.Can(currentUser, policy.ActionReset2FA, &target); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	err = h.authService.ResetTwoFactor(target.ID)
+	if errors.Is(err, auth.ErrTwoFactorDisabled) {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("failed to reset two-factor authentication of user %s: %v", target.ID, err)
+		http.Error(w, "Failed to reset two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditReset2FA, target))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Вспомогательные функции
+
+// twoFactorRequest читает текущего пользователя и код из тела запроса и
+// проверяет ограничение попыток; при ошибке ответ уже отправлен
+func (h *AuthHandler) twoFactorRequest(w http.ResponseWriter, r *http.Request) (models.User, string, bool) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return models.User{}, "", false
+	}
+
+	var req dto.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return models.User{}, "", false
+	}
+
+	// Подбор кода по украденному токену ограничивается так же, как вход
+	if !h.allowAttempt(w, remoteHost(r), currentUser.Login) {
+		return models.User{}, "", false
+	}
+	return currentUser, req.Code, true
+}
+
+// checkTwoFactorError отвечает на ошибку операции со вторым фактором и
+// завершает попытку из twoFactorRequest; неверный код учитывается как
+// неудачная попытка. При ошибке ответ уже отправлен.
+func (h *AuthHandler) checkTwoFactorError(w http.ResponseWriter, r *http.Request, user models.User, err error) bool {
+	ip := remoteHost(r)
+	switch {
+	case err == nil:
+		h.limiter.Succeed(ip, user.Login)
+		return true
+	case errors.Is(err, auth.ErrInvalidCode):
+		h.limiter.Fail(ip, user.Login, time.Now())
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+		return false
+	}
+
+	h.limiter.Release(ip, user.Login)
+	switch {
+	case errors.Is(err, auth.ErrTwoFactorEnabled):
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+	case errors.Is(err, auth.ErrTwoFactorDisabled):
+		http.Error(w, "Two-factor authentication is not set up", http.StatusConflict)
+	default:
+		log.Printf("two-factor operation failed for user %s: %v", user.ID, err)
+		http.Error(w, "Failed to update two-factor authentication", http.StatusInternalServerError)
+	}
+	return false
+}
+
+func sendRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
@@ -1,164 +1,358 @@
 package handlers
 
-//
-//import (
-//	"encoding/json"
-//	"fmt"
-//	"github.com/go-chi/chi/v5"
-//	"myapp/dto/dto"
-//	"myapp/internal/models"
-//	"net/http"
-//	"strings"
-//)
-//
-//func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-//	// Получаем текущего пользователя из контекста
-//	currentUser, ok := r.Context().Value("user").(models.User)
-//	if !ok {
-//		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
-//		return
-//	}
-//
-//	// Получаем ID пользователя из URL
-//	userID := chi.URLParam(r, "id")
-//	if userID == "" {
-//		http.Error(w, "User ID is required", http.StatusBadRequest)
-//		return
-//	}
-//
-//	// Декодируем тело запроса
-//	var updateData dto.UserUpdateRequest
-//	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-//		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-//		return
-//	}
-//
-//	// Получаем всех пользователей
-//	allUsers, err := h.authService.UserStorage.GetAllUsers()
-//	if err != nil {
-//		http.Error(w, "Failed to get users: "+err.Error(), http.StatusInternalServerError)
-//		return
-//	}
-//
-//	// Проверяем существование пользователя
-//	userToUpdate, exists := allUsers[userID]
-//	if !exists {
-//		http.Error(w, fmt.Sprintf("User with ID %s not found", userID), http.StatusNotFound)
-//		return
-//	}
-//
-//	// Проверяем права доступа
-//	if err := checkUpdatePermissions(currentUser, userToUpdate); err != nil {
-//		http.Error(w, "Permission denied: "+err.Error(), http.StatusForbidden)
-//		return
-//	}
-//
-//	// Валидация и обновление полей
-//	if err := validateAndUpdateUser(&userToUpdate, updateData, currentUser); err != nil {
-//		http.Error(w, err.Error(), http.StatusBadRequest)
-//		return
-//	}
-//
-//	// Сохраняем изменения
-//	allUsers[userID] = userToUpdate
-//	if err := h.authService.UserStorage.SaveAllUsers(allUsers); err != nil {
-//		http.Error(w, "Failed to save user data: "+err.Error(), http.StatusInternalServerError)
-//		return
-//	}
-//
-//	// Возвращаем обновленного пользователя
-//	sendUpdatedUserResponse(w, userToUpdate)
-//}
-//
-//// Вспомогательные функции
-//
-//func checkUpdatePermissions(currentUser, targetUser models.User) error {
-//	switch currentUser.Role {
-//	case models.RoleOwner:
-//		return nil
-//	case models.RoleAdmin:
-//		if targetUser.Filial != currentUser.Filial {
-//			return fmt.Errorf("can only update users from your filial")
-//		}
-//		return nil
-//	case models.RoleHelper:
-//		if targetUser.Filial != currentUser.Filial || targetUser.Role != models.RoleUser {
-//			return fmt.Errorf("can only update regular users from your filial")
-//		}
-//		return nil
-//	default:
-//		return fmt.Errorf("insufficient permissions")
-//	}
-//}
-//
-//func validateAndUpdateUser(user *models.User, updateData dto.UserUpdateRequest, currentUser models.User) error {
-//	// Обновление имени
-//	if updateData.Name != "" {
-//		user.Name = strings.TrimSpace(updateData.Name)
-//		if user.Name == "" {
-//			return fmt.Errorf("name cannot be empty")
-//		}
-//	}
-//
-//	// Обновление филиала
-//	if updateData.Filial != "" {
-//		user.Filial = strings.TrimSpace(updateData.Filial)
-//		if user.Filial == "" {
-//			return fmt.Errorf("filial cannot be empty")
-//		}
-//	}
-//
-//	// Обновление пароля
-//	if updateData.Password != "" {
-//		if len(updateData.Password) < 6 {
-//			return fmt.Errorf("password must be at least 6 characters")
-//		}
-//		user.Password = updateData.Password
-//	}
-//
-//	// Обновление статуса
-//	if updateData.Status != "" {
-//		status := models.UserStatus(updateData.Status)
-//		if !models.IsValidStatus(status) {
-//			return fmt.Errorf("invalid status value")
-//		}
-//		user.Status = status
-//	}
-//
-//	// Обновление роли (если разрешено)
-//	if updateData.Role != "" {
-//		if currentUser.Role != models.RoleOwner && currentUser.Role != models.RoleAdmin {
-//			return fmt.Errorf("only owner and admin can change roles")
-//		}
-//
-//		role := models.UserRole(updateData.Role)
-//		if !models.IsValidRole(role) {
-//			return fmt.Errorf("invalid role value")
-//		}
-//
-//		if currentUser.Role == models.RoleAdmin &&
-//			(role == models.RoleOwner || role == models.RoleAdmin) {
-//			return fmt.Errorf("admin cannot assign owner or admin roles")
-//		}
-//
-//		user.Role = role
-//	}
-//
-//	return nil
-//}
-//
-//func sendUpdatedUserResponse(w http.ResponseWriter, user models.User) {
-//	response := dto.UserResponse{
-//		ID:     user.ID,
-//		Login:  user.Login,
-//		Name:   user.Name,
-//		Filial: user.Filial,
-//		Role:   user.Role,
-//		Status: user.Status,
-//	}
-//
-//	w.Header().Set("Content-Type", "application/json")
-//	if err := json.NewEncoder(w).Encode(response); err != nil {
-//		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-//	}
-//}
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"myapp/dto/dto"
+	"myapp/internal/auth"
+	"myapp/internal/models"
+	"myapp/internal/policy"
+	"myapp/internal/storage"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// UpdateUser изменяет имя, филиал и пароль пользователя (PATCH /users/{id})
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	// Получаем текущего пользователя из контекста
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
+		return
+	}
+
+	// Декодируем тело запроса
+	var updateData dto.UserUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userToUpdate, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Валидация и обновление полей
+	updated := userToUpdate
+	passwordChanged, err := validateAndUpdateUser(&updated, updateData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Проверяем права доступа до и после изменения
+	if err := policy.CanChange(currentUser, policy.ActionUpdateUser, userToUpdate, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	// Чужой пароль, заданный через PATCH, - тот же сброс пароля и подчиняется его правилам
+	if passwordChanged && userToUpdate.ID != currentUser.ID {
+		if err := policy.Can(currentUser, policy.ActionResetPassword, &userToUpdate); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Смена филиала - это перевод: новый филиал проверяется по справочнику
+	if updated.Filial != userToUpdate.Filial {
+		h.enrollMu.Lock()
+		defer h.enrollMu.Unlock()
+		h.groupsMu.Lock()
+		defer h.groupsMu.Unlock()
+
+		if !h.checkTransfer(w, userToUpdate, updated.Filial) {
+			return
+		}
+	}
+
+	if !h.saveUser(w, updated) {
+		return
+	}
+	h.auditUserChange(r, currentUser, models.AuditUpdateUser, userToUpdate, updated)
+
+	// После смены пароля старые сессии больше не действительны
+	if passwordChanged {
+		h.revokeSessions(updated.ID)
+	}
+
+	sendUpdatedUserResponse(w, updated)
+}
+
+// UpdateUserStatus переводит пользователя между статусами active, frozen и deleted (PUT /users/{id}/status)
+func (h *UserHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	var req dto.UserStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !models.IsValidStatus(req.Status) {
+		http.Error(w, "Invalid status value", http.StatusBadRequest)
+		return
+	}
+
+	h.changeStatus(w, r, req.Status)
+}
+
+// DeleteUser мягко удаляет пользователя (DELETE /users/{id})
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, models.StatusDeleted)
+}
+
+// RestoreUser восстанавливает мягко удалённого пользователя (POST /users/{id}/restore)
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	target, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if target.Status != models.StatusDeleted {
+		http.Error(w, "User is not deleted", http.StatusConflict)
+		return
+	}
+
+	h.changeStatus(w, r, models.StatusActive)
+}
+
+// UpdateUserRole меняет роль пользователя (PUT /users/{id}/role)
+func (h *UserHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
+		return
+	}
+
+	var req dto.UserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		http.Error(w, "Invalid role value", http.StatusBadRequest)
+		return
+	}
+
+	target, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if target.ID == currentUser.ID {
+		http.Error(w, "You cannot change your own role", http.StatusForbidden)
+		return
+	}
+
+	updated := target
+	updated.Role = req.Role
+	if err := policy.CanChange(currentUser, policy.ActionChangeRole, target, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if !h.saveUser(w, updated) {
+		return
+	}
+	h.auditUserChange(r, currentUser, models.AuditChangeRole, target, updated)
+
+	// Профиль переезжает в файл данных новой роли
+	if err := storage.MoveUserData(h.store.UserData(), updated.ID, target.Role, updated.Role); err != nil {
+		log.Printf("failed to move profile data of user %s: %v", updated.ID, err)
+	}
+
+	// Токены несут права старой роли
+	h.revokeSessions(updated.ID)
+
+	sendUpdatedUserResponse(w, updated)
+}
+
+// PurgeUser безвозвратно удаляет мягко удалённого пользователя (DELETE /users/{id}/purge, только owner)
+func (h *UserHandler) PurgeUser(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
+		return
+	}
+
+	target, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := policy.Can(currentUser, policy.ActionPurgeUser, &target); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if target.ID == currentUser.ID {
+		http.Error(w, "You cannot purge yourself", http.StatusForbidden)
+		return
+	}
+
+	// Безвозвратно удаляется только то, что уже удалено мягко
+	if target.Status != models.StatusDeleted {
+		http.Error(w, "Only deleted users can be purged", http.StatusConflict)
+		return
+	}
+
+	h.revokeSessions(target.ID)
+
+	if err := h.authService.UserStorage.DeleteUser(target.ID); err != nil {
+		http.Error(w, "Failed to purge user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordAudit(h.store, r, currentUser, auditEvent(models.AuditPurgeUser, target))
+
+	// Профильные данные и второй фактор без учётной записи больше не нужны
+	if err := h.store.UserData().Delete(target.Role, target.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("failed to delete profile data of user %s: %v", target.ID, err)
+	}
+	if err := h.store.TwoFactor().Delete(target.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("failed to delete two-factor settings of user %s: %v", target.ID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Вспомогательные функции
+
+// changeStatus выставляет пользователю статус по правилам ActionChangeStatus
+func (h *UserHandler) changeStatus(w http.ResponseWriter, r *http.Request, status models.UserStatus) {
+	currentUser, ok := r.Context().Value("user").(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: invalid user context", http.StatusUnauthorized)
+		return
+	}
+
+	target, ok := h.loadTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if target.ID == currentUser.ID {
+		http.Error(w, "You cannot change your own status", http.StatusForbidden)
+		return
+	}
+
+	updated := target
+	updated.Status = status
+	if err := policy.CanChange(currentUser, policy.ActionChangeStatus, target, updated); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if target.Status != status {
+		if !h.saveUser(w, updated) {
+			return
+		}
+		h.auditUserChange(r, currentUser, models.AuditChangeStatus, target, updated)
+	}
+
+	// Замороженный или удалённый пользователь теряет все сессии сразу
+	if status != models.StatusActive {
+		h.revokeSessions(updated.ID)
+	}
+
+	sendUpdatedUserResponse(w, updated)
+}
+
+// auditUserChange записывает в журнал аудита изменение учётной записи пользователя
+func (h *UserHandler) auditUserChange(r *http.Request, actor models.User, action string, before, after models.User) {
+	event := auditEvent(action, after)
+	event.Changes = auditDiff(before, after)
+	recordAudit(h.store, r, actor, event)
+}
+
+// loadTargetUser находит пользователя из URL; при ошибке ответ уже отправлен
+func (h *UserHandler) loadTargetUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	userID := chi.URLParam(r, "id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return models.User{}, false
+	}
+
+	user, err := h.authService.UserStorage.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("User with ID %s not found", userID), http.StatusNotFound)
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// saveUser сохраняет пользователя; при ошибке ответ уже отправлен
+func (h *UserHandler) saveUser(w http.ResponseWriter, user models.User) bool {
+	if err := h.authService.UserStorage.UpdateUser(user); err != nil {
+		http.Error(w, "Failed to save user data: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (h *UserHandler) revokeSessions(userID string) {
+	if _, err := h.authService.RevokeUserSessions(userID); err != nil {
+		log.Printf("failed to revoke sessions of user %s: %v", userID, err)
+	}
+}
+
+func validateAndUpdateUser(user *models.User, updateData dto.UserUpdateRequest) (passwordChanged bool, err error) {
+	// Обновление имени
+	if updateData.Name != "" {
+		user.Name = strings.TrimSpace(updateData.Name)
+		if user.Name == "" {
+			return false, fmt.Errorf("name cannot be empty")
+		}
+	}
+
+	// Обновление филиала
+	if updateData.Filial != "" {
+		user.Filial = strings.TrimSpace(updateData.Filial)
+		if user.Filial == "" {
+			return false, fmt.Errorf("filial cannot be empty")
+		}
+	}
+
+	// Обновление пароля
+	if updateData.Password != "" {
+		if err := auth.CheckPasswordStrength(updateData.Password, user.Login); err != nil {
+			return false, err
+		}
+		hash, err := auth.HashPassword(updateData.Password)
+		if err != nil {
+			return false, err
+		}
+		// Новый пароль заменяет и код сброса, как при смене пароля самим пользователем
+		user.Password = hash
+		user.MustChangePassword = false
+		user.ResetExpiresAt = 0
+		passwordChanged = true
+	}
+
+	return passwordChanged, nil
+}
+
+func toUserResponse(user models.User) dto.UserResponse {
+	return dto.UserResponse{
+		ID:       user.ID,
+		Login:    user.Login,
+		Password: "********", // Маскируем пароль в ответе
+		Name:     user.Name,
+		Filial:   user.Filial,
+		Role:     user.Role,
+		Status:   user.Status,
+
+		MustChangePassword: user.MustChangePassword,
+	}
+}
+
+func sendUpdatedUserResponse(w http.ResponseWriter, user models.User) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(toUserResponse(user)); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
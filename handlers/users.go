@@ -2,26 +2,51 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"myapp/config"
 	"myapp/dto/dto"
 	"myapp/internal/auth"
 	"myapp/internal/models"
+	"myapp/internal/policy"
 	"myapp/internal/storage"
-	"myapp/internal/utils"
 	"net/http"
 	"os"
-	"path/filepath"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type UserHandler struct {
 	authService *auth.AuthService
+	store       storage.Backend
+	cfg         config.Config
+	links       *auth.FileLinks
+	maintenance *Maintenance
+
+	// filesMu упорядочивает изменения файлов уроков, чтобы диск и индекс не расходились
+	filesMu sync.Mutex
+	// grantsMu упорядочивает изменения профильных данных, чтобы выдача доступа не терялась
+	grantsMu sync.Mutex
+	// enrollMu упорядочивает изменения записей на модули
+	enrollMu sync.Mutex
+	// groupsMu упорядочивает изменения учебных групп
+	groupsMu sync.Mutex
+	// filialsMu упорядочивает изменения справочника филиалов
+	filialsMu sync.Mutex
+	// watermarkMu не даёт одновременно штамповать один и тот же файл
+	watermarkMu sync.Mutex
 }
 
-func NewUserHandler(authService *auth.AuthService) *UserHandler {
-	return &UserHandler{authService: authService}
+func NewUserHandler(authService *auth.AuthService, store storage.Backend, links *auth.FileLinks, maintenance *Maintenance, cfg config.Config) *UserHandler {
+	return &UserHandler{
+		authService: authService,
+		store:       store,
+		cfg:         cfg,
+		links:       links,
+		maintenance: maintenance,
+	}
 }
 
 func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +57,11 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !policy.Allowed(user.Role, policy.ActionViewUser) {
+		http.Error(w, "Forbidden: you cannot access this resource", http.StatusForbidden)
+		return
+	}
+
 	// Получаем всех пользователей (теперь это slice, а не map)
 	allUsers, err := h.authService.UserStorage.GetAllUsers()
 	if err != nil {
@@ -39,51 +69,13 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var filteredUsers []models.User
-
-	switch user.Role {
-	case models.RoleOwner:
-		// Owner видит всех
-		filteredUsers = allUsers
-
-	case models.RoleAdmin:
-		// Admin видит только свой филиал и только НЕ удалённых пользователей
-		for _, u := range allUsers {
-			if u.Filial == user.Filial && u.Status != models.StatusDeleted {
-				filteredUsers = append(filteredUsers, u)
-			}
-		}
-
-	case models.RoleHelper:
-		// Helper видит только пользователей из своего филиала с ролью "user" и статусом НЕ deleted
-		for _, u := range allUsers {
-			if u.Filial == user.Filial && u.Role == models.RoleUser && u.Status != models.StatusDeleted {
-				filteredUsers = append(filteredUsers, u)
-			}
-		}
-
-	case models.RoleUser:
-		// User не имеет доступа
-		http.Error(w, "Forbidden: users cannot access this resource", http.StatusForbidden)
-		return
-
-	default:
-		http.Error(w, "Forbidden: unknown role", http.StatusForbidden)
-		return
-	}
+	// Оставляем только пользователей, доступных по политике
+	filteredUsers := policy.Filter(user, policy.ActionViewUser, allUsers)
 
 	// Преобразуем в DTO
 	var dtos []dto.UserResponse
 	for _, u := range filteredUsers {
-		dtos = append(dtos, dto.UserResponse{
-			ID:       u.ID,
-			Login:    u.Login,
-			Password: "********", // Маскируем пароль в ответе
-			Name:     u.Name,
-			Filial:   u.Filial,
-			Role:     u.Role,
-			Status:   u.Status,
-		})
+		dtos = append(dtos, toUserResponse(u))
 	}
 
 	// Отправляем ответ
@@ -103,71 +95,16 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Определяем файл в зависимости от роли пользователя
-	var dataFile string
-	switch user.Role {
-	case models.RoleUser:
-		dataFile = "storage/jsons/user-data.json"
-	case models.RoleAdmin:
-		dataFile = "storage/jsons/admin-data.json"
-	case models.RoleOwner:
-		dataFile = "storage/jsons/admin-data.json"
-	case models.RoleTutor:
-		dataFile = "storage/jsons/tutor-data.json"
-	case models.RoleHelper:
-		dataFile = "storage/jsons/helper-data.json"
-	default:
-		http.Error(w, "Forbidden: unknown role", http.StatusForbidden)
-		return
-	}
-
-	// Загружаем данные из нужного файла
-	dataStorage := storage.NewDataStorage(dataFile)
-	data, err := dataStorage.LoadData()
-	if err != nil {
-		http.Error(w, "Failed to load data", http.StatusInternalServerError)
-		return
-	}
-
-	// Преобразуем "users" из интерфейса в []models.UserData
-	var users []models.UserData
-	if userDataList, ok := data["users"].([]interface{}); ok {
-		for _, u := range userDataList {
-			userMap := u.(map[string]interface{})
-			var userData models.UserData
-			err := json.Unmarshal(utils.ToJSON(userMap), &userData)
-			if err != nil {
-				http.Error(w, "Failed to parse user data", http.StatusInternalServerError)
-				return
-			}
-			users = append(users, userData)
-		}
-	}
-
-	// Конвертируем user.ID (string) в int
-	userIDInt, err := strconv.Atoi(user.ID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+	// Загружаем профиль пользователя
+	foundUser, ok := h.loadUserData(w, user, "User not found")
+	if !ok {
 		return
 	}
 
-	// Ищем пользователя по ID
-	var foundUser *models.UserData
-	for _, u := range users {
-		if u.ID == userIDInt {
-			foundUser = &u
-			break
-		}
-	}
-
 	// Отправляем ответ
-	if foundUser != nil {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(foundUser); err != nil {
-			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		}
-	} else {
-		http.Error(w, "User not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(foundUser); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
@@ -179,77 +116,31 @@ func (h *UserHandler) GetModules(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Проверяем, является ли пользователь tutor
-	if user.Role != models.RoleTutor {
-		http.Error(w, "Forbidden: only tutors can access this resource", http.StatusForbidden)
+	// Владелец видит весь каталог, включая архив
+	if policy.Can(user, policy.ActionManageModules, nil) == nil {
+		h.listModuleCatalog(w)
 		return
 	}
 
-	// Ищем профиль текущего пользователя в tutor-data.json
-	tutorDataStorage := storage.NewDataStorage("storage/jsons/tutor-data.json")
-	tutorRawData, err := tutorDataStorage.LoadData()
-	if err != nil {
-		http.Error(w, "Failed to load tutor data", http.StatusInternalServerError)
-		return
-	}
-
-	var tutors []models.UserData
-	if userDataList, ok := tutorRawData["users"].([]interface{}); ok {
-		for _, u := range userDataList {
-			userMap := u.(map[string]interface{})
-			var userData models.UserData
-			err := json.Unmarshal(utils.ToJSON(userMap), &userData)
-			if err != nil {
-				http.Error(w, "Failed to parse tutor data", http.StatusInternalServerError)
-				return
-			}
-			tutors = append(tutors, userData)
-		}
-	}
-
-	// Конвертируем ID пользователя из string в int
-	userIDInt, err := strconv.Atoi(user.ID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusInternalServerError)
+	// Проверяем, является ли пользователь tutor
+	if err := policy.Can(user, policy.ActionListOwnModules, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	// Находим текущего пользователя среди tutors
-	var tutor *models.UserData
-	for _, t := range tutors {
-		if t.ID == userIDInt {
-			tutor = &t
-			break
-		}
-	}
-
-	if tutor == nil {
-		http.Error(w, "Tutor not found", http.StatusNotFound)
+	// Загружаем профиль текущего тьютора
+	tutor, ok := h.loadUserData(w, user, "Tutor not found")
+	if !ok {
 		return
 	}
 
-	// Загружаем все модули из modules-description.json
-	moduleStorage := storage.NewDataStorage("storage/jsons/modules-description.json")
-	moduleRawData, err := moduleStorage.LoadData()
+	// Загружаем все модули
+	allModules, err := h.store.Modules().List()
 	if err != nil {
 		http.Error(w, "Failed to load module data", http.StatusInternalServerError)
 		return
 	}
 
-	var allModules []models.Module
-	if moduleList, ok := moduleRawData["learningModules"].([]interface{}); ok {
-		for _, m := range moduleList {
-			moduleMap := m.(map[string]interface{})
-			var module models.Module
-			err := json.Unmarshal(utils.ToJSON(moduleMap), &module)
-			if err != nil {
-				http.Error(w, "Failed to parse module data", http.StatusInternalServerError)
-				return
-			}
-			allModules = append(allModules, module)
-		}
-	}
-
 	// Создаём мапу для быстрого поиска даты
 	now := time.Now().UnixMilli()
 	tutorModuleMap := make(map[int]int64)
@@ -259,10 +150,10 @@ func (h *UserHandler) GetModules(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Фильтруем модули
+	// Фильтруем модули: только выданные и не в архиве
 	var resultModules []models.Module
 	for _, module := range allModules {
-		if _, exists := tutorModuleMap[module.ID]; exists {
+		if _, exists := tutorModuleMap[module.ID]; exists && !module.Archived {
 			resultModules = append(resultModules, module)
 		}
 	}
@@ -307,93 +198,18 @@ func (h *UserHandler) GetUserData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Проверяем права доступа
-	switch currentUser.Role {
-	case models.RoleOwner:
-		// Owner может видеть любого
-	case models.RoleAdmin:
-		// Admin только своего филиала (и удалённых)
-		if targetUser.Filial != currentUser.Filial {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-	case models.RoleHelper:
-		// Helper только своего филиала, роль User и не удалённых
-		if targetUser.Filial != currentUser.Filial ||
-			targetUser.Role != models.RoleUser ||
-			targetUser.Status == models.StatusDeleted {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-	case models.RoleUser:
-		// User не имеет доступа
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	default:
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	// 4. Определяем файл с данными в зависимости от роли целевого пользователя
-	var dataFile string
-	switch targetUser.Role {
-	case models.RoleUser:
-		dataFile = "storage/jsons/user-data.json"
-	case models.RoleAdmin, models.RoleOwner:
-		dataFile = "storage/jsons/admin-data.json"
-	case models.RoleTutor:
-		dataFile = "storage/jsons/tutor-data.json"
-	case models.RoleHelper:
-		dataFile = "storage/jsons/helper-data.json"
-	default:
-		http.Error(w, "Unknown user role", http.StatusInternalServerError)
-		return
-	}
-
-	// 5. Загружаем данные из соответствующего файла
-	dataStorage := storage.NewDataStorage(dataFile)
-	data, err := dataStorage.LoadData()
-	if err != nil {
-		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
-		return
-	}
-
-	// 6. Ищем данные конкретного пользователя
-	var usersData []models.UserData
-	if userDataList, ok := data["users"].([]interface{}); ok {
-		for _, u := range userDataList {
-			userMap := u.(map[string]interface{})
-			var userData models.UserData
-			err := json.Unmarshal(utils.ToJSON(userMap), &userData)
-			if err != nil {
-				http.Error(w, "Failed to parse user data", http.StatusInternalServerError)
-				return
-			}
-			usersData = append(usersData, userData)
-		}
-	}
-
-	// Конвертируем ID из string в int для сравнения
-	targetUserID, err := strconv.Atoi(targetUser.ID)
-	if err != nil {
-		http.Error(w, "Invalid user ID format", http.StatusInternalServerError)
+	if err := policy.Can(currentUser, policy.ActionViewUser, targetUser); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	// Находим данные запрашиваемого пользователя
-	var foundUserData *models.UserData
-	for _, ud := range usersData {
-		if ud.ID == targetUserID {
-			foundUserData = &ud
-			break
-		}
-	}
-
-	if foundUserData == nil {
-		http.Error(w, "User data not found", http.StatusNotFound)
+	// 4. Загружаем данные запрашиваемого пользователя
+	foundUserData, ok := h.loadUserData(w, *targetUser, "User data not found")
+	if !ok {
 		return
 	}
 
-	// 7. Возвращаем найденные данные
+	// 5. Возвращаем найденные данные
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(foundUserData); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
@@ -411,10 +227,10 @@ func (h *UserHandler) UpdateUserData(w http.ResponseWriter, r *http.Request) {
 	// 2. Получаем ID обновляемого пользователя
 	userID := chi.URLParam(r, "id")
 
-	// 3. Получаем данные для обновления
+	// 3. Получаем данные для обновления; отсутствующие поля не меняются
 	var updateData struct {
-		Links   []models.Link       `json:"links,omitempty"`
-		Modules []models.ModuleInfo `json:"modules,omitempty"`
+		Links   *[]models.Link       `json:"links"`
+		Modules *[]models.ModuleInfo `json:"modules"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -441,94 +257,53 @@ func (h *UserHandler) UpdateUserData(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 5. Проверяем права доступа
-	switch currentUser.Role {
-	case models.RoleOwner:
-		// Owner может обновлять всех
-	case models.RoleAdmin:
-		if targetUser.Filial != currentUser.Filial {
-			http.Error(w, "Forbidden: can only update users in your filial", http.StatusForbidden)
-			return
-		}
-	case models.RoleHelper:
-		if targetUser.Filial != currentUser.Filial ||
-			targetUser.Role != models.RoleUser ||
-			targetUser.Status == models.StatusDeleted {
-			http.Error(w, "Forbidden: can only update not deleted users in your filial", http.StatusForbidden)
-			return
-		}
-	default:
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	if err := policy.Can(currentUser, policy.ActionUpdateUserData, targetUser); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
-	// 6. Определяем файл с данными
-	var dataFile string
-	switch targetUser.Role {
-	case models.RoleUser:
-		dataFile = "storage/jsons/user-data.json"
-	case models.RoleAdmin, models.RoleOwner:
-		dataFile = "storage/jsons/admin-data.json"
-	case models.RoleTutor:
-		dataFile = "storage/jsons/tutor-data.json"
-	case models.RoleHelper:
-		dataFile = "storage/jsons/helper-data.json"
-	default:
-		http.Error(w, "Unknown user role", http.StatusInternalServerError)
+	// 6. Обновляем userData поверх сохранённых данных, запоминая прежние для журнала аудита
+	h.grantsMu.Lock()
+	before, err := h.store.UserData().Get(targetUser.Role, targetUser.ID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		h.grantsMu.Unlock()
+		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
 		return
 	}
 
-	// 7. Загружаем данные из файла
-	dataStorage := storage.NewDataStorage(dataFile)
-	data, err := dataStorage.LoadData()
-	if err != nil {
-		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
+	// Доступ к модулям меняется только через /tutors/{id}/grants (проверки, сроки,
+	// журнал выдачи); неизменённый список, присланный вместе со ссылками, допускается
+	if updateData.Modules != nil && !slices.Equal(*updateData.Modules, before.Modules) {
+		h.grantsMu.Unlock()
+		http.Error(w, "Module access is managed through /tutors/{id}/grants", http.StatusBadRequest)
 		return
 	}
 
-	// 8. Обновляем userData
-	var updatedUsers []models.UserData
-	if userDataList, ok := data["users"].([]interface{}); ok {
-		for _, u := range userDataList {
-			userMap := u.(map[string]interface{})
-			var userData models.UserData
-			if err := json.Unmarshal(utils.ToJSON(userMap), &userData); err != nil {
-				http.Error(w, "Failed to parse user data", http.StatusInternalServerError)
-				return
-			}
-
-			// Конвертируем ID для сравнения
-			targetUserID, _ := strconv.Atoi(targetUser.ID)
-			if userData.ID == targetUserID {
-				// Обновляем только те поля, которые есть в UserData
-				userData.Links = updateData.Links
-				userData.Modules = updateData.Modules
-			}
-			updatedUsers = append(updatedUsers, userData)
-		}
+	userData := models.UserData{
+		ID:      targetUser.ID,
+		Links:   before.Links,
+		Modules: before.Modules,
 	}
-
-	// 9. Сохраняем обновлённые данные
-	updatedData := map[string]interface{}{
-		"users": updatedUsers,
+	if updateData.Links != nil {
+		userData.Links = *updateData.Links
+	}
+	if userData.Links == nil {
+		userData.Links = []models.Link{}
 	}
-	if err := dataStorage.SaveData(updatedData); err != nil {
+
+	// 7. Сохраняем обновлённые данные
+	err = h.store.UserData().Upsert(targetUser.Role, userData)
+	h.grantsMu.Unlock()
+	if err != nil {
 		http.Error(w, "Failed to save updated data", http.StatusInternalServerError)
 		return
 	}
 
-	// 10. Обновляем основные данные пользователя в хранилище
-	result := h.authService.UserStorage.UpdateUserData(*targetUser)
-	if result != nil {
-		if e, ok := result.(error); ok {
-			http.Error(w, "Failed to update user: "+e.Error(), http.StatusInternalServerError)
-			return
-		} else {
-			http.Error(w, "Unexpected error during update", http.StatusInternalServerError)
-			return
-		}
-	}
+	event := auditEvent(models.AuditUpdateUserData, *targetUser)
+	event.Changes = auditDiff(before, userData)
+	recordAudit(h.store, r, currentUser, event)
 
-	// 11. Ответ
+	// 8. Ответ
 	w.WriteHeader(http.StatusOK)
 	response := map[string]string{
 		"message": "User data updated successfully",
@@ -541,44 +316,6 @@ func (h *UserHandler) UpdateUserData(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *UserHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
-	// 1. Получаем текущего пользователя из контекста
-	currentUser, ok := r.Context().Value("user").(models.User)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// 2. Проверяем, что пользователь — RoleOwner
-	if currentUser.Role != models.RoleOwner {
-		http.Error(w, "Forbidden: only owner can download files", http.StatusForbidden)
-		return
-	}
-
-	// 3. Получаем имя файла из URL
-	filename := chi.URLParam(r, "filename")
-
-	// 4. Определяем путь к файлу
-	filePath := filepath.Join("storage/jsons", filename)
-
-	// 5. Проверяем существование файла
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		http.Error(w, "File not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Failed to access file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// 6. Настраиваем заголовки для скачивания
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-	// 7. Отправляем содержимое файла
-	http.ServeFile(w, r, filePath)
-}
-
 func (h *UserHandler) GetModulesById(w http.ResponseWriter, r *http.Request) {
 	// 1. Получаем пользователя из контекста
 	user, ok := r.Context().Value("user").(models.User)
@@ -588,11 +325,8 @@ func (h *UserHandler) GetModulesById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Проверяем роль
-	switch user.Role {
-	case models.RoleTutor, models.RoleOwner:
-		// Разрешено
-	default:
-		http.Error(w, "Forbidden: only tutors or owners can access this resource", http.StatusForbidden)
+	if err := policy.Can(user, policy.ActionViewModule, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
@@ -611,45 +345,9 @@ func (h *UserHandler) GetModulesById(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Загружаем tutor-data.json
-		tutorDataStorage := storage.NewDataStorage("storage/jsons/tutor-data.json")
-		tutorRawData, err := tutorDataStorage.LoadData()
-		if err != nil {
-			http.Error(w, "Failed to load tutor data", http.StatusInternalServerError)
-			return
-		}
-
-		var tutors []models.UserData
-		if userDataList, ok := tutorRawData["users"].([]interface{}); ok {
-			for _, u := range userDataList {
-				userMap := u.(map[string]interface{})
-				var userData models.UserData
-				err := json.Unmarshal(utils.ToJSON(userMap), &userData)
-				if err != nil {
-					http.Error(w, "Failed to parse tutor data", http.StatusInternalServerError)
-					return
-				}
-				tutors = append(tutors, userData)
-			}
-		}
-
-		// Конвертируем ID пользователя из string в int
-		userIDInt, err := strconv.Atoi(user.ID)
-		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusInternalServerError)
-			return
-		}
-
-		// Находим текущего пользователя среди tutors
-		var tutor *models.UserData
-		for _, t := range tutors {
-			if t.ID == userIDInt {
-				tutor = &t
-				break
-			}
-		}
-		if tutor == nil {
-			http.Error(w, "Tutor not found", http.StatusNotFound)
+		// Загружаем профиль тьютора
+		tutor, ok := h.loadUserData(w, user, "Tutor not found")
+		if !ok {
 			return
 		}
 
@@ -666,40 +364,21 @@ func (h *UserHandler) GetModulesById(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Forbidden: module not available", http.StatusForbidden)
 			return
 		}
+
+		// Архивный модуль тьюторам больше не показывается
+		if module, err := h.store.Modules().Get(moduleID); err != nil || module.Archived {
+			http.Error(w, "Module not found", http.StatusNotFound)
+			return
+		}
 	}
 
-	// 5. Загружаем modules-files.json и ищем файлы для нужного ID
-	moduleFilesStorage := storage.NewDataStorage("storage/jsons/modules-files.json")
-	moduleFilesRawData, err := moduleFilesStorage.LoadData()
+	// 5. Загружаем список файлов нужного модуля
+	files, err := h.store.ModuleFiles().GetByModule(moduleID)
 	if err != nil {
 		http.Error(w, "Failed to load module files", http.StatusInternalServerError)
 		return
 	}
 
-	var files []models.FileItem
-
-	if fileGroups, ok := moduleFilesRawData["files"].([]interface{}); ok {
-		for _, fg := range fileGroups {
-			if groupMap, ok := fg.(map[string]interface{}); ok {
-				if groupID, ok := groupMap["ID"].(float64); ok && int(groupID) == moduleID {
-					if fileList, ok := groupMap["Files"].([]interface{}); ok {
-						for _, f := range fileList {
-							if fileMap, ok := f.(map[string]interface{}); ok {
-								title, _ := fileMap["Title"].(string)
-								fileName, _ := fileMap["FileName"].(string)
-								files = append(files, models.FileItem{
-									Title:    title,
-									FileName: fileName,
-								})
-							}
-						}
-					}
-					break
-				}
-			}
-		}
-	}
-
 	// 6. Отправляем только список файлов
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(files); err != nil {
@@ -716,11 +395,8 @@ func (h *UserHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Проверяем роль пользователя
-	switch user.Role {
-	case models.RoleTutor, models.RoleOwner:
-		// Разрешено
-	default:
-		http.Error(w, "Forbidden: only tutors or owners can access this resource", http.StatusForbidden)
+	if err := policy.Can(user, policy.ActionViewFile, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
 
@@ -731,25 +407,27 @@ func (h *UserHandler) GetFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 4. Строим путь к PDF-файлу (меняем расширение на .pdf)
-	filePath := filepath.Join("storage/files", fileName+".pdf")
-
-	// 5. Проверяем существование файла
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		http.Error(w, "PDF file not found", http.StatusNotFound)
-		return
-	} else if err != nil {
-		http.Error(w, "Error accessing file: "+err.Error(), http.StatusInternalServerError)
+	// 4. Файл должен относиться к модулю, доступному пользователю
+	moduleID, ok := h.checkFileAccess(w, user, fileName)
+	if !ok {
 		return
 	}
 
-	// 6. Устанавливаем защитные заголовки
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", "inline; filename=\"presentation.pdf\"")
-	w.Header().Set("Cache-Control", "no-store")
-	w.Header().Set("Pragma", "no-cache")
+	// 5. Отправляем файл
+	h.serveLessonFile(w, r, user, fileName, moduleID, models.DownloadViaToken)
+}
+
+// loadUserData возвращает профильные данные пользователя; при ошибке ответ уже отправлен
+func (h *UserHandler) loadUserData(w http.ResponseWriter, user models.User, notFound string) (models.UserData, bool) {
+	data, err := h.store.UserData().Get(user.Role, user.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, notFound, http.StatusNotFound)
+		return models.UserData{}, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to load user data", http.StatusInternalServerError)
+		return models.UserData{}, false
+	}
 
-	// 7. Отправляем файл
-	http.ServeFile(w, r, filePath)
+	return data, true
 }
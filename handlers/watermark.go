@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"myapp/internal/models"
+	"myapp/internal/pdfstamp"
+	"myapp/internal/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watermarkFormat входит в ключ кэша: при смене способа нанесения знака
+// ранее созданные копии пересоздаются
+const watermarkFormat = "2"
+
+// watermarkedFile открывает копию PDF урока с водяным знаком пользователя.
+// Копия кэшируется в CacheDir/watermarks/<userID> и пересоздаётся, когда меняются
+// исходный файл, имя, логин или филиал пользователя, а также раз в сутки,
+// чтобы дата на знаке не устаревала. Если исходного файла нет или имя
+// недопустимо, ошибка удовлетворяет errors.Is(err, fs.ErrNotExist).
+func (h *UserHandler) watermarkedFile(user models.User, fileName string) (*os.File, error) {
+	source, err := storage.SafeDir(h.cfg.Storage.FilesDir).Open(fileName + ".pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	filial := h.filialName(user.Filial)
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%s\x00%d\x00%d\x00%s", watermarkFormat,
+		user.Name, user.Login, filial, info.ModTime().UnixNano(), info.Size(), now.Format(time.DateOnly)))
+	cache := storage.SafeDir(filepath.Join(h.cfg.Storage.CacheDir, "watermarks", user.ID))
+	name := fileName + "." + hex.EncodeToString(sum[:8]) + ".pdf"
+
+	if f, err := cache.Open(name); err == nil {
+		return f, nil
+	}
+
+	h.watermarkMu.Lock()
+	defer h.watermarkMu.Unlock()
+	// Копию мог создать параллельный запрос, пока мы ждали блокировку
+	if f, err := cache.Open(name); err == nil {
+		return f, nil
+	}
+
+	src, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	stamped, err := pdfstamp.Stamp(src, []string{
+		user.Name,
+		"login: " + user.Login,
+		"filial: " + filial,
+		now.Format("2006-01-02 15:04 MST"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(string(cache), 0755); err != nil {
+		return nil, err
+	}
+	if _, err := storage.WriteReaderAtomic(filepath.Join(string(cache), name), bytes.NewReader(stamped), 0644); err != nil {
+		return nil, err
+	}
+
+	// Устаревшие копии этого файла больше не понадобятся
+	removeWatermarks(string(cache), fileName, name)
+	return cache.Open(name)
+}
+
+// dropWatermarks удаляет кэшированные копии файла урока у всех пользователей
+func (h *UserHandler) dropWatermarks(fileName string) {
+	root := filepath.Join(h.cfg.Storage.CacheDir, "watermarks")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+
+	h.watermarkMu.Lock()
+	defer h.watermarkMu.Unlock()
+	for _, e := range entries {
+		if e.IsDir() {
+			removeWatermarks(filepath.Join(root, e.Name()), fileName, "")
+		}
+	}
+}
+
+// removeWatermarks удаляет из dir копии файла fileName, кроме keep
+func removeWatermarks(dir, fileName, keep string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if name == keep || !strings.HasPrefix(name, fileName+".") || !strings.HasSuffix(name, ".pdf") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("failed to remove watermarked copy %s: %v", name, err)
+		}
+	}
+}
+
+// filialName возвращает название филиала для водяного знака, а если его нет в справочнике - ID
+func (h *UserHandler) filialName(id string) string {
+	if f, err := h.store.Filials().Get(id); err == nil && f.Name != "" {
+		return f.Name
+	}
+	return id
+}
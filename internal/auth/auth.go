@@ -2,199 +2,342 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"myapp/internal/models"
+	"myapp/internal/storage"
 )
 
-// JSONUserStorage реализует UserStorage для хранения в JSON
-type JSONUserStorage struct {
-	filePath string
-	mu       sync.Mutex
-	users    []models.User // Кэш пользователей в памяти
-}
-
-type usersFile struct {
-	Users []models.User `json:"users"`
-}
-
-// NewJSONUserStorage создает новое JSON хранилище пользователей
-func NewJSONUserStorage(filePath string) *JSONUserStorage {
-	storage := &JSONUserStorage{
-		filePath: filePath,
-	}
-	// Загружаем пользователей при инициализации
-	err := storage.loadUsers()
-	if err != nil {
-		return nil
-	}
-	return storage
-}
-
 // UserStorage определяет интерфейс для работы с пользователями
-type UserStorage interface {
-	CreateUser(user models.User) error
-	GetUserByLogin(login string) (models.User, error)
-	GetUserByID(id string) (models.User, error)
-	GetAllUsers() ([]models.User, error)
-	SaveAllUsers(users []models.User) error
-	UpdateUserData(user models.User) interface{}
-}
+type UserStorage = storage.UserRepository
+
+const (
+	defaultAccessTokenTTL   = 15 * time.Minute
+	defaultRefreshTokenTTL  = 30 * 24 * time.Hour
+	defaultPasswordResetTTL = 24 * time.Hour
+	defaultTOTPIssuer       = "myapp"
+	defaultIssuer           = "myapp"
+	defaultAudience         = "myapp-api"
+
+	// clockSkew - допустимое расхождение часов при проверке exp, nbf и iat
+	clockSkew = 30 * time.Second
+)
+
+// ErrResetCodeExpired возвращается при входе по верному, но просроченному коду сброса пароля
+var ErrResetCodeExpired = errors.New("password reset code has expired")
 
 // AuthService предоставляет методы аутентификации
 type AuthService struct {
-	UserStorage UserStorage
-	jwtKey      []byte // Добавьте это поле
+	UserStorage      UserStorage
+	Sessions         SessionStore
+	AccessTokenTTL   time.Duration // время жизни access-токена
+	RefreshTokenTTL  time.Duration // время жизни сессии (refresh-токена)
+	PasswordResetTTL time.Duration // срок действия кода сброса пароля
+	TwoFactor        storage.TwoFactorRepository
+	TOTPIssuer       string // название сервиса в приложении-аутентификаторе
+	Issuer           string // claim iss выдаваемых токенов
+	Audience         string // claim aud выдаваемых токенов
+	keys             *KeyRing
+
+	challenges  challenges // входы, ожидающие второго фактора
+	twoFactorMu sync.Mutex // чтение-изменение-запись настроек второго фактора
 }
 
 // NewAuthService создает новый экземпляр AuthService
-func NewAuthService(storage UserStorage, jwtKey []byte) *AuthService {
+func NewAuthService(storage UserStorage, sessions SessionStore, twoFactor storage.TwoFactorRepository, keys *KeyRing) *AuthService {
 	return &AuthService{
-		UserStorage: storage,
-		jwtKey:      jwtKey, // Инициализируем поле
+		UserStorage:      storage,
+		Sessions:         sessions,
+		AccessTokenTTL:   defaultAccessTokenTTL,
+		RefreshTokenTTL:  defaultRefreshTokenTTL,
+		PasswordResetTTL: defaultPasswordResetTTL,
+		TwoFactor:        twoFactor,
+		TOTPIssuer:       defaultTOTPIssuer,
+		Issuer:           defaultIssuer,
+		Audience:         defaultAudience,
+		keys:             keys,
+		challenges:       challenges{pending: map[string]*pendingLogin{}},
 	}
 }
 
-func (s *JSONUserStorage) loadUsers() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	data, err := os.ReadFile(s.filePath)
+// Register регистрирует нового пользователя, сохраняя хеш пароля
+func (s *AuthService) Register(user models.User) error {
+	hash, err := HashPassword(user.Password)
 	if err != nil {
-		if os.IsNotExist(err) {
-			s.users = []models.User{}
-			return nil
-		}
 		return err
 	}
-
-	var file usersFile
-	if err := json.Unmarshal(data, &file); err != nil {
-		return err
-	}
-
-	s.users = file.Users
-	return nil
+	user.Password = hash
+	return s.UserStorage.CreateUser(user)
 }
 
-func (s *JSONUserStorage) saveUsers() error {
-	data, err := json.MarshalIndent(usersFile{Users: s.users}, "", "  ")
+// Login выполняет аутентификацию пользователя и открывает новую сессию.
+// Если у пользователя включён второй фактор, сессия не открывается:
+// вместо токенов возвращается вызов, который завершает CompleteLogin.
+func (s *AuthService) Login(login, password string) (TokenPair, models.User, *Challenge, error) {
+	// Несуществующий логин и неверный пароль неотличимы ни по ответу, ни по времени
+	user, err := s.UserStorage.GetUserByLogin(login)
 	if err != nil {
-		return err
+		checkPassword(dummyHash(), password)
+		return TokenPair{}, models.User{}, nil, ErrInvalidCredentials
 	}
 
-	return os.WriteFile(s.filePath, data, 0644)
-}
+	ok, needsRehash := checkPassword(user.Password, password)
+	if !ok {
+		return TokenPair{}, models.User{}, nil, ErrInvalidCredentials
+	}
+	// Замороженный или удалённый пользователь не получает ни сессии, ни вызова второго шага
+	if user.Status != models.StatusActive {
+		return TokenPair{}, models.User{}, nil, ErrAccountInactive
+	}
+	if resetExpired(user, time.Now()) {
+		return TokenPair{}, models.User{}, nil, ErrResetCodeExpired
+	}
 
-// GetAllUsers возвращает всех пользователей
-func (s *JSONUserStorage) GetAllUsers() ([]models.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.users, nil
-}
+	// Старые записи с паролем открытым текстом переводим на хеш при первом входе
+	if needsRehash {
+		if err := s.rehashPassword(user.ID, password); err != nil {
+			log.Printf("failed to upgrade password hash for user %s: %v", user.ID, err)
+		}
+	}
 
-func (s *JSONUserStorage) GetUserByID(id string) (models.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// Очищаем пароль перед возвратом
+	user.Password = ""
 
-	for _, user := range s.users {
-		if user.ID == id {
-			return user, nil
+	enabled, err := s.twoFactorEnabled(user.ID)
+	if err != nil {
+		return TokenPair{}, models.User{}, nil, err
+	}
+	if enabled {
+		challenge, err := s.newChallenge(user)
+		if err != nil {
+			return TokenPair{}, models.User{}, nil, err
 		}
+		return TokenPair{}, user, challenge, nil
 	}
 
-	return models.User{}, os.ErrNotExist
+	tokens, err := s.startSession(user)
+	if err != nil {
+		return TokenPair{}, models.User{}, nil, err
+	}
+	return tokens, user, nil, nil
 }
 
-// CreateUser создает нового пользователя
-func (s *JSONUserStorage) CreateUser(user models.User) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Refresh обменивает refresh-токен на новую пару токенов (ротация).
+// Предъявление уже ротированного токена отзывает всю сессию.
+func (s *AuthService) Refresh(refreshToken string) (TokenPair, models.User, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return TokenPair{}, models.User{}, ErrSessionNotFound
+	}
 
-	for _, u := range s.users {
-		if u.Login == user.Login {
-			return fmt.Errorf("user with login %s already exists", user.Login)
+	newSecret, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, models.User{}, err
+	}
+	session, err := s.Sessions.RotateSession(sessionID, hashToken(secret), hashToken(newSecret), time.Now())
+	if err != nil {
+		return TokenPair{}, models.User{}, err
+	}
+
+	user, err := s.UserStorage.GetUserByID(session.UserID)
+	if err != nil {
+		return TokenPair{}, models.User{}, errors.New("user not found")
+	}
+	if user.Status != models.StatusActive {
+		if err := s.Sessions.RevokeSession(session.ID); err != nil {
+			log.Printf("failed to revoke session %s of inactive user: %v", session.ID, err)
 		}
+		return TokenPair{}, models.User{}, ErrSessionRevoked
+	}
+
+	accessToken, err := s.generateToken(user, session.ID)
+	if err != nil {
+		return TokenPair{}, models.User{}, err
 	}
 
-	s.users = append(s.users, user)
-	return s.saveUsers()
+	user.Password = ""
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: session.ID + "." + newSecret,
+		ExpiresIn:    int64(s.AccessTokenTTL / time.Second),
+	}, user, nil
 }
 
-// GetUserByLogin возвращает пользователя по логину
-func (s *JSONUserStorage) GetUserByLogin(login string) (models.User, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Logout отзывает текущую сессию
+func (s *AuthService) Logout(sessionID string) error {
+	return s.Sessions.RevokeSession(sessionID)
+}
 
-	for _, user := range s.users {
-		if user.Login == login {
-			return user, nil
-		}
-	}
+// RevokeUserSessions отзывает все сессии пользователя
+func (s *AuthService) RevokeUserSessions(userID string) (int, error) {
+	return s.Sessions.RevokeUserSessions(userID)
+}
 
-	return models.User{}, os.ErrNotExist
+// RevokeAllSessions отзывает сессии всех пользователей
+func (s *AuthService) RevokeAllSessions() (int, error) {
+	return s.Sessions.RevokeAllSessions()
 }
 
-// GetUserByID возвращает пользователя по ID
-func (s *JSONUserStorage) readUsers() (map[string]models.User, error) {
-	data, err := os.ReadFile(s.filePath)
+// ChangePassword меняет пароль пользователя по текущему паролю (или коду сброса),
+// снимает требование смены пароля и отзывает все сессии. Возвращает пару токенов
+// новой сессии, чтобы пользователь остался в системе.
+func (s *AuthService) ChangePassword(userID, current, next string) (TokenPair, models.User, error) {
+	user, err := s.UserStorage.GetUserByID(userID)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return make(map[string]models.User), nil
-		}
-		return nil, err
+		return TokenPair{}, models.User{}, err
+	}
+
+	if ok, _ := checkPassword(user.Password, current); !ok {
+		return TokenPair{}, models.User{}, ErrInvalidCredentials
+	}
+	if resetExpired(user, time.Now()) {
+		return TokenPair{}, models.User{}, ErrResetCodeExpired
+	}
+	if next == current {
+		return TokenPair{}, models.User{}, fmt.Errorf("%w: must differ from the current password", ErrWeakPassword)
+	}
+	if err := CheckPasswordStrength(next, user.Login); err != nil {
+		return TokenPair{}, models.User{}, err
 	}
 
-	var users map[string]models.User
-	if err := json.Unmarshal(data, &users); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal user data: %v", err)
+	hash, err := HashPassword(next)
+	if err != nil {
+		return TokenPair{}, models.User{}, err
+	}
+	user.Password = hash
+	user.MustChangePassword = false
+	user.ResetExpiresAt = 0
+	if err := s.UserStorage.UpdateUser(user); err != nil {
+		return TokenPair{}, models.User{}, err
+	}
+
+	// Украденные токены не переживают смену пароля
+	if _, err := s.Sessions.RevokeUserSessions(user.ID); err != nil {
+		return TokenPair{}, models.User{}, err
+	}
+	tokens, err := s.startSession(user)
+	if err != nil {
+		return TokenPair{}, models.User{}, err
 	}
 
-	return users, nil
+	user.Password = ""
+	return tokens, user, nil
 }
 
-func (s *JSONUserStorage) writeUsers(users map[string]models.User) error {
-	data, err := json.MarshalIndent(users, "", "  ")
+// ResetPassword заменяет пароль пользователя одноразовым кодом сброса,
+// действующим PasswordResetTTL, и отзывает все его сессии. После входа по коду
+// пользователь должен сменить пароль. Возвращает обновлённого пользователя и код.
+func (s *AuthService) ResetPassword(userID string) (models.User, string, error) {
+	user, err := s.UserStorage.GetUserByID(userID)
 	if err != nil {
-		return err
+		return models.User{}, "", err
+	}
+
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return models.User{}, "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	hash, err := HashPassword(code)
+	if err != nil {
+		return models.User{}, "", err
+	}
+	user.Password = hash
+	user.MustChangePassword = true
+	user.ResetExpiresAt = time.Now().Add(s.PasswordResetTTL).UnixMilli()
+	if err := s.UserStorage.UpdateUser(user); err != nil {
+		return models.User{}, "", err
 	}
 
-	return os.WriteFile(s.filePath, data, 0644)
+	if _, err := s.Sessions.RevokeUserSessions(user.ID); err != nil {
+		return models.User{}, "", err
+	}
+	return user, code, nil
 }
 
-// Register регистрирует нового пользователя
-func (s *AuthService) Register(user models.User) error {
-	return s.UserStorage.CreateUser(user)
+// resetExpired сообщает, что пароль пользователя - просроченный код сброса
+func resetExpired(user models.User, now time.Time) bool {
+	return user.ResetExpiresAt != 0 && now.UnixMilli() > user.ResetExpiresAt
 }
 
-// Login выполняет аутентификацию пользователя и возвращает токен
-func (s *AuthService) Login(login, password string) (string, models.User, error) {
-	user, err := s.UserStorage.GetUserByLogin(login)
+// startSession создает серверную сессию и выдает для неё пару токенов
+func (s *AuthService) startSession(user models.User) (TokenPair, error) {
+	sessionID, err := randomToken(16)
 	if err != nil {
-		return "", models.User{}, errors.New("user not found")
+		return TokenPair{}, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, err
 	}
 
-	// Заменяем проверку хеша на прямое сравнение
-	if user.Password != password {
-		return "", models.User{}, errors.New("invalid credentials")
+	now := time.Now()
+	session := Session{
+		ID:          sessionID,
+		UserID:      user.ID,
+		RefreshHash: hashToken(secret),
+		CreatedAt:   now,
+		LastUsedAt:  now,
+		ExpiresAt:   now.Add(s.RefreshTokenTTL),
+	}
+	if err := s.Sessions.CreateSession(session); err != nil {
+		return TokenPair{}, err
 	}
 
-	token, err := s.generateToken(user.ID, user.Login)
+	accessToken, err := s.generateToken(user, sessionID)
 	if err != nil {
-		return "", models.User{}, err
+		return TokenPair{}, err
 	}
 
-	// Очищаем пароль перед возвратом
-	user.Password = ""
-	return token, user, nil
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: sessionID + "." + secret,
+		ExpiresIn:    int64(s.AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// randomToken возвращает случайную строку из n байт в base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken хеширует секрет refresh-токена для хранения
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// rehashPassword заменяет сохранённый пароль пользователя на свежий хеш
+func (s *AuthService) rehashPassword(userID, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.UserStorage.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hash
+	return s.UserStorage.UpdateUser(user)
 }
 
 // AuthMiddleware проверяет JWT токен и статус пользователя
@@ -212,29 +355,25 @@ func (s *AuthService) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return s.jwtKey, nil
-		})
-
+		claims, err := s.parseToken(parts[1])
 		if err != nil {
 			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		if !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
-
 		userID := claims.Subject
 		if userID == "" {
 			http.Error(w, "Invalid token claims: missing sub", http.StatusUnauthorized)
 			return
 		}
 
+		// Токен действителен только пока жива его сессия
+		session, err := s.Sessions.GetSession(claims.SessionID)
+		if err != nil || session.UserID != userID || !session.Active(time.Now()) {
+			http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+			return
+		}
+
 		user, err := s.UserStorage.GetUserByID(userID)
 		if err != nil {
 			http.Error(w, "User not found", http.StatusUnauthorized)
@@ -245,11 +384,35 @@ func (s *AuthService) AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "User is not active", http.StatusForbidden)
 			return
 		}
+
+		// Права берутся из хранилища; токен со старой ролью больше не принимается
+		if claims.Role != string(user.Role) {
+			http.Error(w, "Token role is out of date", http.StatusUnauthorized)
+			return
+		}
 		ctx := context.WithValue(r.Context(), "user", user)
+		ctx = context.WithValue(ctx, "sessionID", session.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// PasswordChangedMiddleware пропускает запрос, только если пользователю не нужно
+// сменить пароль. Ставится после AuthMiddleware на все маршруты, кроме смены пароля и выхода.
+func (s *AuthService) PasswordChangedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(models.User)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if user.MustChangePassword {
+			http.Error(w, "Password change required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // RoleMiddleware проверяет роль пользователя
 func (s *AuthService) RoleMiddleware(requiredRole models.UserRole) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -264,90 +427,47 @@ func (s *AuthService) RoleMiddleware(requiredRole models.UserRole) func(http.Han
 	}
 }
 
-// generateToken создает JWT токен
-func (s *AuthService) generateToken(userID, login string) (string, error) {
+// generateToken создает JWT токен сессии sessionID
+func (s *AuthService) generateToken(user models.User, sessionID string) (string, error) {
+	now := time.Now()
 	claims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Subject:   userID,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			Issuer:    s.Issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{s.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.AccessTokenTTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
-		Login: login,
+		Login:     user.Login,
+		Role:      string(user.Role),
+		SessionID: sessionID,
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtKey)
+	return s.keys.sign(claims)
 }
 
-func (s *AuthService) validateToken(tokenString string) (jwt.MapClaims, error) {
-	// Добавляем проверку алгоритма подписи
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtKey, nil
-	})
-
+// parseToken проверяет подпись (ключ по kid и его алгоритм), срок действия,
+// iss, aud, iat и nbf токена и возвращает его claims
+func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.keyfunc,
+		jwt.WithValidMethods(s.keys.methods()),
+		jwt.WithIssuer(s.Issuer),
+		jwt.WithAudience(s.Audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+		return nil, err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	if !token.Valid {
+		return nil, errors.New("invalid token")
 	}
-
-	return nil, errors.New("invalid token")
-}
-
-// SaveAllUsers сохраняет всех пользователей
-func (s *JSONUserStorage) SaveAllUsers(users []models.User) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.users = users
-	return s.saveUsers()
+	return claims, nil
 }
 
-func (s *JSONUserStorage) UpdateUserData(user models.User) interface{} {
-	// 1. Читаем файл
-	data, err := os.ReadFile(s.filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
-	}
-
-	// 2. Парсим как объект с полем "users"
-	var fileData struct {
-		Users []models.User `json:"users"`
-	}
-
-	if len(data) > 0 {
-		if err := json.Unmarshal(data, &fileData); err != nil {
-			return fmt.Errorf("failed to unmarshal user data: %v", err)
-		}
-	}
-
-	// 3. Ищем пользователя и обновляем
-	found := false
-	for i, u := range fileData.Users {
-		if u.ID == user.ID {
-			fileData.Users[i] = user
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return fmt.Errorf("user with ID %s not found", user.ID)
-	}
-
-	// 4. Сохраняем обратно в файл
-	updatedData, err := json.MarshalIndent(fileData, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated data: %v", err)
-	}
-
-	if err := os.WriteFile(s.filePath, updatedData, 0644); err != nil {
-		return fmt.Errorf("failed to write updated data: %v", err)
-	}
-
-	return nil
+// JWKS возвращает открытые ключи проверки токенов
+func (s *AuthService) JWKS() JWKSet {
+	return s.keys.JWKS()
 }
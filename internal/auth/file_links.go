@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLinkInvalid = errors.New("invalid link signature")
+	ErrLinkExpired = errors.New("link has expired")
+)
+
+// LinkKey - секрет подписи ссылок на файлы с идентификатором (kid)
+type LinkKey struct {
+	ID     string
+	Secret string
+}
+
+// FileLinks подписывает короткоживущие ссылки на файлы уроков, чтобы
+// браузер мог открыть PDF без bearer-токена. Ссылка выдаётся конкретному
+// пользователю и действует TTL. Ключи ссылок не связаны с ключами токенов;
+// подпись начинается с kid, поэтому ключ можно сменить, оставив прежний
+// для проверки ещё не истёкших ссылок.
+type FileLinks struct {
+	TTL     time.Duration
+	signing string
+	keys    map[string][]byte
+}
+
+// NewFileLinks создаёт подписчика ссылок; подписывает ключ signingID.
+// Ключи выводятся из секретов, чтобы подпись ссылки нельзя было использовать
+// как подпись токена и наоборот, даже если секрет у них общий.
+func NewFileLinks(signingID string, keys []LinkKey, ttl time.Duration) (*FileLinks, error) {
+	links := &FileLinks{TTL: ttl, signing: signingID, keys: map[string][]byte{}}
+	for _, k := range keys {
+		switch {
+		case k.ID == "":
+			return nil, errors.New("file link key without id")
+		case k.Secret == "":
+			return nil, fmt.Errorf("file link key %q has no secret", k.ID)
+		}
+		if _, ok := links.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate file link key id %q", k.ID)
+		}
+		mac := hmac.New(sha256.New, []byte(k.Secret))
+		mac.Write([]byte("file-links"))
+		links.keys[k.ID] = mac.Sum(nil)
+	}
+	if _, ok := links.keys[signingID]; !ok {
+		return nil, fmt.Errorf("file link key %q is not configured", signingID)
+	}
+	return links, nil
+}
+
+// Sign возвращает срок действия и подпись ссылки на fileName для userID
+func (l *FileLinks) Sign(fileName, userID string, now time.Time) (expires int64, sig string) {
+	expires = now.Add(l.TTL).Unix()
+	return expires, l.signing + "." + l.sign(l.keys[l.signing], fileName, userID, expires)
+}
+
+// Verify проверяет подпись и срок действия ссылки
+func (l *FileLinks) Verify(fileName, userID string, expires int64, sig string, now time.Time) error {
+	// kid может содержать точку, а base64url-подпись - нет
+	i := strings.LastIndexByte(sig, '.')
+	if i < 0 {
+		return ErrLinkInvalid
+	}
+	key, ok := l.keys[sig[:i]]
+	if !ok {
+		return ErrLinkInvalid
+	}
+	want := l.sign(key, fileName, userID, expires)
+	if !hmac.Equal([]byte(sig[i+1:]), []byte(want)) {
+		return ErrLinkInvalid
+	}
+	if now.Unix() > expires {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+func (l *FileLinks) sign(key []byte, fileName, userID string, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fileName + "\n" + userID + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Алгоритмы подписи токенов
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSABits - минимальный размер ключа RS256
+const minRSABits = 2048
+
+// KeySpec описывает ключ подписи токенов. HS256 использует Secret;
+// RS256 и EdDSA - PEM-файл закрытого ключа (PKCS#8, для RSA также PKCS#1),
+// а ключ, которым больше не подписывают, можно задать только открытым
+// ключом (PKIX) - тогда он лишь проверяет ещё не истёкшие токены.
+type KeySpec struct {
+	ID             string
+	Alg            string
+	Secret         string
+	PrivateKeyFile string
+	PublicKeyFile  string
+}
+
+// signingKey - ключ из связки; sign пуст у ключа, который только проверяет подписи
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+// KeyRing - ключи подписи токенов по идентификатору (kid). Новые токены
+// подписываются одним ключом, проверяются - любым ключом связки, что позволяет
+// менять ключи без разлогинивания: новый ключ добавляется и становится
+// подписывающим, старый остаётся для проверки, пока не истекут его токены.
+type KeyRing struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+	ids     []string // порядок из настроек
+}
+
+// NewKeyRing загружает ключи specs; подписывает ключ signingID
+func NewKeyRing(signingID string, specs []KeySpec) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]*signingKey{}}
+	for _, spec := range specs {
+		if spec.ID == "" {
+			return nil, errors.New("signing key without id")
+		}
+		if _, ok := ring.keys[spec.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key id %q", spec.ID)
+		}
+		key, err := loadKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", spec.ID, err)
+		}
+		ring.keys[spec.ID] = key
+		ring.ids = append(ring.ids, spec.ID)
+	}
+
+	ring.signing = ring.keys[signingID]
+	if ring.signing == nil {
+		return nil, fmt.Errorf("signing key %q is not configured", signingID)
+	}
+	if ring.signing.sign == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingID)
+	}
+	return ring, nil
+}
+
+func loadKey(spec KeySpec) (*signingKey, error) {
+	key := &signingKey{id: spec.ID}
+	switch spec.Alg {
+	case AlgHS256:
+		if spec.Secret == "" {
+			return nil, errors.New("HS256 key requires a secret")
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign, key.verify = []byte(spec.Secret), []byte(spec.Secret)
+		return key, nil
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", spec.Alg)
+	}
+
+	switch {
+	case spec.PrivateKeyFile != "":
+		block, err := readPEM(spec.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var private any
+		if block.Type == "RSA PRIVATE KEY" {
+			private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", spec.PrivateKeyFile, err)
+		}
+		switch k := private.(type) {
+		case *rsa.PrivateKey:
+			key.sign, key.verify = k, &k.PublicKey
+		case ed25519.PrivateKey:
+			key.sign, key.verify = k, k.Public()
+		}
+	case spec.PublicKeyFile != "":
+		block, err := readPEM(spec.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", spec.PublicKeyFile, err)
+		}
+		key.verify = public
+	default:
+		return nil, fmt.Errorf("%s key requires privateKeyFile or publicKeyFile", spec.Alg)
+	}
+
+	// Тип ключа из файла должен соответствовать заявленному алгоритму
+	switch k := key.verify.(type) {
+	case *rsa.PublicKey:
+		if spec.Alg != AlgRS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", spec.Alg)
+		}
+		if k.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+	case ed25519.PublicKey:
+		if spec.Alg != AlgEdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", spec.Alg)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.verify)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	return block, nil
+}
+
+// sign подписывает claims подписывающим ключом и указывает его kid в заголовке
+func (k *KeyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.sign)
+}
+
+// keyfunc выбирает ключ проверки по kid. Алгоритм токена должен совпадать
+// с алгоритмом ключа: иначе открытый ключ RS256 мог бы сойти за секрет HS256.
+func (k *KeyRing) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.verify, nil
+}
+
+// methods возвращает алгоритмы ключей связки
+func (k *KeyRing) methods() []string {
+	var result []string
+	for _, id := range k.ids {
+		result = append(result, k.keys[id].method.Alg())
+	}
+	return result
+}
+
+// JWK - открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"` // OKP
+	X   string `json:"x,omitempty"`   // OKP
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+}
+
+// JWKSet - набор открытых ключей для /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает открытые ключи связки. Ключи HS256 секретны и не публикуются.
+func (k *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding.EncodeToString
+	for _, id := range k.ids {
+		key := k.keys[id]
+		jwk := JWK{Kid: id, Alg: key.method.Alg(), Use: "sig"}
+		switch public := key.verify.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv, jwk.X = "OKP", "Ed25519", b64(public)
+		case *rsa.PublicKey:
+			jwk.Kty, jwk.N, jwk.E = "RSA", b64(public.N.Bytes()), b64(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"myapp/internal/models"
+)
+
+const testHSSecret = "0123456789abcdef0123456789abcdef"
+
+var testUser = models.User{ID: "u1", Login: "ivan", Role: models.RoleUser, Status: models.StatusActive}
+
+// writeKeyFiles сохраняет закрытый (PKCS#8) и открытый (PKIX) ключи в PEM-файлы
+func writeKeyFiles(t *testing.T, name string, private any) (privateFile, publicFile string, publicPEM []byte) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public any
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		public = &k.PublicKey
+	case ed25519.PrivateKey:
+		public = k.Public()
+	}
+	pub, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	privateFile = filepath.Join(dir, name+".pem")
+	publicFile = filepath.Join(dir, name+".pub.pem")
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+	if err := os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicFile, publicPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privateFile, publicFile, publicPEM
+}
+
+func newRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeyService(t *testing.T, signingID string, specs ...KeySpec) *AuthService {
+	t.Helper()
+	ring, err := NewKeyRing(signingID, specs)
+	if err != nil {
+		t.Fatalf("NewKeyRing = %v", err)
+	}
+	return NewAuthService(nil, nil, nil, ring)
+}
+
+// forgeToken подписывает claims пользователя произвольным алгоритмом и kid
+func forgeToken(t *testing.T, s *AuthService, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer,
+			Subject:   testUser.ID,
+			Audience:  jwt.ClaimStrings{s.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Login: testUser.Login,
+		Role:  string(testUser.Role),
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// TestKeyRingAlgorithms: токены каждого алгоритма подписываются ключом с kid
+// и проверяются той же связкой
+func TestKeyRingAlgorithms(t *testing.T) {
+	rsaFile, _, _ := writeKeyFiles(t, "rsa", newRSAKey(t, 2048))
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edFile, _, _ := writeKeyFiles(t, "ed", edPrivate)
+
+	specs := []KeySpec{
+		{ID: "hs", Alg: AlgHS256, Secret: testHSSecret},
+		{ID: "rs", Alg: AlgRS256, PrivateKeyFile: rsaFile},
+		{ID: "ed", Alg: AlgEdDSA, PrivateKeyFile: edFile},
+	}
+	for _, spec := range specs {
+		s := newKeyService(t, spec.ID, specs...)
+		token, err := s.generateToken(testUser, "s1")
+		if err != nil {
+			t.Fatalf("%s: generateToken = %v", spec.ID, err)
+		}
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+		if err != nil || parsed.Header["kid"] != spec.ID || parsed.Method.Alg() != spec.Alg {
+			t.Errorf("%s: token header = %v, %v", spec.ID, parsed.Header, err)
+		}
+		claims, err := s.parseToken(token)
+		if err != nil || claims.Subject != testUser.ID || claims.SessionID != "s1" {
+			t.Errorf("%s: parseToken = %+v, %v", spec.ID, claims, err)
+		}
+	}
+
+	// Секрет HS256 не публикуется
+	jwks := newKeyService(t, "hs", specs...).JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "rs" || jwks.Keys[0].Kty != "RSA" || jwks.Keys[1].Kid != "ed" || jwks.Keys[1].Crv != "Ed25519" {
+		t.Errorf("JWKS = %+v, want the RSA and Ed25519 keys only", jwks.Keys)
+	}
+}
+
+// TestKeyRingRotation: токен старого ключа проверяется, пока ключ в связке,
+// и отклоняется после его удаления
+func TestKeyRingRotation(t *testing.T) {
+	oldKey := KeySpec{ID: "2025", Alg: AlgHS256, Secret: testHSSecret}
+	newKey := KeySpec{ID: "2026", Alg: AlgHS256, Secret: testHSSecret + "-next"}
+
+	token, err := newKeyService(t, "2025", oldKey).generateToken(testUser, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newKeyService(t, "2026", oldKey, newKey).parseToken(token); err != nil {
+		t.Errorf("token of the previous key = %v, want accepted", err)
+	}
+	if _, err := newKeyService(t, "2026", newKey).parseToken(token); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("token of a removed key = %v, want an unknown key error", err)
+	}
+}
+
+// TestKeyRingRejects: неизвестный kid, чужой для ключа алгоритм, подпись
+// открытым ключом RS256 как секретом HS256 и alg none не принимаются
+func TestKeyRingRejects(t *testing.T) {
+	rsaPrivate := newRSAKey(t, 2048)
+	rsaFile, _, publicPEM := writeKeyFiles(t, "rsa", rsaPrivate)
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newKeyService(t, "rs",
+		KeySpec{ID: "rs", Alg: AlgRS256, PrivateKeyFile: rsaFile},
+		KeySpec{ID: "hs", Alg: AlgHS256, Secret: testHSSecret},
+	)
+
+	if _, err := s.parseToken(forgeToken(t, s, jwt.SigningMethodRS256, "rs", rsaPrivate)); err != nil {
+		t.Fatalf("hand-signed RS256 token = %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"unknown kid":          forgeToken(t, s, jwt.SigningMethodHS256, "other", []byte(testHSSecret)),
+		"missing kid":          forgeToken(t, s, jwt.SigningMethodHS256, "", []byte(testHSSecret)),
+		"HS256 with RSA kid":   forgeToken(t, s, jwt.SigningMethodHS256, "rs", []byte(testHSSecret)),
+		"RS256 with HS256 kid": forgeToken(t, s, jwt.SigningMethodRS256, "hs", rsaPrivate),
+		"public PEM as secret": forgeToken(t, s, jwt.SigningMethodHS256, "rs", publicPEM),
+		"public DER as secret": forgeToken(t, s, jwt.SigningMethodHS256, "rs", publicDER),
+		"alg none":             forgeToken(t, s, jwt.SigningMethodNone, "rs", jwt.UnsafeAllowNoneSignatureType),
+		"other RSA key":        forgeToken(t, s, jwt.SigningMethodRS256, "rs", newRSAKey(t, 2048)),
+	} {
+		if claims, err := s.parseToken(token); err == nil {
+			t.Errorf("%s: parseToken accepted %+v", name, claims)
+		}
+	}
+}
+
+// TestNewKeyRingErrors: ключ не загружается, если файл не подходит к алгоритму
+// или подписывающему ключу нечем подписывать
+func TestNewKeyRingErrors(t *testing.T) {
+	rsaFile, rsaPublic, _ := writeKeyFiles(t, "rsa", newRSAKey(t, 2048))
+	shortFile, _, _ := writeKeyFiles(t, "short", newRSAKey(t, 1024))
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edFile, _, _ := writeKeyFiles(t, "ed", edPrivate)
+
+	for name, tc := range map[string]struct {
+		signing string
+		specs   []KeySpec
+		want    string
+	}{
+		"RSA key as EdDSA":   {"k", []KeySpec{{ID: "k", Alg: AlgEdDSA, PrivateKeyFile: rsaFile}}, "RSA key cannot be used"},
+		"Ed25519 as RS256":   {"k", []KeySpec{{ID: "k", Alg: AlgRS256, PrivateKeyFile: edFile}}, "Ed25519 key cannot be used"},
+		"short RSA key":      {"k", []KeySpec{{ID: "k", Alg: AlgRS256, PrivateKeyFile: shortFile}}, "at least 2048 bits"},
+		"public key signing": {"k", []KeySpec{{ID: "k", Alg: AlgRS256, PublicKeyFile: rsaPublic}}, "has no private key"},
+		"no key file":        {"k", []KeySpec{{ID: "k", Alg: AlgRS256}}, "requires privateKeyFile"},
+		"HS256 no secret":    {"k", []KeySpec{{ID: "k", Alg: AlgHS256}}, "requires a secret"},
+		"unknown algorithm":  {"k", []KeySpec{{ID: "k", Alg: "HS512", Secret: testHSSecret}}, "unsupported algorithm"},
+		"missing id":         {"k", []KeySpec{{Alg: AlgHS256, Secret: testHSSecret}}, "without id"},
+		"duplicate id":       {"k", []KeySpec{{ID: "k", Alg: AlgHS256, Secret: testHSSecret}, {ID: "k", Alg: AlgHS256, Secret: testHSSecret}}, "duplicate"},
+		"unknown signing id": {"x", []KeySpec{{ID: "k", Alg: AlgHS256, Secret: testHSSecret}}, "is not configured"},
+	} {
+		if _, err := NewKeyRing(tc.signing, tc.specs); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: NewKeyRing = %v, want %q", name, err, tc.want)
+		}
+	}
+
+	// Открытый ключ годится для проверки, если подписывает другой ключ
+	if _, err := NewKeyRing("hs", []KeySpec{{ID: "hs", Alg: AlgHS256, Secret: testHSSecret}, {ID: "old", Alg: AlgRS256, PublicKeyFile: rsaPublic}}); err != nil {
+		t.Errorf("NewKeyRing with a verify-only key = %v", err)
+	}
+}
+
+// TestFileLinks: подпись ссылки привязана к файлу, пользователю и сроку
+func TestFileLinks(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	links, err := NewFileLinks("l1", []LinkKey{{ID: "l1", Secret: testHSSecret}}, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expires, sig := links.Sign("lesson1.pdf", "u1", now)
+	if expires != now.Add(10*time.Minute).Unix() || !strings.HasPrefix(sig, "l1.") {
+		t.Fatalf("Sign = %d, %q", expires, sig)
+	}
+	if err := links.Verify("lesson1.pdf", "u1", expires, sig, now.Add(10*time.Minute)); err != nil {
+		t.Errorf("Verify at expiry = %v", err)
+	}
+	if err := links.Verify("lesson1.pdf", "u1", expires, sig, now.Add(10*time.Minute+time.Second)); !errors.Is(err, ErrLinkExpired) {
+		t.Errorf("Verify after expiry = %v, want ErrLinkExpired", err)
+	}
+
+	tampered := []byte(sig)
+	tampered[len(tampered)-1] ^= 1
+	for name, tc := range map[string]struct {
+		file, user string
+		expires    int64
+		sig        string
+	}{
+		"other file":      {"lesson2.pdf", "u1", expires, sig},
+		"other user":      {"lesson1.pdf", "u2", expires, sig},
+		"extended expiry": {"lesson1.pdf", "u1", expires + 3600, sig},
+		"tampered sig":    {"lesson1.pdf", "u1", expires, string(tampered)},
+		"unknown kid":     {"lesson1.pdf", "u1", expires, "l2" + sig[2:]},
+		"no kid":          {"lesson1.pdf", "u1", expires, sig[3:]},
+		"empty":           {"lesson1.pdf", "u1", expires, ""},
+		"earlier expiry":  {"lesson1.pdf", "u1", expires - 3600, sig},
+	} {
+		if err := links.Verify(tc.file, tc.user, tc.expires, tc.sig, now); !errors.Is(err, ErrLinkInvalid) {
+			t.Errorf("%s: Verify = %v, want ErrLinkInvalid", name, err)
+		}
+	}
+
+	// После смены ключа старые ссылки действуют, пока старый ключ в списке
+	rotated, err := NewFileLinks("l.2", []LinkKey{{ID: "l1", Secret: testHSSecret}, {ID: "l.2", Secret: "next secret"}}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rotated.Verify("lesson1.pdf", "u1", expires, sig, now); err != nil {
+		t.Errorf("link of the previous key = %v", err)
+	}
+	expires2, sig2 := rotated.Sign("lesson1.pdf", "u1", now)
+	if err := rotated.Verify("lesson1.pdf", "u1", expires2, sig2, now); err != nil {
+		t.Errorf("link of a kid with a dot = %v", err)
+	}
+	if err := links.Verify("lesson1.pdf", "u1", expires2, sig2, now); !errors.Is(err, ErrLinkInvalid) {
+		t.Errorf("link of a key missing from the ring = %v, want ErrLinkInvalid", err)
+	}
+
+	// Ключ ссылок выводится из секрета: подпись не совпадает с HMAC самого секрета
+	plain := (&FileLinks{}).sign([]byte(testHSSecret), "lesson1.pdf", "u1", expires)
+	if err := links.Verify("lesson1.pdf", "u1", expires, "l1."+plain, now); !errors.Is(err, ErrLinkInvalid) {
+		t.Errorf("link signed with the raw secret = %v, want ErrLinkInvalid", err)
+	}
+}
+
+// TestNewFileLinksErrors: ключи ссылок проверяются при создании
+func TestNewFileLinksErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		signing string
+		keys    []LinkKey
+	}{
+		"missing id":     {"l1", []LinkKey{{Secret: "s"}}},
+		"missing secret": {"l1", []LinkKey{{ID: "l1"}}},
+		"duplicate id":   {"l1", []LinkKey{{ID: "l1", Secret: "a"}, {ID: "l1", Secret: "b"}}},
+		"unknown signer": {"l2", []LinkKey{{ID: "l1", Secret: "a"}}},
+	} {
+		if _, err := NewFileLinks(tc.signing, tc.keys, time.Minute); err == nil {
+			t.Errorf("%s: NewFileLinks succeeded", name)
+		}
+	}
+}
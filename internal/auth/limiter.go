@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTrackedKeys - после стольких отслеживаемых логинов и адресов устаревшие записи вычищаются
+const maxTrackedKeys = 10000
+
+// maxAttemptTime - резерв попытки, которую так и не завершили, снимается через это время
+const maxAttemptTime = time.Minute
+
+// LoginLimits - пороги защиты входа от перебора
+type LoginLimits struct {
+	MaxFailures   int           // неудачных попыток подряд до блокировки учётной записи
+	MaxIPFailures int           // неудачных попыток с одного адреса до задержек для него
+	BaseDelay     time.Duration // первая задержка; каждая следующая вдвое больше
+	Lockout       time.Duration // срок блокировки и срок, через который неудачи забываются
+}
+
+// LockedAccount - логин, вход под которым временно заблокирован
+type LockedAccount struct {
+	Login       string
+	Failures    int
+	LockedUntil time.Time
+}
+
+// attempts - неудачные и идущие сейчас попытки входа по одному ключу
+type attempts struct {
+	failures     int
+	last         time.Time
+	blockedUntil time.Time
+	locked       bool      // блокировка учётной записи, а не просто задержка
+	pending      int       // попытки, разрешённые Allow и ещё не завершённые
+	reservedAt   time.Time // когда зарезервирована последняя из них
+}
+
+// LoginLimiter ограничивает частоту попыток входа по логину и по адресу клиента.
+// После каждой неудачи следующая попытка возможна только через задержку,
+// которая растёт вдвое; после MaxFailures неудач логин блокируется на Lockout.
+// Логины отслеживаются независимо от того, существует ли пользователь, чтобы
+// блокировка не выдавала существующие учётные записи. Состояние хранится в памяти.
+//
+// Allow резервирует попытку до её завершения через Fail, Succeed или Release:
+// для логина одновременно идёт не больше одной попытки, для адреса - не больше,
+// чем осталось неудач до задержек. Иначе параллельные запросы успевали бы
+// проверить пароль до того, как учтена первая неудача.
+type LoginLimiter struct {
+	limits  LoginLimits
+	mu      sync.Mutex
+	logins  map[string]*attempts
+	clients map[string]*attempts
+}
+
+// NewLoginLimiter создаёт ограничитель с порогами limits
+func NewLoginLimiter(limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{
+		limits:  limits,
+		logins:  map[string]*attempts{},
+		clients: map[string]*attempts{},
+	}
+}
+
+// Allow сообщает, можно ли сейчас проверить пароль для login с адреса ip, и
+// если можно, резервирует попытку: её нужно завершить Fail, Succeed или Release.
+// Если нельзя, возвращает время до следующей попытки.
+func (l *LoginLimiter) Allow(ip, login string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	client, account := l.get(l.clients, ip, now), l.get(l.logins, loginKey(login), now)
+	var wait time.Duration
+	for _, a := range []*attempts{client, account} {
+		if a != nil && a.blockedUntil.After(now) {
+			wait = max(wait, a.blockedUntil.Sub(now))
+		}
+	}
+	// Идущие попытки считаются будущими неудачами: результат ещё неизвестен
+	if wait == 0 && (account != nil && account.pending > 0 ||
+		client != nil && client.pending > 0 && client.failures+client.pending >= l.limits.MaxIPFailures) {
+		wait = l.limits.BaseDelay
+	}
+	if wait > 0 {
+		return wait, false
+	}
+
+	l.reserve(l.clients, ip, now)
+	l.reserve(l.logins, loginKey(login), now)
+	return 0, true
+}
+
+// Fail завершает попытку неудачей и назначает задержку. Возвращает true,
+// если этой попыткой логин оказался заблокирован.
+func (l *LoginLimiter) Fail(ip, login string, now time.Time) (locked bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+	l.release(l.clients, ip)
+	l.release(l.logins, loginKey(login))
+
+	client := l.track(l.clients, ip, now)
+	if over := client.failures - l.limits.MaxIPFailures; over >= 0 {
+		client.blockedUntil = now.Add(l.delay(over + 1))
+	}
+
+	account := l.track(l.logins, loginKey(login), now)
+	if account.failures >= l.limits.MaxFailures {
+		account.blockedUntil = now.Add(l.limits.Lockout)
+		account.locked = true
+		return true
+	}
+	account.blockedUntil = now.Add(l.delay(account.failures))
+	return false
+}
+
+// Succeed завершает попытку успехом и сбрасывает неудачи логина.
+// Счётчик адреса не сбрасывается: иначе одна своя учётная запись позволяла бы перебирать чужие.
+func (l *LoginLimiter) Succeed(ip, login string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.release(l.clients, ip)
+	delete(l.logins, loginKey(login))
+}
+
+// Release завершает попытку, которая не проверила пароль или код до конца
+// (ошибка запроса или сервера, ожидание второго фактора), не учитывая её
+func (l *LoginLimiter) Release(ip, login string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.release(l.clients, ip)
+	l.release(l.logins, loginKey(login))
+}
+
+// Reset забывает неудачи логина, например после выдачи нового пароля.
+// Идущая попытка под этим логином после этого не учитывается.
+func (l *LoginLimiter) Reset(login string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.logins, loginKey(login))
+}
+
+// Locked возвращает заблокированные сейчас логины по возрастанию
+func (l *LoginLimiter) Locked(now time.Time) []LockedAccount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := []LockedAccount{}
+	for login, a := range l.logins {
+		if a.locked && a.blockedUntil.After(now) {
+			result = append(result, LockedAccount{Login: login, Failures: a.failures, LockedUntil: a.blockedUntil})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Login < result[j].Login })
+	return result
+}
+
+// Unlock снимает блокировку и забывает неудачи логина.
+// Возвращает false, если логин не был заблокирован.
+func (l *LoginLimiter) Unlock(login string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := loginKey(login)
+	a, ok := l.logins[key]
+	if !ok || !a.locked || !a.blockedUntil.After(now) {
+		return false
+	}
+	delete(l.logins, key)
+	return true
+}
+
+// get возвращает действующую запись по ключу; забытые неудачи удаляются. Вызывается под l.mu.
+func (l *LoginLimiter) get(m map[string]*attempts, key string, now time.Time) *attempts {
+	a, ok := m[key]
+	if !ok {
+		return nil
+	}
+	if l.expired(a, now) {
+		delete(m, key)
+		return nil
+	}
+	return a
+}
+
+// entry возвращает действующую запись по ключу, создавая её. Вызывается под l.mu.
+func (l *LoginLimiter) entry(m map[string]*attempts, key string, now time.Time) *attempts {
+	a := l.get(m, key, now)
+	if a == nil {
+		a = &attempts{last: now}
+		m[key] = a
+	}
+	return a
+}
+
+// track учитывает неудачу по ключу и возвращает запись. Вызывается под l.mu.
+func (l *LoginLimiter) track(m map[string]*attempts, key string, now time.Time) *attempts {
+	a := l.entry(m, key, now)
+	a.failures++
+	a.last = now
+	return a
+}
+
+// reserve учитывает начатую попытку по ключу. Вызывается под l.mu.
+func (l *LoginLimiter) reserve(m map[string]*attempts, key string, now time.Time) {
+	a := l.entry(m, key, now)
+	a.pending++
+	a.reservedAt = now
+}
+
+// release снимает резерв попытки по ключу. Вызывается под l.mu.
+func (l *LoginLimiter) release(m map[string]*attempts, key string) {
+	if a, ok := m[key]; ok && a.pending > 0 {
+		a.pending--
+	}
+}
+
+// expired - неудачи давние, незавершённых попыток нет и запись больше ничего
+// не ограничивает. Резервы, которые так и не сняли, забываются через maxAttemptTime.
+func (l *LoginLimiter) expired(a *attempts, now time.Time) bool {
+	if a.pending > 0 && now.Sub(a.reservedAt) > maxAttemptTime {
+		a.pending = 0
+	}
+	return a.pending == 0 && !a.blockedUntil.After(now) && now.Sub(a.last) > l.limits.Lockout
+}
+
+// prune вычищает устаревшие записи, когда их становится слишком много. Вызывается под l.mu.
+func (l *LoginLimiter) prune(now time.Time) {
+	for _, m := range []map[string]*attempts{l.logins, l.clients} {
+		if len(m) < maxTrackedKeys {
+			continue
+		}
+		for key, a := range m {
+			if l.expired(a, now) {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// delay возвращает задержку после n-й неудачи: BaseDelay, 2*BaseDelay, ... не больше Lockout
+func (l *LoginLimiter) delay(n int) time.Duration {
+	d := l.limits.BaseDelay
+	for i := 1; i < n && d < l.limits.Lockout; i++ {
+		d *= 2
+	}
+	return min(d, l.limits.Lockout)
+}
+
+func loginKey(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testLimits = LoginLimits{
+	MaxFailures:   5,
+	MaxIPFailures: 20,
+	BaseDelay:     time.Second,
+	Lockout:       15 * time.Minute,
+}
+
+var limiterStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// TestLimiterConcurrentAllow: параллельные попытки под одним логином не
+// проходят Allow, пока первая не завершена
+func TestLimiterConcurrentAllow(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := l.Allow("10.0.0.1", "victim", now); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 1 {
+		t.Fatalf("%d parallel attempts allowed, want 1", n)
+	}
+
+	// Пока попытка идёт, следующая ждёт и с другого адреса
+	if wait, ok := l.Allow("10.0.0.2", "VICTIM ", now); ok || wait <= 0 {
+		t.Errorf("Allow during a pending attempt = %v, %v; want a wait", wait, ok)
+	}
+
+	// Неудача снимает резерв и назначает задержку
+	l.Fail("10.0.0.1", "victim", now)
+	if _, ok := l.Allow("10.0.0.1", "victim", now); ok {
+		t.Error("Allow right after a failure succeeded")
+	}
+	if _, ok := l.Allow("10.0.0.1", "victim", now.Add(testLimits.BaseDelay)); !ok {
+		t.Fatal("Allow after the delay was rejected")
+	}
+
+	// Release снимает резерв без учёта неудачи
+	l.Release("10.0.0.1", "victim")
+	if _, ok := l.Allow("10.0.0.1", "victim", now.Add(testLimits.BaseDelay)); !ok {
+		t.Fatal("Allow after Release was rejected")
+	}
+
+	// Успех снимает резерв и забывает неудачи
+	l.Succeed("10.0.0.1", "victim")
+	if _, ok := l.Allow("10.0.0.1", "victim", now.Add(testLimits.BaseDelay)); !ok {
+		t.Error("Allow after Succeed was rejected")
+	}
+}
+
+// TestLimiterParallelGuesses: параллельный перебор под одним логином не
+// получает больше проверок пароля, чем последовательный
+func TestLimiterParallelGuesses(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	var checked atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := l.Allow("10.0.0.1", "victim", now); ok {
+				checked.Add(1)
+				time.Sleep(time.Millisecond) // проверка пароля
+				l.Fail("10.0.0.1", "victim", now)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := checked.Load(); n != 1 {
+		t.Errorf("%d passwords checked at the same instant, want 1", n)
+	}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, delay := range want {
+		if _, ok := l.Allow("10.0.0.1", "user", now); !ok {
+			t.Fatalf("attempt %d rejected", i+1)
+		}
+		if locked := l.Fail("10.0.0.1", "user", now); locked {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+
+		wait, ok := l.Allow("10.0.0.1", "user", now)
+		if ok || wait != delay {
+			t.Fatalf("after %d failures Allow = %v, %v; want wait %v", i+1, wait, ok, delay)
+		}
+		if _, ok := l.Allow("10.0.0.1", "user", now.Add(delay-time.Millisecond)); ok {
+			t.Fatalf("after %d failures allowed before the delay ended", i+1)
+		}
+		now = now.Add(delay)
+	}
+}
+
+func TestLimiterDelayCappedByLockout(t *testing.T) {
+	l := NewLoginLimiter(LoginLimits{MaxFailures: 100, MaxIPFailures: 100, BaseDelay: time.Minute, Lockout: 5 * time.Minute})
+	for n, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 4: 5 * time.Minute, 50: 5 * time.Minute} {
+		if got := l.delay(n); got != want {
+			t.Errorf("delay(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	for i := 1; i <= testLimits.MaxFailures; i++ {
+		if wait, ok := l.Allow("10.0.0.1", "user", now); !ok {
+			t.Fatalf("attempt %d rejected, wait %v", i, wait)
+		}
+		locked := l.Fail("10.0.0.1", "user", now)
+		if locked != (i == testLimits.MaxFailures) {
+			t.Fatalf("Fail #%d locked = %v", i, locked)
+		}
+		now = now.Add(l.delay(i))
+	}
+
+	lockedAt := now.Add(-l.delay(testLimits.MaxFailures))
+	until := lockedAt.Add(testLimits.Lockout)
+	if wait, ok := l.Allow("10.0.0.99", "user", now); ok || wait != until.Sub(now) {
+		t.Errorf("Allow on a locked login = %v, %v; want wait %v", wait, ok, until.Sub(now))
+	}
+	locked := l.Locked(now)
+	if len(locked) != 1 || locked[0].Login != "user" || locked[0].Failures != testLimits.MaxFailures || !locked[0].LockedUntil.Equal(until) {
+		t.Errorf("Locked() = %+v", locked)
+	}
+
+	// Другой логин с того же адреса не заблокирован
+	if _, ok := l.Allow("10.0.0.1", "other", now); !ok {
+		t.Error("another login is rejected")
+	}
+	l.Release("10.0.0.1", "other")
+
+	// Блокировка истекает сама или снимается Unlock
+	if _, ok := l.Allow("10.0.0.1", "user", until); !ok {
+		t.Error("Allow after the lockout ended was rejected")
+	}
+	l.Release("10.0.0.1", "user")
+
+	l2 := NewLoginLimiter(testLimits)
+	for i := 0; i < testLimits.MaxFailures; i++ {
+		l2.Fail("10.0.0.1", "user", limiterStart)
+	}
+	if !l2.Unlock("USER", limiterStart) {
+		t.Fatal("Unlock returned false for a locked login")
+	}
+	if l2.Unlock("user", limiterStart) {
+		t.Error("second Unlock returned true")
+	}
+	if len(l2.Locked(limiterStart)) != 0 {
+		t.Error("login is still listed as locked")
+	}
+}
+
+func TestLimiterIPLimit(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	// До MaxIPFailures неудач адрес перебирает разные логины без задержек
+	for i := 0; i < testLimits.MaxIPFailures-1; i++ {
+		login := fmt.Sprintf("user%d", i)
+		if _, ok := l.Allow("10.0.0.1", login, now); !ok {
+			t.Fatalf("attempt %d from the address rejected", i+1)
+		}
+		l.Fail("10.0.0.1", login, now)
+	}
+	if _, ok := l.Allow("10.0.0.1", "next", now); !ok {
+		t.Fatal("last free attempt rejected")
+	}
+	l.Fail("10.0.0.1", "next", now)
+
+	// Дальше каждая неудача с адреса добавляет задержку для любого логина
+	wait, ok := l.Allow("10.0.0.1", "fresh", now)
+	if ok || wait != testLimits.BaseDelay {
+		t.Fatalf("Allow over the address limit = %v, %v; want wait %v", wait, ok, testLimits.BaseDelay)
+	}
+	if _, ok := l.Allow("10.0.0.2", "fresh", now); !ok {
+		t.Error("another address is rejected")
+	}
+	l.Release("10.0.0.2", "fresh")
+
+	// Успешный вход не сбрасывает счётчик адреса
+	now = now.Add(testLimits.BaseDelay)
+	if _, ok := l.Allow("10.0.0.1", "mine", now); !ok {
+		t.Fatal("Allow after the address delay was rejected")
+	}
+	l.Succeed("10.0.0.1", "mine")
+	if _, ok := l.Allow("10.0.0.1", "other", now); !ok {
+		t.Fatal("Allow after a success was rejected")
+	}
+	l.Fail("10.0.0.1", "other", now)
+	if wait, ok := l.Allow("10.0.0.1", "third", now); ok || wait != 2*testLimits.BaseDelay {
+		t.Errorf("Allow after the next address failure = %v, %v; want wait %v", wait, ok, 2*testLimits.BaseDelay)
+	}
+}
+
+// TestLimiterIPPending: параллельные попытки с одного адреса под разными
+// логинами не обходят предел адреса
+func TestLimiterIPPending(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	now := limiterStart
+
+	allowed := 0
+	for i := 0; i < 3*testLimits.MaxIPFailures; i++ {
+		if _, ok := l.Allow("10.0.0.1", fmt.Sprintf("user%d", i), now); ok {
+			allowed++
+		}
+	}
+	if allowed != testLimits.MaxIPFailures {
+		t.Errorf("%d parallel attempts allowed from one address, want %d", allowed, testLimits.MaxIPFailures)
+	}
+}
+
+// TestLimiterStaleReservation: резерв, который не сняли, не блокирует логин навсегда
+func TestLimiterStaleReservation(t *testing.T) {
+	l := NewLoginLimiter(testLimits)
+	if _, ok := l.Allow("10.0.0.1", "user", limiterStart); !ok {
+		t.Fatal("first attempt rejected")
+	}
+	if _, ok := l.Allow("10.0.0.1", "user", limiterStart.Add(time.Second)); ok {
+		t.Fatal("second attempt allowed while the first is pending")
+	}
+	if _, ok := l.Allow("10.0.0.1", "user", limiterStart.Add(maxAttemptTime+time.Second)); !ok {
+		t.Error("stale reservation still blocks the login")
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost - стоимость bcrypt для новых хешей
+const passwordCost = 12
+
+// minPasswordLength - минимальная длина нового пароля в символах
+const minPasswordLength = 8
+
+var (
+	// ErrPasswordTooLong возвращается, если пароль не помещается в bcrypt (72 байта)
+	ErrPasswordTooLong = errors.New("password is too long")
+	// ErrInvalidCredentials - неверный логин или пароль; причина намеренно не уточняется
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	// ErrAccountInactive - пароль верен, но пользователь заморожен или удалён.
+	// Клиенту отвечают как на ErrInvalidCredentials, причина попадает только в журнал.
+	ErrAccountInactive = fmt.Errorf("%w: account is not active", ErrInvalidCredentials)
+	// ErrWeakPassword - новый пароль не проходит требования к сложности
+	ErrWeakPassword = errors.New("password is too weak")
+)
+
+// dummyHash - хеш, с которым сравнивается пароль при несуществующем логине,
+// чтобы такой вход занимал столько же времени, сколько вход с неверным паролем
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy password for timing"), passwordCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+})
+
+// HashPassword возвращает соленый bcrypt-хеш пароля
+func HashPassword(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPasswordStrength проверяет новый пароль пользователя с логином login:
+// не короче minPasswordLength символов, не длиннее 72 байт, содержит буквы
+// и цифры и не совпадает с логином. Ошибка оборачивает ErrWeakPassword или ErrPasswordTooLong.
+func CheckPasswordStrength(password, login string) error {
+	if len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, minPasswordLength)
+	}
+	if !strings.ContainsFunc(password, unicode.IsLetter) || !strings.ContainsFunc(password, unicode.IsDigit) {
+		return fmt.Errorf("%w: must contain both letters and digits", ErrWeakPassword)
+	}
+	if login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		return fmt.Errorf("%w: must not contain the login", ErrWeakPassword)
+	}
+	return nil
+}
+
+// isPasswordHash отличает bcrypt-хеш от пароля, сохранённого открытым текстом
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// checkPassword сравнивает пароль с сохранённым значением.
+// Второй результат сообщает, что сохранённое значение нужно перехешировать
+// (старая запись открытым текстом или хеш с устаревшей стоимостью).
+func checkPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !isPasswordHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)); err != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost < passwordCost
+}
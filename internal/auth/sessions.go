@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"myapp/internal/storage"
+)
+
+var (
+	// ErrSessionNotFound возвращается, если сессии нет в хранилище
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionRevoked возвращается для отозванной или истекшей сессии
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrRefreshTokenReused возвращается при повторном использовании уже ротированного refresh-токена
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// maxRotatedHashes - сколько последних ротированных хешей хранится для
+// обнаружения повторного использования; более старые токены просто не принимаются
+const maxRotatedHashes = 20
+
+// Session - серверная запись о входе пользователя.
+// Refresh-токен хранится только в виде хеша, ротированные хеши сохраняются
+// для обнаружения повторного использования.
+type Session struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"userId"`
+	RefreshHash   string     `json:"refreshHash"`
+	RotatedHashes []string   `json:"rotatedHashes,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	LastUsedAt    time.Time  `json:"lastUsedAt"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Active сообщает, можно ли ещё пользоваться сессией
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// SessionStore определяет интерфейс хранилища сессий
+type SessionStore interface {
+	CreateSession(session Session) error
+	GetSession(id string) (Session, error)
+	// RotateSession атомарно заменяет refresh-хеш oldHash на newHash.
+	// Предъявление уже ротированного хеша отзывает сессию (ErrRefreshTokenReused).
+	RotateSession(id, oldHash, newHash string, now time.Time) (Session, error)
+	RevokeSession(id string) error
+	RevokeUserSessions(userID string) (int, error)
+	RevokeAllSessions() (int, error)
+}
+
+// JSONSessionStore реализует SessionStore для хранения в JSON
+type JSONSessionStore struct {
+	filePath string
+	mu       sync.Mutex
+	sessions []Session
+}
+
+type sessionsFile struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// NewJSONSessionStore создает хранилище сессий и загружает его из файла
+func NewJSONSessionStore(filePath string) (*JSONSessionStore, error) {
+	store := &JSONSessionStore{filePath: filePath}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *JSONSessionStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.sessions = []Session{}
+			return nil
+		}
+		return err
+	}
+
+	var file sessionsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	s.sessions = file.Sessions
+	return nil
+}
+
+// save записывает сессии в файл, отбрасывая давно истекшие
+func (s *JSONSessionStore) save() error {
+	cutoff := time.Now().Add(-24 * time.Hour)
+	kept := s.sessions[:0]
+	for _, session := range s.sessions {
+		if session.ExpiresAt.After(cutoff) {
+			kept = append(kept, session)
+		}
+	}
+	s.sessions = kept
+
+	data, err := json.MarshalIndent(sessionsFile{Sessions: s.sessions}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteFileAtomic(s.filePath, data, 0600)
+}
+
+// CreateSession добавляет новую сессию
+func (s *JSONSessionStore) CreateSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, session)
+	return s.save()
+}
+
+// GetSession возвращает сессию по ID
+func (s *JSONSessionStore) GetSession(id string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.ID == id {
+			return session, nil
+		}
+	}
+
+	return Session{}, ErrSessionNotFound
+}
+
+// RotateSession сверяет хеш предъявленного refresh-токена и ротирует его под
+// одной блокировкой, чтобы два одновременных обмена одного токена не прошли оба
+func (s *JSONSessionStore) RotateSession(id, oldHash, newHash string, now time.Time) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.sessions {
+		session := &s.sessions[i]
+		if session.ID != id {
+			continue
+		}
+		if !session.Active(now) {
+			return Session{}, ErrSessionRevoked
+		}
+
+		if subtle.ConstantTimeCompare([]byte(oldHash), []byte(session.RefreshHash)) != 1 {
+			for _, rotated := range session.RotatedHashes {
+				if subtle.ConstantTimeCompare([]byte(oldHash), []byte(rotated)) == 1 {
+					session.RevokedAt = &now
+					if err := s.save(); err != nil {
+						return Session{}, err
+					}
+					return Session{}, ErrRefreshTokenReused
+				}
+			}
+			return Session{}, ErrSessionNotFound
+		}
+
+		session.RotatedHashes = append(session.RotatedHashes, session.RefreshHash)
+		if n := len(session.RotatedHashes); n > maxRotatedHashes {
+			session.RotatedHashes = slices.Clone(session.RotatedHashes[n-maxRotatedHashes:])
+		}
+		session.RefreshHash = newHash
+		session.LastUsedAt = now
+		return *session, s.save()
+	}
+
+	return Session{}, ErrSessionNotFound
+}
+
+// RevokeSession отзывает одну сессию
+func (s *JSONSessionStore) RevokeSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i := range s.sessions {
+		if s.sessions[i].ID == id {
+			if s.sessions[i].RevokedAt == nil {
+				s.sessions[i].RevokedAt = &now
+			}
+			return s.save()
+		}
+	}
+
+	return ErrSessionNotFound
+}
+
+// RevokeUserSessions отзывает все активные сессии пользователя и возвращает их количество
+func (s *JSONSessionStore) RevokeUserSessions(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	revoked := 0
+	for i := range s.sessions {
+		if s.sessions[i].UserID == userID && s.sessions[i].RevokedAt == nil {
+			s.sessions[i].RevokedAt = &now
+			revoked++
+		}
+	}
+
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, s.save()
+}
+
+// RevokeAllSessions отзывает все активные сессии и возвращает их количество
+func (s *JSONSessionStore) RevokeAllSessions() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	revoked := 0
+	for i := range s.sessions {
+		if s.sessions[i].RevokedAt == nil {
+			s.sessions[i].RevokedAt = &now
+			revoked++
+		}
+	}
+
+	if revoked == 0 {
+		return 0, nil
+	}
+	return revoked, s.save()
+}
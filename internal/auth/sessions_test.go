@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+)
+
+var sessionStart = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestService собирает AuthService на JSON-хранилищах во временном каталоге
+// с пользователем login/password
+func newTestService(t *testing.T, login, password string) (*AuthService, models.User) {
+	t.Helper()
+	dir := t.TempDir()
+	backend, err := storage.NewJSONBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	sessions, err := NewJSONSessionStore(filepath.Join(dir, "sessions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyRing("k1", []KeySpec{{ID: "k1", Alg: AlgHS256, Secret: "0123456789abcdef0123456789abcdef"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAuthService(backend.Users(), sessions, backend.TwoFactor(), keys)
+	user := models.User{ID: "u1", Login: login, Password: password, Name: "Test", Role: models.RoleUser, Status: models.StatusActive}
+	if err := s.Register(user); err != nil {
+		t.Fatal(err)
+	}
+	user.Password = ""
+	return s, user
+}
+
+func newTestSessionStore(t *testing.T) (*JSONSessionStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := NewJSONSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, path
+}
+
+func testSession(id, userID string) Session {
+	return Session{
+		ID:          id,
+		UserID:      userID,
+		RefreshHash: hashToken(id + "-0"),
+		CreatedAt:   sessionStart,
+		LastUsedAt:  sessionStart,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+// TestRotateSession: предъявленный хеш заменяется новым, старый больше не
+// принимается, а его повторное предъявление отзывает всю сессию
+func TestRotateSession(t *testing.T) {
+	store, path := newTestSessionStore(t)
+	if err := store.CreateSession(testSession("s1", "u1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateSession(testSession("s2", "u1")); err != nil {
+		t.Fatal(err)
+	}
+
+	now := sessionStart.Add(time.Minute)
+	session, err := store.RotateSession("s1", hashToken("s1-0"), hashToken("s1-1"), now)
+	if err != nil {
+		t.Fatalf("RotateSession = %v", err)
+	}
+	if session.RefreshHash != hashToken("s1-1") || !session.LastUsedAt.Equal(now) {
+		t.Errorf("rotated session = %+v", session)
+	}
+	if _, err := store.RotateSession("s1", hashToken("s1-1"), hashToken("s1-2"), now); err != nil {
+		t.Fatalf("RotateSession with the new token = %v", err)
+	}
+
+	// Неизвестный хеш - просто отказ, сессия остаётся
+	if _, err := store.RotateSession("s1", hashToken("guess"), hashToken("x"), now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RotateSession with an unknown hash = %v, want ErrSessionNotFound", err)
+	}
+	if _, err := store.RotateSession("missing", hashToken("s1-2"), hashToken("x"), now); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RotateSession of a missing session = %v, want ErrSessionNotFound", err)
+	}
+
+	// Повтор уже ротированного токена отзывает сессию, и действующий токен тоже перестаёт работать
+	if _, err := store.RotateSession("s1", hashToken("s1-0"), hashToken("stolen"), now); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("RotateSession with a rotated token = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := store.RotateSession("s1", hashToken("s1-2"), hashToken("s1-3"), now); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("RotateSession after reuse = %v, want ErrSessionRevoked", err)
+	}
+
+	// Отзыв сохранён в файле и не задел другую сессию пользователя
+	reloaded, err := NewJSONSessionStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := reloaded.GetSession("s1"); err != nil || s.Active(now) {
+		t.Errorf("reloaded session after reuse = %+v, %v; want revoked", s, err)
+	}
+	if s, err := reloaded.GetSession("s2"); err != nil || !s.Active(now) {
+		t.Errorf("other session after reuse = %+v, %v; want active", s, err)
+	}
+}
+
+// TestRotateSessionHistoryCap: хранятся только maxRotatedHashes последних
+// хешей; более старый токен отклоняется, но сессию уже не отзывает
+func TestRotateSessionHistoryCap(t *testing.T) {
+	store, _ := newTestSessionStore(t)
+	if err := store.CreateSession(testSession("s1", "u1")); err != nil {
+		t.Fatal(err)
+	}
+
+	token := func(i int) string { return "s1-" + strconv.Itoa(i) }
+	rotations := maxRotatedHashes + 5
+	var session Session
+	for i := range rotations {
+		var err error
+		session, err = store.RotateSession("s1", hashToken(token(i)), hashToken(token(i+1)), sessionStart)
+		if err != nil {
+			t.Fatalf("rotation %d: %v", i+1, err)
+		}
+	}
+	if n := len(session.RotatedHashes); n != maxRotatedHashes {
+		t.Fatalf("session keeps %d rotated hashes, want %d", n, maxRotatedHashes)
+	}
+	if oldest := session.RotatedHashes[0]; oldest != hashToken(token(rotations-maxRotatedHashes)) {
+		t.Errorf("oldest kept hash is not the token %d", rotations-maxRotatedHashes)
+	}
+
+	if _, err := store.RotateSession("s1", hashToken(token(0)), hashToken("x"), sessionStart); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RotateSession with a forgotten token = %v, want ErrSessionNotFound", err)
+	}
+	if s, _ := store.GetSession("s1"); !s.Active(sessionStart) {
+		t.Fatal("forgotten token revoked the session")
+	}
+	if _, err := store.RotateSession("s1", hashToken(token(rotations-1)), hashToken("x"), sessionStart); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("RotateSession with a recent rotated token = %v, want ErrRefreshTokenReused", err)
+	}
+}
+
+// TestRotateSessionExpired: истекшую или отозванную сессию нельзя продлить
+func TestRotateSessionExpired(t *testing.T) {
+	store, _ := newTestSessionStore(t)
+	session := testSession("s1", "u1")
+	if err := store.CreateSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RotateSession("s1", hashToken("s1-0"), hashToken("s1-1"), session.ExpiresAt); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("RotateSession at expiry = %v, want ErrSessionRevoked", err)
+	}
+
+	if err := store.RevokeSession("s1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RotateSession("s1", hashToken("s1-0"), hashToken("s1-1"), sessionStart); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("RotateSession of a revoked session = %v, want ErrSessionRevoked", err)
+	}
+}
+
+// TestRevokeSessions: отзыв сессий пользователя и всех сессий считает только активные
+func TestRevokeSessions(t *testing.T) {
+	store, _ := newTestSessionStore(t)
+	for _, s := range []Session{testSession("a1", "a"), testSession("a2", "a"), testSession("b1", "b"), testSession("c1", "c")} {
+		if err := store.CreateSession(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.RevokeSession("c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := store.RevokeUserSessions("a"); err != nil || n != 2 {
+		t.Errorf("RevokeUserSessions(a) = %d, %v; want 2", n, err)
+	}
+	if n, err := store.RevokeUserSessions("a"); err != nil || n != 0 {
+		t.Errorf("second RevokeUserSessions(a) = %d, %v; want 0", n, err)
+	}
+	if s, _ := store.GetSession("b1"); !s.Active(sessionStart) {
+		t.Error("RevokeUserSessions(a) revoked another user's session")
+	}
+	if n, err := store.RevokeAllSessions(); err != nil || n != 1 {
+		t.Errorf("RevokeAllSessions = %d, %v; want 1", n, err)
+	}
+	if err := store.RevokeSession("missing"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("RevokeSession(missing) = %v, want ErrSessionNotFound", err)
+	}
+}
+
+// TestRefresh: обмен refresh-токена через сервис выдаёт новую пару, а повтор
+// старого токена выходит из сессии
+func TestRefresh(t *testing.T) {
+	s, _ := newTestService(t, "student", "correct horse battery")
+
+	first, _, challenge, err := s.Login("student", "correct horse battery")
+	if err != nil || challenge != nil {
+		t.Fatalf("Login = %v, %v", challenge, err)
+	}
+	second, user, err := s.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh = %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || user.Password != "" || user.Login != "student" {
+		t.Errorf("Refresh = %+v, %+v", second, user)
+	}
+	claims, err := s.parseToken(second.AccessToken)
+	if err != nil {
+		t.Fatalf("access token after refresh: %v", err)
+	}
+	sessionID, _, _ := strings.Cut(first.RefreshToken, ".")
+	if claims.SessionID != sessionID {
+		t.Errorf("access token session = %q, want %q", claims.SessionID, sessionID)
+	}
+
+	for _, token := range []string{"", "no-dot", sessionID + ".", "." + sessionID} {
+		if _, _, err := s.Refresh(token); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("Refresh(%q) = %v, want ErrSessionNotFound", token, err)
+		}
+	}
+
+	if _, _, err := s.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh with the old token = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := s.Refresh(second.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Refresh after reuse = %v, want ErrSessionRevoked", err)
+	}
+}
+
+// TestRefreshInactiveUser: замороженный пользователь не продлевает сессию, и она отзывается
+func TestRefreshInactiveUser(t *testing.T) {
+	s, user := newTestService(t, "student", "correct horse battery")
+	tokens, _, _, err := s.Login("student", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.UserStorage.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Status = models.StatusFrozen
+	if err := s.UserStorage.UpdateUser(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.Refresh(tokens.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("Refresh of a frozen user = %v, want ErrSessionRevoked", err)
+	}
+	sessionID, _, _ := strings.Cut(tokens.RefreshToken, ".")
+	if session, err := s.Sessions.GetSession(sessionID); err != nil || session.RevokedAt == nil {
+		t.Errorf("session of a frozen user = %+v, %v; want revoked", session, err)
+	}
+}
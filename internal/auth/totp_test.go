@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret - ключ SHA-1 из приложения B RFC 6238
+var rfc6238Secret = []byte("12345678901234567890")
+
+// TestTOTPCodeRFC6238: коды совпадают с тестовыми векторами RFC 6238
+// (шесть младших цифр восьмизначных значений)
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		step := tc.unix / 30
+		if got := totpCode(rfc6238Secret, step); got != tc.code {
+			t.Errorf("totpCode at %d = %s, want %s", tc.unix, got, tc.code)
+		}
+		if got, ok := verifyTOTP(secret, tc.code, time.Unix(tc.unix, 0), 0); !ok || got != step {
+			t.Errorf("verifyTOTP(%s) at %d = %d, %v; want step %d", tc.code, tc.unix, got, ok, step)
+		}
+	}
+}
+
+// TestVerifyTOTPWindow: принимаются коды соседних шагов, но не дальше
+func TestVerifyTOTPWindow(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / 30
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := totpCode(rfc6238Secret, current+offset)
+		step, ok := verifyTOTP(secret, code, now, 0)
+		if want := offset >= -totpSkew && offset <= totpSkew; ok != want {
+			t.Errorf("code of step %+d accepted = %v, want %v", offset, ok, want)
+		} else if ok && step != current+offset {
+			t.Errorf("code of step %+d returned step %d", offset, step-current)
+		}
+	}
+
+	code := totpCode(rfc6238Secret, current)
+	if _, ok := verifyTOTP(strings.ToLower(secret), code, now, 0); !ok {
+		t.Error("lowercase secret rejected")
+	}
+	for _, bad := range []string{"", code[:5], code + "0", " " + code[1:]} {
+		if _, ok := verifyTOTP(secret, bad, now, 0); ok {
+			t.Errorf("code %q accepted", bad)
+		}
+	}
+	if _, ok := verifyTOTP("not base32!", code, now, 0); ok {
+		t.Error("code accepted with a malformed secret")
+	}
+}
+
+// TestVerifyTOTPReplay: код шага не новее LastStep не принимается повторно
+func TestVerifyTOTPReplay(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Secret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / 30
+
+	step, ok := verifyTOTP(secret, totpCode(rfc6238Secret, current), now, 0)
+	if !ok {
+		t.Fatal("current code rejected")
+	}
+	if _, ok := verifyTOTP(secret, totpCode(rfc6238Secret, current), now, step); ok {
+		t.Error("the same code accepted twice")
+	}
+	if _, ok := verifyTOTP(secret, totpCode(rfc6238Secret, current-1), now, step); ok {
+		t.Error("code of an earlier step accepted after a later one")
+	}
+	if got, ok := verifyTOTP(secret, totpCode(rfc6238Secret, current+1), now, step); !ok || got != current+1 {
+		t.Errorf("code of the next step = %d, %v; want accepted", got, ok)
+	}
+}
+
+// TestTOTPURI: URI для приложения содержит секрет и параметры кода
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(totpURI("my app", "ivan", "ABCDEF"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/my app:ivan" {
+		t.Errorf("URI = %s", u)
+	}
+	if q.Get("secret") != "ABCDEF" || q.Get("issuer") != "my app" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("URI parameters = %v", q)
+	}
+}
+
+// TestRecoveryCodes: коды уникальны, хранятся только хеши, а ввод с пробелами,
+// в верхнем регистре или без дефиса приводится к исходному коду
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 9 || code[4] != '-' || seen[code] {
+			t.Errorf("code %q is malformed or repeated", code)
+		}
+		seen[code] = true
+		if hashes[i] != hashToken(code) || hashes[i] == code {
+			t.Errorf("hash of code %d does not match", i)
+		}
+	}
+
+	code := codes[0]
+	for _, typed := range []string{code, strings.ToUpper(code), " " + code + " ", code[:4] + code[5:], code[:4] + " " + code[5:]} {
+		if got := normalizeRecoveryCode(typed); got != code {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", typed, got, code)
+		}
+	}
+}
+
+// TestTwoFactorLogin: вход со вторым фактором принимает код TOTP один раз,
+// а каждый код восстановления - тоже один раз
+func TestTwoFactorLogin(t *testing.T) {
+	s, user := newTestService(t, "student", "correct horse battery")
+
+	secret, _, err := s.SetupTwoFactor(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCode(key, time.Now().Unix()/30)
+	wrong := code[:5] + string(rune('0'+(code[5]-'0'+1)%10))
+	if _, err := s.EnableTwoFactor(user.ID, wrong); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("EnableTwoFactor with a wrong code = %v, want ErrInvalidCode", err)
+	}
+	recovery, err := s.EnableTwoFactor(user.ID, code)
+	if err != nil {
+		t.Fatalf("EnableTwoFactor = %v", err)
+	}
+
+	login := func() string {
+		t.Helper()
+		tokens, _, challenge, err := s.Login("student", "correct horse battery")
+		if err != nil || challenge == nil || tokens.AccessToken != "" {
+			t.Fatalf("Login with two-factor = %+v, %v, %v; want a challenge", tokens, challenge, err)
+		}
+		return challenge.ID
+	}
+
+	// Код, которым второй фактор включён, уже использован
+	challenge := login()
+	if _, _, _, err := s.CompleteLogin(challenge, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("CompleteLogin with the enabling code = %v, want ErrInvalidCode", err)
+	}
+
+	tokens, _, usedRecovery, err := s.CompleteLogin(challenge, strings.ToUpper(recovery[0]))
+	if err != nil || !usedRecovery || tokens.AccessToken == "" {
+		t.Fatalf("CompleteLogin with a recovery code = %v, %v", usedRecovery, err)
+	}
+	if _, _, _, err := s.CompleteLogin(challenge, recovery[1]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("second CompleteLogin on the same challenge = %v, want ErrChallengeNotFound", err)
+	}
+
+	challenge = login()
+	if _, _, _, err := s.CompleteLogin(challenge, recovery[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("CompleteLogin with a used recovery code = %v, want ErrInvalidCode", err)
+	}
+	status, err := s.TwoFactorStatus(user)
+	if err != nil || !status.Enabled || status.RecoveryCodesLeft != recoveryCodeCount-1 {
+		t.Errorf("TwoFactorStatus = %+v, %v; want %d codes left", status, err, recoveryCodeCount-1)
+	}
+	record, err := s.TwoFactor.Get(user.ID)
+	if err != nil || slices.Contains(record.RecoveryCodes, recovery[1]) {
+		t.Errorf("stored recovery codes are not hashed: %v, %v", record.RecoveryCodes, err)
+	}
+
+	// Вызов сгорает после maxChallengeAttempts неудач, включая уже сделанную
+	for i := 1; i < maxChallengeAttempts; i++ {
+		if _, _, _, err := s.CompleteLogin(challenge, "wrong"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	if _, _, _, err := s.CompleteLogin(challenge, recovery[1]); !errors.Is(err, ErrChallengeNotFound) {
+		t.Errorf("CompleteLogin after %d failures = %v, want ErrChallengeNotFound", maxChallengeAttempts, err)
+	}
+}
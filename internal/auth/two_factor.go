@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"myapp/internal/models"
+	"myapp/internal/policy"
+)
+
+// Ограничения второго шага входа
+const (
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var (
+	// ErrChallengeNotFound - вызов второго шага входа не существует, истёк или исчерпал попытки
+	ErrChallengeNotFound = errors.New("login challenge not found or expired")
+	// ErrInvalidCode - неверный код TOTP или код восстановления
+	ErrInvalidCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorEnabled - двухфакторная аутентификация уже включена
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorDisabled - двухфакторная аутентификация не включена
+	ErrTwoFactorDisabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorRequired - роль пользователя не может обходиться без второго фактора
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for this role")
+)
+
+// Challenge - вызов второго шага входа: пароль верен, нужен код TOTP
+// или код восстановления. Выдаётся вместо токенов.
+type Challenge struct {
+	ID        string `json:"challenge"`
+	ExpiresIn int64  `json:"expiresIn"` // секунды
+}
+
+// pendingLogin - вход, ожидающий второго фактора
+type pendingLogin struct {
+	userID    string
+	expiresAt time.Time
+	attempts  int
+}
+
+// challenges хранит незавершённые входы в памяти; после перезапуска вход начинается заново
+type challenges struct {
+	mu      sync.Mutex
+	pending map[string]*pendingLogin
+}
+
+// TwoFactorStatus - состояние двухфакторной аутентификации пользователя
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"` // обязательна для роли пользователя
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// newChallenge начинает второй шаг входа пользователя user
+func (s *AuthService) newChallenge(user models.User) (*Challenge, error) {
+	id, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.challenges.mu.Lock()
+	defer s.challenges.mu.Unlock()
+	for key, p := range s.challenges.pending {
+		if !now.Before(p.expiresAt) {
+			delete(s.challenges.pending, key)
+		}
+	}
+	s.challenges.pending[id] = &pendingLogin{userID: user.ID, expiresAt: now.Add(challengeTTL)}
+
+	return &Challenge{ID: id, ExpiresIn: int64(challengeTTL / time.Second)}, nil
+}
+
+// ChallengeUser возвращает пользователя, вход которого ожидает второго фактора
+func (s *AuthService) ChallengeUser(challengeID string) (models.User, error) {
+	s.challenges.mu.Lock()
+	p, ok := s.challenges.pending[challengeID]
+	if ok && !time.Now().Before(p.expiresAt) {
+		delete(s.challenges.pending, challengeID)
+		ok = false
+	}
+	s.challenges.mu.Unlock()
+	if !ok {
+		return models.User{}, ErrChallengeNotFound
+	}
+
+	user, err := s.UserStorage.GetUserByID(p.userID)
+	if err != nil {
+		return models.User{}, ErrChallengeNotFound
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// CompleteLogin завершает вход по вызову challengeID и коду TOTP или коду
+// восстановления. Вызов одноразовый и после maxChallengeAttempts неудач
+// сгорает. Третий результат сообщает, что использован код восстановления.
+func (s *AuthService) CompleteLogin(challengeID, code string) (TokenPair, models.User, bool, error) {
+	user, err := s.ChallengeUser(challengeID)
+	if err != nil {
+		return TokenPair{}, models.User{}, false, err
+	}
+	if user.Status != models.StatusActive {
+		s.dropChallenge(challengeID)
+		return TokenPair{}, models.User{}, false, ErrChallengeNotFound
+	}
+
+	usedRecovery, err := s.checkSecondFactor(user.ID, code)
+	if errors.Is(err, ErrInvalidCode) {
+		s.challenges.mu.Lock()
+		if p, ok := s.challenges.pending[challengeID]; ok {
+			if p.attempts++; p.attempts >= maxChallengeAttempts {
+				delete(s.challenges.pending, challengeID)
+			}
+		}
+		s.challenges.mu.Unlock()
+		return TokenPair{}, user, false, err
+	}
+	if err != nil {
+		return TokenPair{}, user, false, err
+	}
+
+	s.dropChallenge(challengeID)
+	tokens, err := s.startSession(user)
+	if err != nil {
+		return TokenPair{}, user, false, err
+	}
+	return tokens, user, usedRecovery, nil
+}
+
+func (s *AuthService) dropChallenge(challengeID string) {
+	s.challenges.mu.Lock()
+	delete(s.challenges.pending, challengeID)
+	s.challenges.mu.Unlock()
+}
+
+// TwoFactorStatus возвращает состояние двухфакторной аутентификации пользователя
+func (s *AuthService) TwoFactorStatus(user models.User) (TwoFactorStatus, error) {
+	status := TwoFactorStatus{Required: policy.RequiresTwoFactor(user.Role)}
+	record, err := s.TwoFactor.Get(user.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	status.Enabled = record.Enabled
+	status.RecoveryCodesLeft = len(record.RecoveryCodes)
+	return status, nil
+}
+
+// SetupTwoFactor выдаёт пользователю новый секрет TOTP и otpauth-URI для QR-кода.
+// Секрет начинает действовать после EnableTwoFactor; повторный вызов заменяет его.
+func (s *AuthService) SetupTwoFactor(user models.User) (secret, uri string, err error) {
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, err := s.TwoFactor.Get(user.ID)
+	switch {
+	case err == nil && record.Enabled:
+		return "", "", ErrTwoFactorEnabled
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return "", "", err
+	}
+
+	secret, err = newTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.TwoFactor.Save(models.TwoFactor{UserID: user.ID, Secret: secret}); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(s.TOTPIssuer, user.Login, secret), nil
+}
+
+// EnableTwoFactor включает двухфакторную аутентификацию после проверки
+// первого кода из приложения и возвращает коды восстановления
+func (s *AuthService) EnableTwoFactor(userID, code string) ([]string, error) {
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, err := s.TwoFactor.Get(userID)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrTwoFactorDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	step, ok := verifyTOTP(record.Secret, code, time.Now(), record.LastStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	record.Enabled = true
+	record.EnabledAt = time.Now().UnixMilli()
+	record.LastStep = step
+	record.RecoveryCodes = hashes
+	if err := s.TwoFactor.Save(record); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми; нужен действующий код TOTP
+func (s *AuthService) RegenerateRecoveryCodes(userID, code string) ([]string, error) {
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, err := s.enabledTwoFactor(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := verifyTOTP(record.Secret, code, time.Now(), record.LastStep)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	record.LastStep = step
+	record.RecoveryCodes = hashes
+	if err := s.TwoFactor.Save(record); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor выключает двухфакторную аутентификацию по коду TOTP или
+// коду восстановления. Для ролей, где она обязательна, выключить её нельзя.
+func (s *AuthService) DisableTwoFactor(user models.User, code string) error {
+	if policy.RequiresTwoFactor(user.Role) {
+		return ErrTwoFactorRequired
+	}
+	if _, err := s.checkSecondFactor(user.ID, code); err != nil {
+		return err
+	}
+	return s.TwoFactor.Delete(user.ID)
+}
+
+// ResetTwoFactor удаляет настройки второго фактора пользователя (потерянное
+// устройство) и отзывает его сессии. Возвращает ErrTwoFactorDisabled, если сбрасывать нечего.
+func (s *AuthService) ResetTwoFactor(userID string) error {
+	err := s.TwoFactor.Delete(userID)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrTwoFactorDisabled
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.Sessions.RevokeUserSessions(userID)
+	return err
+}
+
+// TwoFactorMiddleware не пускает пользователя, для роли которого второй фактор
+// обязателен, пока он его не включит. Ставится после AuthMiddleware на все
+// маршруты, кроме настройки второго фактора, смены пароля и выхода.
+func (s *AuthService) TwoFactorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(models.User)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if policy.RequiresTwoFactor(user.Role) {
+			enabled, err := s.twoFactorEnabled(user.ID)
+			if err != nil {
+				http.Error(w, "Failed to check two-factor authentication", http.StatusInternalServerError)
+				return
+			}
+			if !enabled {
+				http.Error(w, "Two-factor authentication setup required", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// twoFactorEnabled сообщает, включён ли у пользователя второй фактор
+func (s *AuthService) twoFactorEnabled(userID string) (bool, error) {
+	_, err := s.enabledTwoFactor(userID)
+	if errors.Is(err, ErrTwoFactorDisabled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// enabledTwoFactor возвращает настройки включённого второго фактора или ErrTwoFactorDisabled
+func (s *AuthService) enabledTwoFactor(userID string) (models.TwoFactor, error) {
+	record, err := s.TwoFactor.Get(userID)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !record.Enabled) {
+		return models.TwoFactor{}, ErrTwoFactorDisabled
+	}
+	return record, err
+}
+
+// checkSecondFactor принимает код TOTP или одноразовый код восстановления
+// и сохраняет его использование. Возвращает true для кода восстановления.
+func (s *AuthService) checkSecondFactor(userID, code string) (bool, error) {
+	s.twoFactorMu.Lock()
+	defer s.twoFactorMu.Unlock()
+
+	record, err := s.enabledTwoFactor(userID)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := verifyTOTP(record.Secret, code, time.Now(), record.LastStep); ok {
+		record.LastStep = step
+		return false, s.TwoFactor.Save(record)
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	if i := slices.Index(record.RecoveryCodes, hash); i >= 0 {
+		record.RecoveryCodes = slices.Delete(record.RecoveryCodes, i, i+1)
+		return true, s.TwoFactor.Save(record)
+	}
+	return false, ErrInvalidCode
+}
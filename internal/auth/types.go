@@ -8,6 +8,14 @@ type Claims struct {
 	jwt.RegisteredClaims        // Встроенная структура с стандартными claims
 	Login                string `json:"login"`
 	Role                 string `json:"role,omitempty"`
+	SessionID            string `json:"sid,omitempty"`
+}
+
+// TokenPair - короткоживущий access-токен и refresh-токен для его обновления
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // время жизни access-токена в секундах
 }
 
 // Другие типы, связанные с аутентификацией...
@@ -0,0 +1,313 @@
+// Package backup пишет и читает резервные копии данных приложения: архив
+// tar.gz с JSON-снимком всех хранилищ (data/), PDF уроков (files/) и
+// манифестом manifest.json с размерами и контрольными суммами файлов.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+)
+
+// Version - версия формата архива
+const Version = 1
+
+// Пути внутри архива
+const (
+	ManifestName = "manifest.json"
+	DataDir      = "data"
+	FilesDir     = "files"
+)
+
+// ErrInvalidArchive - архив повреждён или собран не этим сервером
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Manifest описывает содержимое архива
+type Manifest struct {
+	Version   int     `json:"version"`
+	CreatedAt int64   `json:"createdAt"` // Unix ms
+	Files     []Entry `json:"files"`
+}
+
+// Limits ограничивает распакованный размер архива, чтобы сжатый архив не
+// заполнил диск; 0 снимает ограничение
+type Limits struct {
+	MaxEntry int64 // предельный размер одного файла, байт
+	MaxTotal int64 // предельный размер всех файлов вместе, байт
+}
+
+// Entry - файл архива с размером и SHA-256
+type Entry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Write записывает в w архив с данными store и PDF уроков из filesDir.
+// Снимок хранилища сначала копируется во временный каталог, поэтому для
+// согласованности вызывающий должен не допускать изменений на время Write.
+func Write(w io.Writer, store storage.Backend, filesDir string) (Manifest, error) {
+	manifest := Manifest{Version: Version, CreatedAt: time.Now().UnixMilli(), Files: []Entry{}}
+
+	tmp, err := os.MkdirTemp("", "backup-*")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot, err := storage.NewJSONBackend(tmp)
+	if err != nil {
+		return manifest, err
+	}
+	if err := storage.Copy(snapshot, store); err != nil {
+		return manifest, fmt.Errorf("snapshot storage: %w", err)
+	}
+	if err := storage.AppendAuditLog(snapshot, store); err != nil {
+		return manifest, fmt.Errorf("snapshot audit log: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(dir storage.SafeDir, name, path string) error {
+		f, err := dir.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: path, Mode: 0644, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(tw, sum), f); err != nil {
+			return fmt.Errorf("archive %s: %w", path, err)
+		}
+		manifest.Files = append(manifest.Files, Entry{Path: path, Size: info.Size(), SHA256: hex.EncodeToString(sum.Sum(nil))})
+		return nil
+	}
+
+	dataFiles, err := listFiles(tmp, "")
+	if err != nil {
+		return manifest, err
+	}
+	for _, name := range dataFiles {
+		if err := add(storage.SafeDir(tmp), name, DataDir+"/"+name); err != nil {
+			return manifest, err
+		}
+	}
+	lessonFiles, err := listFiles(filesDir, ".pdf")
+	if err != nil && !os.IsNotExist(err) {
+		return manifest, err
+	}
+	for _, name := range lessonFiles {
+		if err := add(storage.SafeDir(filesDir), name, FilesDir+"/"+name); err != nil {
+			return manifest, err
+		}
+	}
+
+	// Манифест пишется последним: к этому моменту известны все суммы
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: time.UnixMilli(manifest.CreatedAt), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return manifest, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return manifest, err
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	return manifest, gz.Close()
+}
+
+// Extract распаковывает архив из r в пустой каталог dir и проверяет его по
+// манифесту: в архиве должны быть ровно перечисленные файлы с теми же
+// размерами и суммами. Допускаются только обычные файлы с безопасными именами
+// в data/ и files/ (PDF). Манифест лежит в конце архива, поэтому размеры
+// ограничиваются по заголовкам tar до записи на диск, а с манифестом
+// сверяются после. Ошибки проверки оборачивают ErrInvalidArchive.
+func Extract(r io.Reader, dir string, limits Limits) (Manifest, error) {
+	var manifest Manifest
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidArchive, fmt.Sprintf(format, args...))
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, invalid("not a gzip stream")
+	}
+	defer gz.Close()
+
+	for _, sub := range []string{DataDir, FilesDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return manifest, err
+		}
+	}
+
+	found := map[string]Entry{}
+	var manifestData []byte
+	var total int64
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, invalid("read tar: %v", err)
+		}
+		// Каталоги верхнего уровня добавляют архиваторы, если упаковать архив вручную
+		if hdr.Typeflag == tar.TypeDir && (hdr.Name == DataDir+"/" || hdr.Name == FilesDir+"/") {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return manifest, invalid("%q is not a regular file", hdr.Name)
+		}
+		if _, dup := found[hdr.Name]; dup || (hdr.Name == ManifestName && manifestData != nil) {
+			return manifest, invalid("duplicate entry %q", hdr.Name)
+		}
+
+		if hdr.Name == ManifestName {
+			if manifestData, err = io.ReadAll(io.LimitReader(tr, 16<<20)); err != nil {
+				return manifest, invalid("read manifest: %v", err)
+			}
+			continue
+		}
+
+		sub, name, ok := strings.Cut(hdr.Name, "/")
+		switch {
+		case !ok || !storage.ValidName(name),
+			sub != DataDir && sub != FilesDir,
+			sub == FilesDir && !strings.HasSuffix(name, ".pdf"):
+			return manifest, invalid("unexpected entry %q", hdr.Name)
+		}
+
+		if limits.MaxEntry > 0 && hdr.Size > limits.MaxEntry {
+			return manifest, invalid("%q is larger than %d bytes", hdr.Name, limits.MaxEntry)
+		}
+		total += hdr.Size
+		if limits.MaxTotal > 0 && total > limits.MaxTotal {
+			return manifest, invalid("archive unpacks to more than %d bytes", limits.MaxTotal)
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, sub, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return manifest, err
+		}
+		sum := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, sum), io.LimitReader(tr, hdr.Size))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return manifest, invalid("extract %q: %v", hdr.Name, err)
+		}
+		found[hdr.Name] = Entry{Path: hdr.Name, Size: n, SHA256: hex.EncodeToString(sum.Sum(nil))}
+	}
+
+	if manifestData == nil {
+		return manifest, invalid("%s is missing", ManifestName)
+	}
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return manifest, invalid("parse manifest: %v", err)
+	}
+	if manifest.Version != Version {
+		return manifest, invalid("unsupported version %d", manifest.Version)
+	}
+	if len(manifest.Files) != len(found) {
+		return manifest, invalid("manifest lists %d files, archive has %d", len(manifest.Files), len(found))
+	}
+	for _, want := range manifest.Files {
+		if got, ok := found[want.Path]; !ok || got != want {
+			return manifest, invalid("checksum mismatch for %q", want.Path)
+		}
+	}
+	return manifest, nil
+}
+
+// Check проверяет, что распакованный снимок читается целиком и содержит
+// действующего владельца - иначе после восстановления никто не смог бы войти
+// и управлять сервером. Возвращает файлы уроков из индекса, которых нет в
+// архиве: такой архив допустим, ведь файл мог пропасть ещё до копирования.
+func Check(snapshot storage.Backend, manifest Manifest) ([]string, error) {
+	users, err := snapshot.Users().GetAllUsers()
+	if err != nil {
+		return nil, fmt.Errorf("%w: users: %v", ErrInvalidArchive, err)
+	}
+	if !slices.ContainsFunc(users, func(u models.User) bool {
+		return u.Role == models.RoleOwner && u.Status == models.StatusActive
+	}) {
+		return nil, fmt.Errorf("%w: no active owner", ErrInvalidArchive)
+	}
+
+	// Каждое хранилище снимка должно читаться, иначе восстановление прервётся на середине
+	reads := map[string]func() error{
+		"modules":     func() error { _, err := snapshot.Modules().List(); return err },
+		"grant audit": func() error { _, err := snapshot.GrantAudit().List(); return err },
+		"enrollments": func() error { _, err := snapshot.Enrollments().List(); return err },
+		"groups":      func() error { _, err := snapshot.Groups().List(); return err },
+		"attendance":  func() error { _, err := snapshot.Attendance().List(); return err },
+		"filials":     func() error { _, err := snapshot.Filials().List(); return err },
+		"downloads":   func() error { _, err := snapshot.Downloads().List(); return err },
+		"two-factor":  func() error { _, err := snapshot.TwoFactor().List(); return err },
+	}
+	for _, kind := range storage.DataKinds {
+		reads[string(kind)+" data"] = func() error { _, err := snapshot.UserData().List(kind); return err }
+	}
+	for name, read := range reads {
+		if err := read(); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+		}
+	}
+
+	groups, err := snapshot.ModuleFiles().List()
+	if err != nil {
+		return nil, fmt.Errorf("%w: module files: %v", ErrInvalidArchive, err)
+	}
+	missing := []string{}
+	for _, g := range groups {
+		for _, item := range g.Files {
+			path := FilesDir + "/" + item.FileName + ".pdf"
+			if !slices.ContainsFunc(manifest.Files, func(e Entry) bool { return e.Path == path }) && !slices.Contains(missing, item.FileName) {
+				missing = append(missing, item.FileName)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// listFiles возвращает имена обычных файлов dir с суффиксом suffix,
+// которые можно открыть через SafeDir
+func listFiles(dir, suffix string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && storage.ValidName(e.Name()) && strings.HasSuffix(e.Name(), suffix) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
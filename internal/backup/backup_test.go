@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFile - файл, который кладётся в архив
+type testFile struct {
+	path string
+	data []byte
+}
+
+// testArchive собирает архив из files с верным манифестом в конце
+func testArchive(t *testing.T, files ...testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	manifest := Manifest{Version: Version, CreatedAt: 1, Files: []Entry{}}
+	add := func(path string, data []byte) {
+		t.Helper()
+		if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range files {
+		add(f.path, f.data)
+		sum := sha256.Sum256(f.data)
+		manifest.Files = append(manifest.Files, Entry{Path: f.path, Size: int64(len(f.data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(ManifestName, data)
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	archive := testArchive(t,
+		testFile{DataDir + "/users.json", []byte(`{"users":[]}`)},
+		testFile{FilesDir + "/lesson.pdf", []byte("%PDF-1.4")},
+	)
+	dir := t.TempDir()
+	manifest, err := Extract(bytes.NewReader(archive), dir, Limits{MaxEntry: 1 << 10, MaxTotal: 1 << 10})
+	if err != nil {
+		t.Fatalf("Extract = %v", err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Errorf("manifest lists %d files, want 2", len(manifest.Files))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, FilesDir, "lesson.pdf"))
+	if err != nil || string(data) != "%PDF-1.4" {
+		t.Errorf("lesson.pdf = %q, %v", data, err)
+	}
+}
+
+// TestExtractLimits: сжатый до килобайт архив не распаковывается в гигабайты
+func TestExtractLimits(t *testing.T) {
+	zeros := make([]byte, 8<<20)
+	tests := []struct {
+		name   string
+		files  []testFile
+		limits Limits
+	}{
+		{"entry over the limit", []testFile{{FilesDir + "/bomb.pdf", zeros}}, Limits{MaxEntry: 1 << 20, MaxTotal: 64 << 20}},
+		{"total over the limit", []testFile{
+			{FilesDir + "/a.pdf", zeros[:3<<20]},
+			{FilesDir + "/b.pdf", zeros[:3<<20]},
+			{FilesDir + "/c.pdf", zeros[:3<<20]},
+		}, Limits{MaxEntry: 4 << 20, MaxTotal: 8 << 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := testArchive(t, tt.files...)
+			if len(archive) > 64<<10 {
+				t.Fatalf("test archive is %d bytes, want a small compressed one", len(archive))
+			}
+			dir := t.TempDir()
+			_, err := Extract(bytes.NewReader(archive), dir, tt.limits)
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Fatalf("Extract = %v, want ErrInvalidArchive", err)
+			}
+			var written int64
+			filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+				if err == nil && info.Mode().IsRegular() {
+					written += info.Size()
+				}
+				return nil
+			})
+			if written > tt.limits.MaxTotal {
+				t.Errorf("wrote %d bytes, limit is %d", written, tt.limits.MaxTotal)
+			}
+		})
+	}
+
+	// Без пределов тот же архив распаковывается: так читается архив, сохранённый перед восстановлением
+	archive := testArchive(t, testFile{FilesDir + "/big.pdf", zeros})
+	if _, err := Extract(bytes.NewReader(archive), t.TempDir(), Limits{}); err != nil {
+		t.Errorf("Extract without limits = %v", err)
+	}
+}
+
+// TestExtractTruncatedEntry: файл короче заявленного в заголовке отклоняется
+func TestExtractTruncatedEntry(t *testing.T) {
+	archive := testArchive(t, testFile{FilesDir + "/lesson.pdf", bytes.Repeat([]byte("x"), 4096)})
+	raw, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(plain[:2048])
+	gz.Close()
+	if _, err := Extract(&buf, t.TempDir(), Limits{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Extract of a truncated archive = %v, want ErrInvalidArchive", err)
+	}
+}
+
+// TestSaveNames: архивы одной секунды не перезаписывают друг друга, а срок
+// хранения копий по расписанию не касается других префиксов
+func TestSaveNames(t *testing.T) {
+	dir := t.TempDir()
+	write := func(w io.Writer) (Manifest, error) {
+		_, err := w.Write([]byte("archive"))
+		return Manifest{}, err
+	}
+
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	if a, b := Name(PrefixScheduled, at), Name(PrefixScheduled, at); a == b {
+		t.Errorf("Name returned %q twice for the same instant", a)
+	}
+	if a, b := Name(PrefixScheduled, at), Name(PrefixScheduled, at.Add(time.Microsecond)); a >= b {
+		t.Errorf("Name(t) = %q does not sort before Name(t+1µs) = %q", a, b)
+	}
+
+	manual := filepath.Join(dir, Name(PrefixOnDemand, at))
+	if err := os.WriteFile(manual, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var saved []string
+	for i := 0; i < 3; i++ {
+		path, err := Save(dir, PrefixScheduled, 2, write)
+		if err != nil {
+			t.Fatalf("Save #%d = %v", i+1, err)
+		}
+		if slices.Contains(saved, path) {
+			t.Fatalf("Save #%d reused %s", i+1, path)
+		}
+		saved = append(saved, path)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{filepath.Base(saved[1]), filepath.Base(saved[2]), filepath.Base(manual)}
+	slices.Sort(want)
+	if !slices.Equal(names, want) {
+		t.Errorf("backup dir = %v, want %v", names, want)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, ".tmp-") {
+			t.Errorf("temporary file %s left behind", name)
+		}
+	}
+}
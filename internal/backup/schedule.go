@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Префиксы имён архивов. У каждого префикса свой срок хранения: prune
+// удаляет только архивы с префиксом сохраняемого.
+const (
+	PrefixScheduled  = "backup-"
+	PrefixPreRestore = "pre-restore-"
+	PrefixOnDemand   = "manual-" // архив, скачанный через GET /admin/backup
+)
+
+// Name возвращает имя архива, созданного в момент t: префикс, время до
+// микросекунды и случайный суффикс, чтобы архивы одной секунды не
+// перезаписывали друг друга. Время в имени сортируется как строка.
+func Name(prefix string, t time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return prefix + t.UTC().Format("20060102-150405.000000") + "-" + hex.EncodeToString(suffix) + ".tar.gz"
+}
+
+// WriteFunc записывает архив в w; обычно это Write под блокировками обработчиков
+type WriteFunc func(w io.Writer) (Manifest, error)
+
+// Save записывает архив в dir под именем из Name и оставляет
+// не больше keep последних архивов с тем же префиксом. Возвращает путь к архиву.
+func Save(dir, prefix string, keep int, write WriteFunc) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	// Архив может быть большим, поэтому пишется сразу во временный файл рядом
+	tmp, err := os.CreateTemp(dir, ".tmp-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, Name(prefix, time.Now()))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	prune(dir, prefix, keep)
+	return path, nil
+}
+
+// Schedule раз в interval сохраняет архив в dir, храня keep последних.
+// Блокирует вызывающего; ошибки только записываются в лог.
+func Schedule(dir string, interval time.Duration, keep int, write WriteFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		path, err := Save(dir, PrefixScheduled, keep, write)
+		if err != nil {
+			log.Printf("scheduled backup failed: %v", err)
+			continue
+		}
+		log.Printf("scheduled backup saved to %s", path)
+	}
+}
+
+// prune удаляет самые старые архивы с префиксом prefix сверх keep.
+// Время в имени архива сортируется как строка.
+func prune(dir, prefix string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ".tar.gz") {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			log.Printf("failed to remove old backup %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import "encoding/json"
+
+// Действия, которые попадают в журнал аудита
+const (
+	AuditLogin          = "auth:login"
+	AuditLoginFailed    = "auth:login-failed"
+	AuditLoginLocked    = "auth:locked"
+	AuditLoginUnlocked  = "auth:unlocked"
+	AuditRegister       = "user:register"
+	AuditUpdateUser     = "user:update"
+	AuditUpdateUserData = "user:update-data"
+	AuditChangeStatus   = "user:status"
+	AuditChangeRole     = "user:role"
+	AuditTransferUser   = "user:transfer"
+	AuditPurgeUser      = "user:purge"
+	AuditRevokeSessions = "user:revoke-sessions"
+	AuditChangePassword = "user:password"
+	AuditResetPassword  = "user:reset-password"
+	AuditEnable2FA      = "user:2fa-enable"
+	AuditDisable2FA     = "user:2fa-disable"
+	AuditReset2FA       = "user:2fa-reset"
+	AuditRecoveryCodes  = "user:2fa-recovery-codes"
+	AuditDownloadFile   = "files:download"
+	AuditBackup         = "store:backup"
+	AuditRestore        = "store:restore"
+)
+
+// AuditEvent - запись журнала аудита. At - миллисекунды Unix. Actor - кто
+// выполнил действие (пусто при самостоятельной регистрации и неудачном входе),
+// Target - над кем; Filial - филиал целевого пользователя, а без него - актора.
+type AuditEvent struct {
+	ID          string        `json:"id"`
+	At          int64         `json:"at"`
+	ActorID     string        `json:"actorId,omitempty"`
+	ActorLogin  string        `json:"actorLogin,omitempty"`
+	Action      string        `json:"action"`
+	TargetID    string        `json:"targetId,omitempty"`
+	TargetLogin string        `json:"targetLogin,omitempty"`
+	Filial      string        `json:"filial,omitempty"`
+	Changes     []AuditChange `json:"changes,omitempty"`
+	Detail      string        `json:"detail,omitempty"`
+	RemoteAddr  string        `json:"remoteAddr,omitempty"`
+}
+
+// AuditChange - изменение одного поля. Значения секретных полей (пароль)
+// не записываются: остаётся только факт изменения.
+type AuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Способ, которым пользователь получил файл урока
+const (
+	DownloadViaToken = "token" // запрос с bearer-токеном
+	DownloadViaLink  = "link"  // подписанная ссылка
+)
+
+// Download - запись журнала скачиваний PDF уроков. At - миллисекунды Unix.
+type Download struct {
+	ID         string `json:"id"`
+	At         int64  `json:"at"`
+	UserID     string `json:"userId"`
+	UserLogin  string `json:"userLogin"`
+	FileName   string `json:"fileName"`
+	Module     int    `json:"module"`
+	Via        string `json:"via"`
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+}
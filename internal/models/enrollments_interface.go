@@ -0,0 +1,42 @@
+package models
+
+// EnrollmentStatus - состояние записи ученика на модуль
+type EnrollmentStatus string
+
+const (
+	EnrollmentActive  EnrollmentStatus = "active"
+	EnrollmentDropped EnrollmentStatus = "dropped" // ученик отчислен с модуля, прогресс сохраняется
+)
+
+// LessonState - прогресс ученика по одному уроку
+type LessonState string
+
+const (
+	LessonStarted   LessonState = "started"
+	LessonCompleted LessonState = "completed"
+)
+
+// Enrollment - запись ученика на модуль к тьютору. Даты - миллисекунды Unix.
+type Enrollment struct {
+	ID         string           `json:"id"`
+	StudentID  string           `json:"studentId"`
+	Module     int              `json:"module"`
+	TutorID    string           `json:"tutorId"`
+	Status     EnrollmentStatus `json:"status"`
+	EnrolledAt int64            `json:"enrolledAt"`
+	EnrolledBy string           `json:"enrolledBy"`
+	Progress   []LessonProgress `json:"progress"`
+}
+
+// LessonProgress - отметка об уроке; урок - FileItem модуля по FileName
+type LessonProgress struct {
+	FileName  string      `json:"fileName"`
+	State     LessonState `json:"state"`
+	UpdatedAt int64       `json:"updatedAt"`
+	UpdatedBy string      `json:"updatedBy"`
+}
+
+// IsValidLessonState проверяет отметку об уроке
+func IsValidLessonState(state LessonState) bool {
+	return state == LessonStarted || state == LessonCompleted
+}
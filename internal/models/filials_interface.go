@@ -0,0 +1,10 @@
+package models
+
+// Filial - филиал школы. Пользователи и группы ссылаются на него по ID.
+type Filial struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Address  string `json:"address,omitempty"`
+	Timezone string `json:"timezone,omitempty"` // IANA, например Europe/Moscow; пусто - время сервера
+	Active   bool   `json:"active"`             // в неактивный филиал нельзя добавлять пользователей и группы
+}
@@ -0,0 +1,24 @@
+package models
+
+// GrantAction - изменение доступа тьютора к модулю
+type GrantAction string
+
+const (
+	GrantGranted  GrantAction = "grant"  // доступ выдан или срок задан заново
+	GrantExtended GrantAction = "extend" // срок продлён
+	GrantRevoked  GrantAction = "revoke" // доступ отозван
+)
+
+// GrantEvent - запись журнала выдачи доступа. Даты - миллисекунды Unix,
+// как и ModuleInfo.Date.
+type GrantEvent struct {
+	ID         string      `json:"id"`
+	At         int64       `json:"at"`
+	ActorID    string      `json:"actorId"`
+	ActorLogin string      `json:"actorLogin"`
+	TutorID    string      `json:"tutorId"`
+	Module     int         `json:"module"`
+	Action     GrantAction `json:"action"`
+	Until      int64       `json:"until,omitempty"`     // срок доступа после изменения
+	PrevUntil  int64       `json:"prevUntil,omitempty"` // срок до изменения, 0 - доступа не было
+}
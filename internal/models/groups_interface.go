@@ -0,0 +1,54 @@
+package models
+
+// Group - учебная группа: модуль, тьютор и ученики одного филиала
+type Group struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Filial     string         `json:"filial"`
+	Module     int            `json:"module"`
+	TutorID    string         `json:"tutorId"`
+	StudentIDs []string       `json:"studentIds"`
+	Schedule   []ScheduleSlot `json:"schedule"`
+	StartsOn   string         `json:"startsOn"`         // первый день занятий, YYYY-MM-DD
+	EndsOn     string         `json:"endsOn,omitempty"` // последний день, пусто - без окончания
+	Archived   bool           `json:"archived,omitempty"`
+}
+
+// ScheduleSlot - еженедельное занятие группы по местному времени филиала (Filial.Timezone)
+type ScheduleSlot struct {
+	Weekday  int    `json:"weekday"`  // 1 - понедельник, 7 - воскресенье
+	Start    string `json:"start"`    // HH:MM
+	Duration int    `json:"duration"` // минуты
+}
+
+// AttendanceStatus - отметка о посещении занятия
+type AttendanceStatus string
+
+const (
+	AttendancePresent AttendanceStatus = "present"
+	AttendanceLate    AttendanceStatus = "late"
+	AttendanceAbsent  AttendanceStatus = "absent"
+	AttendanceExcused AttendanceStatus = "excused" // пропуск по уважительной причине
+)
+
+// Attendance - отметка ученика на занятии группы. Занятие определяется
+// датой и временем начала из расписания.
+type Attendance struct {
+	GroupID   string           `json:"groupId"`
+	Date      string           `json:"date"` // YYYY-MM-DD
+	Start     string           `json:"start"`
+	StudentID string           `json:"studentId"`
+	Status    AttendanceStatus `json:"status"`
+	MarkedBy  string           `json:"markedBy"`
+	MarkedAt  int64            `json:"markedAt"`
+}
+
+// IsValidAttendanceStatus проверяет отметку о посещении
+func IsValidAttendanceStatus(status AttendanceStatus) bool {
+	switch status {
+	case AttendancePresent, AttendanceLate, AttendanceAbsent, AttendanceExcused:
+		return true
+	default:
+		return false
+	}
+}
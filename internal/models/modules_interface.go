@@ -9,4 +9,6 @@ type Module struct {
 	TotalClasses   int    `json:"totalClasses"`
 	TotalDuration  string `json:"totalDuration"`
 	LinkToFolder   string `json:"linkToFolder"`
+	Archived       bool   `json:"archived,omitempty"` // скрыт от тьюторов, но сохраняется в каталоге
+	Version        int    `json:"version"`            // растёт при каждом изменении, для оптимистичной блокировки
 }
@@ -0,0 +1,12 @@
+package models
+
+// TwoFactor - настройки TOTP (RFC 6238) пользователя. Пока Enabled ложно,
+// секрет только выдан и ждёт подтверждения первым кодом.
+type TwoFactor struct {
+	UserID        string   `json:"userId"`
+	Secret        string   `json:"secret"` // base32 без выравнивания
+	Enabled       bool     `json:"enabled"`
+	EnabledAt     int64    `json:"enabledAt,omitempty"`     // миллисекунды Unix
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"` // SHA-256 неиспользованных кодов восстановления
+	LastStep      int64    `json:"lastStep,omitempty"`      // шаг последнего принятого кода: повтор кода не принимается
+}
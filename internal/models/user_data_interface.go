@@ -1,11 +1,44 @@
 package models
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
 type UserData struct {
-	ID      int          `json:"id"`
+	ID      string       `json:"id"` // совпадает с User.ID
 	Links   []Link       `json:"links"`
 	Modules []ModuleInfo `json:"modules,omitempty"` // только у тьютора
 }
 
+// UnmarshalJSON принимает и строковый ID, и числовой из старых файлов
+func (d *UserData) UnmarshalJSON(data []byte) error {
+	type plain UserData
+	var aux struct {
+		plain
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*d = UserData(aux.plain)
+	d.ID = ""
+	if len(aux.ID) == 0 || bytes.Equal(aux.ID, []byte("null")) {
+		return nil
+	}
+	if aux.ID[0] == '"' {
+		return json.Unmarshal(aux.ID, &d.ID)
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(aux.ID, &n); err != nil {
+		return err
+	}
+	d.ID = n.String()
+	return nil
+}
+
 type Link struct {
 	URL  string `json:"url"`
 	Type string `json:"type"`
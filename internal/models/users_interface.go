@@ -8,6 +8,12 @@ type User struct {
 	Filial   string     `json:"filial"`
 	Role     UserRole   `json:"role"`
 	Status   UserStatus `json:"status"`
+
+	// Пароль выдан администратором (код сброса) или сброшен, и до его смены
+	// доступна только смена пароля. ResetExpiresAt - срок действия кода сброса
+	// в миллисекундах Unix, 0 - без срока.
+	MustChangePassword bool  `json:"mustChangePassword,omitempty"`
+	ResetExpiresAt     int64 `json:"resetExpiresAt,omitempty"`
 }
 
 type UserRole string
@@ -1,20 +1,157 @@
 package models
 
-//func IsValidRole(role UserRole) bool {
-//	switch role {
-//	case RoleOwner, RoleAdmin, RoleTutor, RoleHelper, RoleUser:
-//		return true
-//	default:
-//		return false
-//	}
-//}
-//
-//// IsValidStatus проверяет, является ли статус допустимым
-//func IsValidStatus(status UserStatus) bool {
-//	switch status {
-//	case StatusActive, StatusFrozen, StatusDeleted:
-//		return true
-//	default:
-//		return false
-//	}
-//}
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// IsValidRole проверяет, является ли роль допустимой
+func IsValidRole(role UserRole) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleTutor, RoleHelper, RoleUser:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidStatus проверяет, является ли статус допустимым
+func IsValidStatus(status UserStatus) bool {
+	switch status {
+	case StatusActive, StatusFrozen, StatusDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ограничения на поля модуля
+const (
+	MaxModuleClasses    = 200
+	MaxModuleNameLength = 200
+)
+
+// durationPattern - длительность курса в виде "2 недели", "1,5 месяца", "10 дней"
+var durationPattern = regexp.MustCompile(`^\d+([.,]\d+)? (день|дня|дней|неделя|недели|недель|месяц|месяца|месяцев|год|года|лет)$`)
+
+// ValidateModule проверяет описание модуля перед сохранением
+func ValidateModule(m Module) error {
+	var errs []error
+
+	name := strings.TrimSpace(m.Name)
+	if name == "" {
+		errs = append(errs, errors.New("name is required"))
+	} else if utf8.RuneCountInString(name) > MaxModuleNameLength {
+		errs = append(errs, fmt.Errorf("name must be at most %d characters", MaxModuleNameLength))
+	}
+
+	if m.TotalClasses < 1 || m.TotalClasses > MaxModuleClasses {
+		errs = append(errs, fmt.Errorf("totalClasses must be between 1 and %d", MaxModuleClasses))
+	}
+
+	if !durationPattern.MatchString(strings.TrimSpace(m.TotalDuration)) {
+		errs = append(errs, errors.New(`totalDuration must look like "2 недели" or "1,5 месяца"`))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Форматы даты и времени в расписании
+const (
+	DateLayout = "2006-01-02"
+	TimeLayout = "15:04"
+)
+
+// Ограничения на длительность занятия, минуты
+const (
+	MinClassDuration = 15
+	MaxClassDuration = 300
+)
+
+// ValidateGroup проверяет название, расписание и даты группы
+func ValidateGroup(g Group) error {
+	var errs []error
+
+	if strings.TrimSpace(g.Name) == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	if len(g.Schedule) == 0 {
+		errs = append(errs, errors.New("schedule must have at least one class"))
+	}
+	seen := make(map[ScheduleSlot]bool)
+	for i, slot := range g.Schedule {
+		if slot.Weekday < 1 || slot.Weekday > 7 {
+			errs = append(errs, fmt.Errorf("schedule[%d]: weekday must be between 1 and 7", i))
+		}
+		if _, err := time.Parse(TimeLayout, slot.Start); err != nil {
+			errs = append(errs, fmt.Errorf("schedule[%d]: start must be HH:MM", i))
+		}
+		if slot.Duration < MinClassDuration || slot.Duration > MaxClassDuration {
+			errs = append(errs, fmt.Errorf("schedule[%d]: duration must be between %d and %d minutes", i, MinClassDuration, MaxClassDuration))
+		}
+		key := ScheduleSlot{Weekday: slot.Weekday, Start: slot.Start}
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("schedule[%d]: duplicate class", i))
+		}
+		seen[key] = true
+	}
+
+	startsOn, err := time.Parse(DateLayout, g.StartsOn)
+	if err != nil {
+		errs = append(errs, errors.New("startsOn must be YYYY-MM-DD"))
+	}
+	if g.EndsOn != "" {
+		endsOn, err := time.Parse(DateLayout, g.EndsOn)
+		switch {
+		case err != nil:
+			errs = append(errs, errors.New("endsOn must be YYYY-MM-DD"))
+		case endsOn.Before(startsOn):
+			errs = append(errs, errors.New("endsOn must not be before startsOn"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Ограничения на поля филиала
+const (
+	MaxFilialNameLength    = 200
+	MaxFilialAddressLength = 500
+)
+
+// filialIDPattern - ID филиала: короткий код без пробелов, например "1" или "msk-center"
+var filialIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidateFilial проверяет ID, название, адрес и часовой пояс филиала
+func ValidateFilial(f Filial) error {
+	var errs []error
+
+	if !filialIDPattern.MatchString(f.ID) {
+		errs = append(errs, errors.New("id must be 1-32 latin letters, digits, '-' or '_'"))
+	}
+
+	name := strings.TrimSpace(f.Name)
+	if name == "" {
+		errs = append(errs, errors.New("name is required"))
+	} else if utf8.RuneCountInString(name) > MaxFilialNameLength {
+		errs = append(errs, fmt.Errorf("name must be at most %d characters", MaxFilialNameLength))
+	}
+
+	if utf8.RuneCountInString(f.Address) > MaxFilialAddressLength {
+		errs = append(errs, fmt.Errorf("address must be at most %d characters", MaxFilialAddressLength))
+	}
+
+	// "Local" и пустая строка означают часовой пояс сервера, его не указывают явно
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil || f.Timezone == "Local" {
+			errs = append(errs, fmt.Errorf("unknown timezone %q", f.Timezone))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,511 @@
+package pdfstamp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// xrefEntry - положение объекта: в файле (offset) или внутри потока объектов
+type xrefEntry struct {
+	inStream bool
+	offset   int64 // смещение в файле или номер потока объектов
+	index    int   // номер объекта внутри потока объектов
+	gen      int
+}
+
+// document - разобранный PDF: таблица ссылок и последний trailer
+type document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	objStms map[int64]*objStm
+}
+
+// objStm - распакованный поток объектов
+type objStm struct {
+	data    []byte
+	first   int
+	offsets map[int]int // номер объекта -> смещение от first
+}
+
+const maxResolveDepth = 32
+
+// parseDocument читает таблицы ссылок от последней к первой. Если они
+// повреждены, таблица восстанавливается поиском заголовков "n g obj".
+func parseDocument(data []byte) (*document, error) {
+	d := &document{data: data, xref: map[int]xrefEntry{}, objStms: map[int64]*objStm{}}
+
+	tail := data
+	if len(tail) > 2048 {
+		tail = tail[len(tail)-2048:]
+	}
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i >= 0 {
+		l := &lexer{buf: tail, pos: i + len("startxref")}
+		if off, err := strconv.ParseInt(l.token(), 10, 64); err == nil {
+			if err := d.loadXref(off, map[int64]bool{}); err == nil && d.trailer["Root"] != nil {
+				return d, nil
+			}
+		}
+	}
+
+	if err := d.rebuildXref(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadXref читает секцию таблицы ссылок по смещению off и все предыдущие.
+// Более новые записи имеют приоритет, поэтому уже известные не перезаписываются.
+func (d *document) loadXref(off int64, seen map[int64]bool) error {
+	if off < 0 || off >= int64(len(d.data)) || seen[off] {
+		return fmt.Errorf("%w: bad xref offset %d", errSyntax, off)
+	}
+	seen[off] = true
+
+	l := &lexer{buf: d.data, pos: int(off)}
+	l.skipSpace()
+
+	var trailer Dict
+	if l.hasPrefix("xref") {
+		l.pos += len("xref")
+		t, err := d.readXrefTable(l)
+		if err != nil {
+			return err
+		}
+		trailer = t
+	} else {
+		_, obj, err := d.readIndirect(int(off))
+		if err != nil {
+			return err
+		}
+		s, ok := obj.(*Stream)
+		if !ok || s.Dict["Type"] != Name("XRef") {
+			return fmt.Errorf("%w: xref expected at %d", errSyntax, off)
+		}
+		if err := d.readXrefStream(s); err != nil {
+			return err
+		}
+		trailer = s.Dict
+	}
+
+	if d.trailer == nil {
+		d.trailer = trailer
+	}
+	// В гибридных файлах часть ссылок вынесена в поток XRefStm
+	if n, ok := trailer["XRefStm"].(Number); ok {
+		if v, ok := n.Int(); ok {
+			d.loadXref(v, seen)
+		}
+	}
+	if n, ok := trailer["Prev"].(Number); ok {
+		if v, ok := n.Int(); ok {
+			return d.loadXref(v, seen)
+		}
+	}
+	return nil
+}
+
+func (d *document) readXrefTable(l *lexer) (Dict, error) {
+	for {
+		tok := l.token()
+		if tok == "trailer" {
+			obj, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			t, ok := obj.(Dict)
+			if !ok {
+				return nil, fmt.Errorf("%w: bad trailer", errSyntax)
+			}
+			return t, nil
+		}
+
+		start, err1 := strconv.Atoi(tok)
+		count, err2 := strconv.Atoi(l.token())
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: bad xref subsection", errSyntax)
+		}
+		for i := 0; i < count; i++ {
+			off, err1 := strconv.ParseInt(l.token(), 10, 64)
+			gen, err2 := strconv.Atoi(l.token())
+			kind := l.token()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, fmt.Errorf("%w: bad xref entry", errSyntax)
+			}
+			num := start + i
+			if _, known := d.xref[num]; known {
+				continue
+			}
+			if kind == "n" {
+				d.xref[num] = xrefEntry{offset: off, gen: gen}
+			} else {
+				d.xref[num] = xrefEntry{offset: -1}
+			}
+		}
+	}
+}
+
+func (d *document) readXrefStream(s *Stream) error {
+	data, err := d.decode(s)
+	if err != nil {
+		return err
+	}
+
+	var w [3]int
+	wa, _ := s.Dict["W"].(Array)
+	if len(wa) != 3 {
+		return fmt.Errorf("%w: bad xref stream /W", errSyntax)
+	}
+	for i := range w {
+		n, _ := wa[i].(Number)
+		v, ok := n.Int()
+		if !ok || v < 0 || v > 8 {
+			return fmt.Errorf("%w: bad xref stream /W", errSyntax)
+		}
+		w[i] = int(v)
+	}
+
+	index := Array{Number("0"), s.Dict["Size"]}
+	if a, ok := s.Dict["Index"].(Array); ok {
+		index = a
+	}
+
+	field := func(b []byte) int64 {
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return v
+	}
+
+	row := w[0] + w[1] + w[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		sn, _ := index[i].(Number)
+		cn, _ := index[i+1].(Number)
+		start, ok1 := sn.Int()
+		count, ok2 := cn.Int()
+		if !ok1 || !ok2 {
+			return fmt.Errorf("%w: bad xref stream /Index", errSyntax)
+		}
+		for j := int64(0); j < count; j++ {
+			if pos+row > len(data) {
+				return fmt.Errorf("%w: truncated xref stream", errSyntax)
+			}
+			kind := int64(1)
+			if w[0] > 0 {
+				kind = field(data[pos : pos+w[0]])
+			}
+			a := field(data[pos+w[0] : pos+w[0]+w[1]])
+			b := field(data[pos+w[0]+w[1] : pos+row])
+			pos += row
+
+			num := int(start + j)
+			if _, known := d.xref[num]; known {
+				continue
+			}
+			switch kind {
+			case 0:
+				d.xref[num] = xrefEntry{offset: -1}
+			case 1:
+				d.xref[num] = xrefEntry{offset: a, gen: int(b)}
+			case 2:
+				d.xref[num] = xrefEntry{inStream: true, offset: a, index: int(b)}
+			}
+		}
+	}
+	return nil
+}
+
+var objHeader = regexp.MustCompile(`(?m)(?:^|[\r\n ])(\d+)[ \t\r\n]+(\d+)[ \t\r\n]+obj\b`)
+
+// rebuildXref восстанавливает таблицу ссылок поиском объектов по всему файлу
+func (d *document) rebuildXref() error {
+	d.xref = map[int]xrefEntry{}
+	for _, m := range objHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(d.data[m[4]:m[5]]))
+		d.xref[num] = xrefEntry{offset: int64(m[2]), gen: gen}
+	}
+
+	d.trailer = nil
+	if i := bytes.LastIndex(d.data, []byte("trailer")); i >= 0 {
+		l := &lexer{buf: d.data, pos: i + len("trailer")}
+		if t, err := l.object(); err == nil {
+			d.trailer, _ = t.(Dict)
+		}
+	}
+	if d.trailer == nil || d.trailer["Root"] == nil {
+		// Без trailer ищем каталог документа среди объектов
+		for num := range d.xref {
+			if dict, ok := d.resolve(Ref{Num: num}).(Dict); ok && dict["Type"] == Name("Catalog") {
+				d.trailer = Dict{"Root": Ref{Num: num, Gen: d.xref[num].gen}}
+				break
+			}
+		}
+	}
+	if d.trailer == nil || d.trailer["Root"] == nil {
+		return errors.New("pdf: document catalog not found")
+	}
+	return nil
+}
+
+// readIndirect читает "n g obj ... endobj" по смещению off
+func (d *document) readIndirect(off int) (Ref, Object, error) {
+	l := &lexer{buf: d.data, pos: off}
+	num, err1 := strconv.Atoi(l.token())
+	gen, err2 := strconv.Atoi(l.token())
+	if err1 != nil || err2 != nil || l.token() != "obj" {
+		return Ref{}, nil, fmt.Errorf("%w: object header expected at %d", errSyntax, off)
+	}
+	ref := Ref{Num: num, Gen: gen}
+
+	obj, err := l.object()
+	if err != nil {
+		return ref, nil, err
+	}
+	dict, ok := obj.(Dict)
+	if !ok {
+		return ref, obj, nil
+	}
+
+	l.skipSpace()
+	if !l.hasPrefix("stream") {
+		return ref, obj, nil
+	}
+	l.pos += len("stream")
+	if l.hasPrefix("\r\n") {
+		l.pos += 2
+	} else if l.hasPrefix("\n") || l.hasPrefix("\r") {
+		l.pos++
+	}
+	start := l.pos
+
+	// Длина может быть ссылкой; если она неверна, ищем endstream
+	length := int64(-1)
+	if n, ok := d.resolve(dict["Length"]).(Number); ok {
+		length, _ = n.Int()
+	}
+	end := start + int(length)
+	if length < 0 || end > len(d.data) || !bytes.HasPrefix(bytes.TrimLeft(d.data[end:], "\r\n "), []byte("endstream")) {
+		i := bytes.Index(d.data[start:], []byte("endstream"))
+		if i < 0 {
+			return ref, nil, fmt.Errorf("%w: endstream not found", errSyntax)
+		}
+		end = start + i
+		for end > start && (d.data[end-1] == '\n' || d.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return ref, &Stream{Dict: dict, Data: d.data[start:end]}, nil
+}
+
+// resolve возвращает объект, на который указывает ссылка; прочие объекты - как есть.
+// Отсутствующий или повреждённый объект - null.
+func (d *document) resolve(o Object) Object {
+	for depth := 0; depth < maxResolveDepth; depth++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o = d.load(ref.Num)
+	}
+	return Keyword("null")
+}
+
+func (d *document) load(num int) Object {
+	e, ok := d.xref[num]
+	if !ok || e.offset < 0 {
+		return Keyword("null")
+	}
+
+	if !e.inStream {
+		ref, obj, err := d.readIndirect(int(e.offset))
+		if err != nil || ref.Num != num {
+			return Keyword("null")
+		}
+		return obj
+	}
+
+	stm, err := d.objStm(e.offset)
+	if err != nil {
+		return Keyword("null")
+	}
+	off, ok := stm.offsets[num]
+	if !ok {
+		return Keyword("null")
+	}
+	l := &lexer{buf: stm.data, pos: stm.first + off}
+	obj, err := l.object()
+	if err != nil {
+		return Keyword("null")
+	}
+	return obj
+}
+
+func (d *document) objStm(num int64) (*objStm, error) {
+	if stm, ok := d.objStms[num]; ok {
+		return stm, nil
+	}
+
+	e, ok := d.xref[int(num)]
+	if !ok || e.inStream || e.offset < 0 {
+		return nil, fmt.Errorf("%w: object stream %d not found", errSyntax, num)
+	}
+	_, obj, err := d.readIndirect(int(e.offset))
+	if err != nil {
+		return nil, err
+	}
+	s, ok := obj.(*Stream)
+	if !ok {
+		return nil, fmt.Errorf("%w: object stream %d is not a stream", errSyntax, num)
+	}
+	data, err := d.decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	nn, _ := d.resolve(s.Dict["N"]).(Number)
+	fn, _ := d.resolve(s.Dict["First"]).(Number)
+	n, ok1 := nn.Int()
+	first, ok2 := fn.Int()
+	if !ok1 || !ok2 || first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("%w: bad object stream %d", errSyntax, num)
+	}
+
+	stm := &objStm{data: data, first: int(first), offsets: map[int]int{}}
+	l := &lexer{buf: data[:first]}
+	for i := int64(0); i < n; i++ {
+		objNum, err1 := strconv.Atoi(l.token())
+		off, err2 := strconv.Atoi(l.token())
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%w: bad object stream %d header", errSyntax, num)
+		}
+		stm.offsets[objNum] = off
+	}
+	d.objStms[num] = stm
+	return stm, nil
+}
+
+// decode распаковывает поток; поддерживается FlateDecode с PNG-предсказателем,
+// которым сжимают таблицы ссылок и потоки объектов
+func (d *document) decode(s *Stream) ([]byte, error) {
+	filters := Array{}
+	switch f := d.resolve(s.Dict["Filter"]).(type) {
+	case Name:
+		filters = Array{f}
+	case Array:
+		filters = f
+	}
+	params := Array{}
+	switch p := d.resolve(s.Dict["DecodeParms"]).(type) {
+	case Dict:
+		params = Array{p}
+	case Array:
+		params = p
+	}
+
+	data := s.Data
+	for i, f := range filters {
+		if f != Name("FlateDecode") {
+			return nil, fmt.Errorf("pdf: unsupported filter %v", f)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(r)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		data = out
+
+		if i < len(params) {
+			if p, ok := d.resolve(params[i]).(Dict); ok {
+				if data, err = d.unpredict(data, p); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// unpredict снимает PNG-предсказатель (Predictor >= 10) построчно
+func (d *document) unpredict(data []byte, p Dict) ([]byte, error) {
+	pred := int64(1)
+	if n, ok := d.resolve(p["Predictor"]).(Number); ok {
+		pred, _ = n.Int()
+	}
+	if pred < 10 {
+		if pred > 1 {
+			return nil, fmt.Errorf("pdf: unsupported predictor %d", pred)
+		}
+		return data, nil
+	}
+
+	param := func(key Name, def int64) int64 {
+		if n, ok := d.resolve(p[key]).(Number); ok {
+			if v, ok := n.Int(); ok && v > 0 {
+				return v
+			}
+		}
+		return def
+	}
+	bpp := int((param("Colors", 1)*param("BitsPerComponent", 8) + 7) / 8)
+	columns := int((param("Columns", 1)*param("Colors", 1)*param("BitsPerComponent", 8) + 7) / 8)
+
+	var out []byte
+	prev := make([]byte, columns)
+	for pos := 0; pos+1+columns <= len(data); pos += 1 + columns {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+columns]...)
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up = prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,338 @@
+package pdfstamp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Объекты PDF, которые нужны для разбора структуры документа.
+// Числа хранятся исходной записью, чтобы при переписывании не терять точность.
+type (
+	Name    string
+	Number  string
+	String  []byte
+	Keyword string // true, false, null
+	Array   []Object
+	Dict    map[Name]Object
+	Ref     struct{ Num, Gen int }
+	Stream  struct {
+		Dict Dict
+		Data []byte // данные как в файле, без декодирования
+	}
+	Object interface{}
+)
+
+var errSyntax = errors.New("pdf syntax error")
+
+// Int возвращает целое значение числа
+func (n Number) Int() (int64, bool) {
+	v, err := strconv.ParseInt(string(n), 10, 64)
+	return v, err == nil
+}
+
+// Float возвращает значение числа
+func (n Number) Float() (float64, bool) {
+	v, err := strconv.ParseFloat(string(n), 64)
+	return v, err == nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// lexer читает объекты PDF из буфера начиная с pos
+type lexer struct {
+	buf []byte
+	pos int
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.buf) {
+		c := l.buf[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.buf) && l.buf[l.pos] != '\n' && l.buf[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token читает слово до пробела или разделителя
+func (l *lexer) token() string {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.buf) && !isSpace(l.buf[l.pos]) && !isDelim(l.buf[l.pos]) {
+		l.pos++
+	}
+	return string(l.buf[start:l.pos])
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.buf[l.pos:], []byte(s))
+}
+
+// object читает один объект; ссылка "n g R" распознаётся по двум числам перед R
+func (l *lexer) object() (Object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.buf) {
+		return nil, errSyntax
+	}
+
+	switch c := l.buf[l.pos]; {
+	case c == '/':
+		l.pos++
+		return l.name(), nil
+	case l.hasPrefix("<<"):
+		l.pos += 2
+		return l.dict()
+	case c == '<':
+		l.pos++
+		return l.hexString()
+	case c == '(':
+		l.pos++
+		return l.literalString()
+	case c == '[':
+		l.pos++
+		return l.array()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		tok := l.token()
+		if _, err := strconv.ParseFloat(tok, 64); err != nil {
+			return nil, fmt.Errorf("%w: bad number %q", errSyntax, tok)
+		}
+		num, gen, ok := l.refTail(tok)
+		if ok {
+			return Ref{Num: num, Gen: gen}, nil
+		}
+		return Number(tok), nil
+	default:
+		tok := l.token()
+		if tok == "" {
+			return nil, fmt.Errorf("%w: unexpected %q at %d", errSyntax, c, l.pos)
+		}
+		return Keyword(tok), nil
+	}
+}
+
+// refTail проверяет, продолжается ли число tok как ссылка "gen R"
+func (l *lexer) refTail(tok string) (num, gen int, ok bool) {
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		return 0, 0, false
+	}
+	save := l.pos
+	g, err := strconv.Atoi(l.token())
+	if err == nil && g >= 0 && l.token() == "R" {
+		return n, g, true
+	}
+	l.pos = save
+	return 0, 0, false
+}
+
+func (l *lexer) name() Name {
+	var b []byte
+	for l.pos < len(l.buf) && !isSpace(l.buf[l.pos]) && !isDelim(l.buf[l.pos]) {
+		c := l.buf[l.pos]
+		if c == '#' && l.pos+2 < len(l.buf) {
+			if v, err := strconv.ParseUint(string(l.buf[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return Name(b)
+}
+
+func (l *lexer) dict() (Dict, error) {
+	d := Dict{}
+	for {
+		l.skipSpace()
+		if l.hasPrefix(">>") {
+			l.pos += 2
+			return d, nil
+		}
+		if l.pos >= len(l.buf) || l.buf[l.pos] != '/' {
+			return nil, fmt.Errorf("%w: dictionary key expected at %d", errSyntax, l.pos)
+		}
+		l.pos++
+		key := l.name()
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		d[key] = value
+	}
+}
+
+func (l *lexer) array() (Array, error) {
+	a := Array{}
+	for {
+		l.skipSpace()
+		if l.pos < len(l.buf) && l.buf[l.pos] == ']' {
+			l.pos++
+			return a, nil
+		}
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+}
+
+func (l *lexer) hexString() (String, error) {
+	end := bytes.IndexByte(l.buf[l.pos:], '>')
+	if end < 0 {
+		return nil, errSyntax
+	}
+	var digits []byte
+	for _, c := range l.buf[l.pos : l.pos+end] {
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make(String, len(digits)/2)
+	for i := range s {
+		v, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad hex string", errSyntax)
+		}
+		s[i] = byte(v)
+	}
+	return s, nil
+}
+
+func (l *lexer) literalString() (String, error) {
+	var s String
+	depth := 1
+	for l.pos < len(l.buf) {
+		c := l.buf[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s, nil
+			}
+		case '\\':
+			if l.pos >= len(l.buf) {
+				return nil, errSyntax
+			}
+			e := l.buf[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.buf) && l.buf[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.buf) && l.buf[l.pos] >= '0' && l.buf[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.buf[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, errSyntax
+}
+
+// writeObject записывает объект в синтаксисе PDF
+func writeObject(b *bytes.Buffer, o Object) {
+	switch v := o.(type) {
+	case Name:
+		b.WriteByte('/')
+		for _, c := range []byte(v) {
+			if c < 0x21 || c > 0x7e || c == '#' || isDelim(c) {
+				fmt.Fprintf(b, "#%02X", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	case Number:
+		b.WriteString(string(v))
+	case Keyword:
+		b.WriteString(string(v))
+	case String:
+		fmt.Fprintf(b, "<%X>", []byte(v))
+	case Ref:
+		fmt.Fprintf(b, "%d %d R", v.Num, v.Gen)
+	case Array:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writeObject(b, item)
+		}
+		b.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		b.WriteString("<<")
+		for _, k := range keys {
+			writeObject(b, Name(k))
+			b.WriteByte(' ')
+			writeObject(b, v[Name(k)])
+		}
+		b.WriteString(">>")
+	case *Stream:
+		d := Dict{}
+		for k, val := range v.Dict {
+			d[k] = val
+		}
+		d["Length"] = Number(strconv.Itoa(len(v.Data)))
+		writeObject(b, d)
+		b.WriteString("\nstream\n")
+		b.Write(v.Data)
+		b.WriteString("\nendstream")
+	default:
+		b.WriteString("null")
+	}
+}
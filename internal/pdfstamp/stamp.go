@@ -0,0 +1,338 @@
+// Package pdfstamp наносит текстовый водяной знак на страницы PDF без
+// внешних библиотек. Документ переписывается целиком, чтобы исходную
+// версию страниц нельзя было извлечь из результата.
+package pdfstamp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrEncrypted - зашифрованный PDF нельзя изменить без пароля
+var ErrEncrypted = errors.New("pdf: encrypted documents are not supported")
+
+// Прозрачность водяного знака: крупная надпись по диагонали и строка внизу страницы
+const (
+	diagonalOpacity = "0.15"
+	footerOpacity   = "0.6"
+	footerFontSize  = 7.0
+)
+
+// page - страница с унаследованными от дерева страниц атрибутами
+type page struct {
+	ref       Ref
+	dict      Dict
+	resources Object
+	box       Array
+}
+
+// Stamp наносит на каждую страницу src строки lines: по диагонали через всю
+// страницу и мелким шрифтом внизу. Текст выводится шрифтом Helvetica,
+// кириллица транслитерируется.
+func Stamp(src []byte, lines []string) ([]byte, error) {
+	doc, err := parseDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+
+	root, ok := doc.resolve(doc.trailer["Root"]).(Dict)
+	if !ok {
+		return nil, errors.New("pdf: document catalog not found")
+	}
+	var pages []page
+	if err := doc.collectPages(root["Pages"], nil, nil, map[int]bool{}, &pages); err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("pdf: document has no pages")
+	}
+
+	// Номера новых объектов начинаются после наибольшего известного
+	next := 1
+	if n, ok := doc.trailer["Size"].(Number); ok {
+		if v, ok := n.Int(); ok {
+			next = int(v)
+		}
+	}
+	for num := range doc.xref {
+		if num >= next {
+			next = num + 1
+		}
+	}
+	objects := map[Ref]Object{}
+	add := func(o Object) Ref {
+		ref := Ref{Num: next}
+		next++
+		objects[ref] = o
+		return ref
+	}
+
+	font := add(Dict{"Type": Name("Font"), "Subtype": Name("Type1"), "BaseFont": Name("Helvetica"), "Encoding": Name("WinAnsiEncoding")})
+	diagonalGS := add(Dict{"Type": Name("ExtGState"), "ca": Number(diagonalOpacity), "CA": Number(diagonalOpacity)})
+	footerGS := add(Dict{"Type": Name("ExtGState"), "ca": Number(footerOpacity), "CA": Number(footerOpacity)})
+	// Исходное содержимое обрамляется q/Q, чтобы его графическое состояние не влияло на знак
+	open := add(&Stream{Dict: Dict{}, Data: []byte("q")})
+
+	text := encodeText(strings.Join(lines, "  |  "))
+	footer := encodeText(strings.Join(lines, ", "))
+
+	for _, p := range pages {
+		resources := doc.copyDict(p.resources)
+		fonts := doc.copyDict(resources["Font"])
+		states := doc.copyDict(resources["ExtGState"])
+		fontName := freeName(fonts, "WmF")
+		fonts[fontName] = font
+		diagonalName := freeName(states, "WmGS")
+		states[diagonalName] = diagonalGS
+		footerName := freeName(states, "WmGS")
+		states[footerName] = footerGS
+		resources["Font"] = fonts
+		resources["ExtGState"] = states
+
+		content := stampContent(doc.rect(p.box), text, footer, fontName, diagonalName, footerName)
+		stamp := add(&Stream{Dict: Dict{}, Data: content})
+
+		contents := Array{open}
+		switch c := p.dict["Contents"].(type) {
+		case Ref:
+			if a, ok := doc.resolve(c).(Array); ok {
+				contents = append(contents, a...)
+			} else {
+				contents = append(contents, c)
+			}
+		case Array:
+			contents = append(contents, c...)
+		}
+		contents = append(contents, stamp)
+
+		updated := Dict{}
+		for k, v := range p.dict {
+			updated[k] = v
+		}
+		updated["Contents"] = contents
+		updated["Resources"] = resources
+		if updated["MediaBox"] == nil && p.box != nil {
+			updated["MediaBox"] = p.box
+		}
+		objects[p.ref] = updated
+	}
+
+	return doc.write(objects, next), nil
+}
+
+// collectPages обходит дерево страниц, передавая вниз наследуемые ресурсы и размеры
+func (d *document) collectPages(node Object, resources Object, box Array, seen map[int]bool, pages *[]page) error {
+	ref, ok := node.(Ref)
+	if !ok {
+		return errors.New("pdf: page tree node must be an indirect object")
+	}
+	if seen[ref.Num] {
+		return errors.New("pdf: page tree has a cycle")
+	}
+	seen[ref.Num] = true
+
+	dict, ok := d.resolve(ref).(Dict)
+	if !ok {
+		return errors.New("pdf: bad page tree node")
+	}
+	if r := dict["Resources"]; r != nil {
+		resources = r
+	}
+	if b, ok := d.resolve(dict["MediaBox"]).(Array); ok {
+		box = b
+	}
+	if b, ok := d.resolve(dict["CropBox"]).(Array); ok {
+		box = b
+	}
+
+	kids, isTree := d.resolve(dict["Kids"]).(Array)
+	if !isTree || dict["Type"] == Name("Page") {
+		*pages = append(*pages, page{ref: ref, dict: dict, resources: resources, box: box})
+		return nil
+	}
+	for _, kid := range kids {
+		if err := d.collectPages(kid, resources, box, seen, pages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDict возвращает копию словаря (или словаря по ссылке), чтобы добавить в неё ключи
+func (d *document) copyDict(o Object) Dict {
+	result := Dict{}
+	if src, ok := d.resolve(o).(Dict); ok {
+		for k, v := range src {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// rect возвращает видимую область страницы; по умолчанию - A4
+func (d *document) rect(box Array) [4]float64 {
+	r := [4]float64{0, 0, 595, 842}
+	if len(box) != 4 {
+		return r
+	}
+	for i, v := range box {
+		n, ok := d.resolve(v).(Number)
+		f, ok2 := n.Float()
+		if !ok || !ok2 {
+			return [4]float64{0, 0, 595, 842}
+		}
+		r[i] = f
+	}
+	return [4]float64{math.Min(r[0], r[2]), math.Min(r[1], r[3]), math.Max(r[0], r[2]), math.Max(r[1], r[3])}
+}
+
+// freeName возвращает имя ресурса с префиксом prefix, которого ещё нет в словаре
+func freeName(d Dict, prefix string) Name {
+	for i := 1; ; i++ {
+		name := Name(prefix + strconv.Itoa(i))
+		if _, taken := d[name]; !taken {
+			return name
+		}
+	}
+}
+
+// stampContent строит поток содержимого с водяным знаком для страницы rect
+func stampContent(rect [4]float64, text, footer []byte, font, diagonalGS, footerGS Name) []byte {
+	x0, y0 := rect[0], rect[1]
+	w, h := rect[2]-rect[0], rect[3]-rect[1]
+
+	var b bytes.Buffer
+	b.WriteString("\nQ\nq\n")
+
+	// Диагональ: текст занимает около 80% диагонали страницы
+	diag := math.Hypot(w, h)
+	size := math.Max(8, math.Min(48, 0.8*diag/math.Max(textWidth(text, 1), 1)))
+	angle := math.Atan2(h, w)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	fmt.Fprintf(&b, "/%s gs 0.5 g\n", diagonalGS)
+	fmt.Fprintf(&b, "%s %s %s %s %s %s cm\n", num(cos), num(sin), num(-sin), num(cos), num(x0+w/2), num(y0+h/2))
+	fmt.Fprintf(&b, "BT /%s %s Tf %s %s Td ", font, num(size), num(-textWidth(text, size)/2), num(-size/3))
+	writeText(&b, text)
+	b.WriteString(" Tj ET\nQ\nq\n")
+
+	// Нижняя строка, уменьшенная до ширины страницы
+	fsize := math.Min(footerFontSize, (w-40)/math.Max(textWidth(footer, 1), 1))
+	fmt.Fprintf(&b, "/%s gs 0 g\n", footerGS)
+	fmt.Fprintf(&b, "BT /%s %s Tf %s %s Td ", font, num(fsize), num(x0+20), num(y0+12))
+	writeText(&b, footer)
+	b.WriteString(" Tj ET\nQ\n")
+	return b.Bytes()
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
+
+func writeText(b *bytes.Buffer, text []byte) {
+	b.WriteByte('(')
+	for _, c := range text {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+}
+
+// minVersion - версия PDF, в которой появилась прозрачность (ExtGState ca/CA)
+const minVersion = "1.4"
+
+// write переписывает документ целиком: все действующие объекты исходного файла
+// с заменами из objects, новая таблица ссылок и trailer. Прежние версии страниц
+// в файл не попадают, поэтому исходный документ без знака из результата не
+// восстановить. Объекты из потоков объектов записываются обычными объектами.
+func (d *document) write(objects map[Ref]Object, size int) []byte {
+	all := map[int]Ref{}
+	for num, e := range d.xref {
+		if e.offset >= 0 {
+			all[num] = Ref{Num: num, Gen: e.gen}
+		}
+	}
+	for ref := range objects {
+		all[ref.Num] = ref
+	}
+	nums := make([]int, 0, len(all))
+	for num := range all {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", d.version())
+
+	offsets := map[int]int64{}
+	for _, num := range nums {
+		ref := all[num]
+		obj, replaced := objects[ref]
+		if !replaced {
+			obj = d.load(num)
+			if !keepObject(obj) {
+				continue
+			}
+		}
+		offsets[num] = int64(b.Len())
+		fmt.Fprintf(&b, "%d %d obj\n", ref.Num, ref.Gen)
+		writeObject(&b, obj)
+		b.WriteString("\nendobj\n")
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n", size)
+	b.WriteString("0000000000 65535 f\r\n")
+	for num := 1; num < size; num++ {
+		if off, ok := offsets[num]; ok {
+			fmt.Fprintf(&b, "%010d %05d n\r\n", off, all[num].Gen)
+		} else {
+			b.WriteString("0000000000 00000 f\r\n")
+		}
+	}
+
+	trailer := Dict{"Size": Number(strconv.Itoa(size)), "Root": d.trailer["Root"]}
+	for _, key := range []Name{"Info", "ID"} {
+		if v := d.trailer[key]; v != nil {
+			trailer[key] = v
+		}
+	}
+	b.WriteString("trailer\n")
+	writeObject(&b, trailer)
+	fmt.Fprintf(&b, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return b.Bytes()
+}
+
+// keepObject отбрасывает при переписывании повреждённые объекты и служебные
+// структуры старой раскладки файла: таблицы и потоки объектов, словарь линеаризации
+func keepObject(o Object) bool {
+	switch v := o.(type) {
+	case Keyword:
+		return v != "null"
+	case *Stream:
+		return v.Dict["Type"] != Name("XRef") && v.Dict["Type"] != Name("ObjStm")
+	case Dict:
+		return v["Linearized"] == nil
+	}
+	return true
+}
+
+// version возвращает версию PDF из заголовка исходного файла, не ниже minVersion
+func (d *document) version() string {
+	v := minVersion
+	if rest, ok := bytes.CutPrefix(d.data, []byte("%PDF-")); ok && len(rest) >= 3 {
+		if orig := string(rest[:3]); orig[1] == '.' && orig > v && orig[0] >= '1' && orig[0] <= '9' {
+			v = orig
+		}
+	}
+	return v
+}
@@ -0,0 +1,447 @@
+package pdfstamp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testLines = []string{"Ivan Petrov", "id 42", "2026-10-17"}
+
+// fixtureObject - объект фикстуры: номер и всё, что стоит между "obj" и "endobj"
+type fixtureObject struct {
+	num  int
+	body string
+}
+
+func streamBody(dict string, data []byte) string {
+	return fmt.Sprintf("<<%s /Length %d>>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// classicPDF собирает PDF с обычной таблицей ссылок; trailer - содержимое
+// словаря trailer без /Size
+func classicPDF(trailer string, objects ...fixtureObject) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.3\n")
+	offsets := map[int]int{}
+	size := 1
+	for _, o := range objects {
+		offsets[o.num] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", o.num, o.body)
+		size = max(size, o.num+1)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f\r\n", size)
+	for num := 1; num < size; num++ {
+		if off, ok := offsets[num]; ok {
+			fmt.Fprintf(&b, "%010d 00000 n\r\n", off)
+		} else {
+			b.WriteString("0000000000 00000 f\r\n")
+		}
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d %s>>\nstartxref\n%d\n%%%%EOF\n", size, trailer, xref)
+	return b.Bytes()
+}
+
+// compressedPDF собирает PDF 1.5: словари дерева страниц лежат в сжатом потоке
+// объектов, а таблица ссылок - поток XRef с PNG-предсказателем, как в файлах
+// из современных редакторов
+func compressedPDF(t *testing.T, plain, packed []fixtureObject) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+	offsets := map[int]int{}
+	size := 1
+	for _, o := range append(append([]fixtureObject{}, plain...), packed...) {
+		size = max(size, o.num+1)
+	}
+	stmNum, xrefNum := size, size+1
+	size += 2
+
+	for _, o := range plain {
+		offsets[o.num] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", o.num, o.body)
+	}
+
+	var header, body bytes.Buffer
+	for _, o := range packed {
+		fmt.Fprintf(&header, "%d %d ", o.num, body.Len())
+		body.WriteString(o.body + "\n")
+	}
+	stm := append(header.Bytes(), body.Bytes()...)
+	offsets[stmNum] = b.Len()
+	fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", stmNum, streamBody(
+		fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(packed), header.Len()),
+		deflate(t, stm)))
+
+	// Строки таблицы: тип (1 байт), смещение или номер потока (4), поколение или индекс (2)
+	offsets[xrefNum] = b.Len()
+	rows := make([][]byte, size)
+	for num := range rows {
+		row := make([]byte, 7)
+		if off, ok := offsets[num]; ok {
+			row[0] = 1
+			binary.BigEndian.PutUint32(row[1:5], uint32(off))
+		}
+		rows[num] = row
+	}
+	for i, o := range packed {
+		row := rows[o.num]
+		row[0] = 2
+		binary.BigEndian.PutUint32(row[1:5], uint32(stmNum))
+		binary.BigEndian.PutUint16(row[5:7], uint16(i))
+	}
+	rows[0][5], rows[0][6] = 0xff, 0xff
+
+	// PNG-предсказатель Up: каждая строка - разность с предыдущей
+	var table []byte
+	prev := make([]byte, 7)
+	for _, row := range rows {
+		table = append(table, 2)
+		for i := range row {
+			table = append(table, row[i]-prev[i])
+		}
+		prev = row
+	}
+	fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", xrefNum, streamBody(
+		fmt.Sprintf("/Type /XRef /Size %d /W [1 4 2] /Root 1 0 R /Filter /FlateDecode /DecodeParms <</Predictor 12 /Columns 7>>", size),
+		deflate(t, table)))
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", offsets[xrefNum])
+	return b.Bytes()
+}
+
+// strictParse разбирает PDF только по его таблице ссылок, без восстановления
+// поиском объектов: так проверяется, что Stamp записал верные смещения
+func strictParse(t *testing.T, data []byte) *document {
+	t.Helper()
+	d := &document{data: data, xref: map[int]xrefEntry{}, objStms: map[int64]*objStm{}}
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		t.Fatal("output has no startxref")
+	}
+	off, err := strconv.ParseInt((&lexer{buf: data, pos: i + len("startxref")}).token(), 10, 64)
+	if err != nil {
+		t.Fatalf("bad startxref: %v", err)
+	}
+	if err := d.loadXref(off, map[int64]bool{}); err != nil {
+		t.Fatalf("output xref does not parse: %v", err)
+	}
+	for num, e := range d.xref {
+		if e.inStream || e.offset < 0 {
+			continue
+		}
+		if ref, _, err := d.readIndirect(int(e.offset)); err != nil || ref.Num != num {
+			t.Errorf("xref entry %d points to %v, %v", num, ref, err)
+		}
+	}
+	return d
+}
+
+// checkStamped проверяет результат Stamp: файл разбирается своей же таблицей
+// ссылок, на каждой странице знак выводится последним, а исходное содержимое
+// wantContents[i] страницы i сохраняется между q и знаком
+func checkStamped(t *testing.T, out []byte, wantContents [][]string) *document {
+	t.Helper()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.")) {
+		t.Fatalf("output starts with %q", out[:min(len(out), 10)])
+	}
+	d := strictParse(t, out)
+	if d.trailer["Encrypt"] != nil {
+		t.Error("output trailer has /Encrypt")
+	}
+	root, ok := d.resolve(d.trailer["Root"]).(Dict)
+	if !ok {
+		t.Fatal("output has no catalog")
+	}
+	var pages []page
+	if err := d.collectPages(root["Pages"], nil, nil, map[int]bool{}, &pages); err != nil {
+		t.Fatalf("output page tree: %v", err)
+	}
+	if len(pages) != len(wantContents) {
+		t.Fatalf("output has %d pages, want %d", len(pages), len(wantContents))
+	}
+
+	for i, p := range pages {
+		contents, ok := d.resolve(p.dict["Contents"]).(Array)
+		if !ok || len(contents) < 2 {
+			t.Errorf("page %d: /Contents = %v, want an array", i+1, p.dict["Contents"])
+			continue
+		}
+		var streams []string
+		for _, c := range contents {
+			s, ok := d.resolve(c).(*Stream)
+			if !ok {
+				t.Errorf("page %d: content %v is not a stream", i+1, c)
+				continue
+			}
+			data, err := d.decode(s)
+			if err != nil {
+				t.Errorf("page %d: content %v: %v", i+1, c, err)
+			}
+			streams = append(streams, string(data))
+		}
+		if len(streams) != len(contents) {
+			continue
+		}
+
+		last := streams[len(streams)-1]
+		if !strings.Contains(last, "Tj ET") || !strings.Contains(last, "Ivan Petrov") {
+			t.Errorf("page %d: last content stream is not the overlay: %q", i+1, last)
+		}
+		if streams[0] != "q" {
+			t.Errorf("page %d: first content stream = %q, want q", i+1, streams[0])
+		}
+		if got := streams[1 : len(streams)-1]; strings.Join(got, "|") != strings.Join(wantContents[i], "|") {
+			t.Errorf("page %d: original content = %q, want %q", i+1, got, wantContents[i])
+		}
+
+		resources, ok := d.resolve(p.dict["Resources"]).(Dict)
+		if !ok {
+			t.Errorf("page %d: no /Resources", i+1)
+			continue
+		}
+		fonts, _ := d.resolve(resources["Font"]).(Dict)
+		states, _ := d.resolve(resources["ExtGState"]).(Dict)
+		// Шрифт, которым выводится знак, есть в ресурсах страницы
+		used := false
+		for name := range fonts {
+			used = used || strings.Contains(last, "/"+string(name)+" ")
+		}
+		if !used {
+			t.Errorf("page %d: overlay font is not in page fonts %v", i+1, fonts)
+		}
+		if len(states) < 2 {
+			t.Errorf("page %d: ExtGState = %v, want the overlay states", i+1, states)
+		}
+	}
+	return d
+}
+
+func stamp(t *testing.T, src []byte) []byte {
+	t.Helper()
+	out, err := Stamp(src, testLines)
+	if err != nil {
+		t.Fatalf("Stamp = %v", err)
+	}
+	return out
+}
+
+const content1 = "BT /F1 12 Tf 72 720 Td (Lesson one) Tj ET"
+const content2 = "BT /F1 12 Tf 72 700 Td (Page two) Tj ET"
+
+func TestStampClassicXref(t *testing.T) {
+	src := classicPDF("/Root 1 0 R /Info 7 0 R",
+		fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+		fixtureObject{2, "<</Type /Pages /Kids [3 0 R 5 0 R] /Count 2>>"},
+		fixtureObject{3, "<</Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources <</Font <</F1 6 0 R>>>> /Contents 4 0 R>>"},
+		fixtureObject{4, streamBody("", []byte(content1))},
+		fixtureObject{5, "<</Type /Page /Parent 2 0 R /MediaBox [0 0 842 595] /Resources <</Font <</F1 6 0 R /WmF1 6 0 R>>>> /Contents 8 0 R>>"},
+		fixtureObject{6, "<</Type /Font /Subtype /Type1 /BaseFont /Times-Roman>>"},
+		fixtureObject{7, "<</Title (Lessons)>>"},
+		fixtureObject{8, streamBody("/Filter /FlateDecode", deflate(t, []byte(content2)))},
+	)
+	out := stamp(t, src)
+	d := checkStamped(t, out, [][]string{{content1}, {content2}})
+
+	if d.trailer["Info"] == nil {
+		t.Error("trailer lost /Info")
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) {
+		t.Errorf("output version is %q, want at least 1.4 for transparency", out[:8])
+	}
+
+	// Занятое имя ресурса не перезаписывается
+	var pages []page
+	d.collectPages(d.resolve(d.trailer["Root"]).(Dict)["Pages"], nil, nil, map[int]bool{}, &pages)
+	fonts := d.resolve(d.resolve(pages[1].dict["Resources"]).(Dict)["Font"]).(Dict)
+	if fonts["WmF1"] != (Ref{Num: 6}) || fonts["WmF2"] == nil {
+		t.Errorf("second page fonts = %v, want WmF1 kept and the overlay font as WmF2", fonts)
+	}
+}
+
+func TestStampXrefStream(t *testing.T) {
+	src := compressedPDF(t,
+		[]fixtureObject{
+			{1, "<</Type /Catalog /Pages 2 0 R>>"},
+			{4, streamBody("/Filter /FlateDecode", deflate(t, []byte(content1)))},
+		},
+		[]fixtureObject{
+			{2, "<</Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 595 842]>>"},
+			{3, "<</Type /Page /Parent 2 0 R /Resources <<>> /Contents 4 0 R>>"},
+		},
+	)
+	// Фикстура читается по потоку XRef, а не восстановлением
+	if in := strictParse(t, src); !in.xref[2].inStream {
+		t.Fatalf("fixture: object 2 is not in an object stream: %+v", in.xref[2])
+	}
+	out := stamp(t, src)
+	d := checkStamped(t, out, [][]string{{content1}})
+
+	// Объекты из потока объектов записаны обычными, служебные потоки отброшены
+	if bytes.Contains(out, []byte("/ObjStm")) || bytes.Contains(out, []byte("/XRef")) {
+		t.Error("output still contains the object or xref stream")
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-1.5")) {
+		t.Errorf("output version is %q, want the original 1.5", out[:8])
+	}
+	if _, ok := d.resolve(Ref{Num: 2}).(Dict); !ok {
+		t.Error("page tree root from the object stream is missing")
+	}
+}
+
+func TestStampInheritedResources(t *testing.T) {
+	src := classicPDF("/Root 1 0 R",
+		fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+		fixtureObject{2, "<</Type /Pages /Kids [3 0 R] /Count 2 /Resources 7 0 R /MediaBox [0 0 400 300]>>"},
+		fixtureObject{3, "<</Type /Pages /Parent 2 0 R /Kids [4 0 R 5 0 R] /Count 2>>"},
+		fixtureObject{4, "<</Type /Page /Parent 3 0 R /Contents 6 0 R>>"},
+		fixtureObject{5, "<</Type /Page /Parent 3 0 R /Contents 8 0 R /CropBox [10 10 200 150]>>"},
+		fixtureObject{6, streamBody("", []byte(content1))},
+		fixtureObject{7, "<</Font <</F1 9 0 R>> /ExtGState <</WmGS1 <</ca 1>>>>>>"},
+		fixtureObject{8, streamBody("", []byte(content2))},
+		fixtureObject{9, "<</Type /Font /Subtype /Type1 /BaseFont /Courier>>"},
+	)
+	out := stamp(t, src)
+	d := checkStamped(t, out, [][]string{{content1}, {content2}})
+
+	var pages []page
+	d.collectPages(d.resolve(d.trailer["Root"]).(Dict)["Pages"], nil, nil, map[int]bool{}, &pages)
+	for i, p := range pages {
+		resources := d.resolve(p.dict["Resources"]).(Dict)
+		fonts := d.resolve(resources["Font"]).(Dict)
+		if fonts["F1"] != (Ref{Num: 9}) {
+			t.Errorf("page %d lost the inherited font F1: %v", i+1, fonts)
+		}
+		states := d.resolve(resources["ExtGState"]).(Dict)
+		if _, ok := states["WmGS1"].(Dict); !ok || len(states) != 3 {
+			t.Errorf("page %d ExtGState = %v, want the inherited WmGS1 and two overlay states", i+1, states)
+		}
+	}
+	if box, _ := d.resolve(pages[0].dict["MediaBox"]).(Array); len(box) != 4 || box[2] != Number("400") {
+		t.Errorf("first page MediaBox = %v, want the inherited [0 0 400 300]", box)
+	}
+
+	// Общий словарь ресурсов дерева не меняется: знак добавляется в копию на странице
+	if shared, _ := d.resolve(Ref{Num: 7}).(Dict); len(d.resolve(shared["ExtGState"]).(Dict)) != 1 {
+		t.Errorf("shared resources changed: %v", shared)
+	}
+}
+
+func TestStampContentsArray(t *testing.T) {
+	part := func(s string) string { return streamBody("", []byte(s)) }
+	src := classicPDF("/Root 1 0 R",
+		fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+		fixtureObject{2, "<</Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 /Resources <<>>>>"},
+		// Массив прямо в странице, массив по ссылке и страница без содержимого
+		fixtureObject{3, "<</Type /Page /Parent 2 0 R /Contents [6 0 R 7 0 R]>>"},
+		fixtureObject{4, "<</Type /Page /Parent 2 0 R /Contents 8 0 R>>"},
+		fixtureObject{5, "<</Type /Page /Parent 2 0 R>>"},
+		fixtureObject{6, part("q 1 0 0 1 0 0 cm")},
+		fixtureObject{7, part(content1 + " Q")},
+		fixtureObject{8, "[6 0 R 9 0 R]"},
+		fixtureObject{9, part(content2 + " Q")},
+	)
+	out := stamp(t, src)
+	checkStamped(t, out, [][]string{
+		{"q 1 0 0 1 0 0 cm", content1 + " Q"},
+		{"q 1 0 0 1 0 0 cm", content2 + " Q"},
+		{},
+	})
+}
+
+func TestStampEncrypted(t *testing.T) {
+	src := classicPDF("/Root 1 0 R /Encrypt 5 0 R /ID [<01> <01>]",
+		fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+		fixtureObject{2, "<</Type /Pages /Kids [3 0 R] /Count 1>>"},
+		fixtureObject{3, "<</Type /Page /Parent 2 0 R /Contents 4 0 R>>"},
+		fixtureObject{4, streamBody("", []byte("encrypted bytes"))},
+		fixtureObject{5, "<</Filter /Standard /V 2 /R 3 /O <00> /U <00> /P -4>>"},
+	)
+	if out, err := Stamp(src, testLines); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Stamp(encrypted) = %d bytes, %v; want ErrEncrypted", len(out), err)
+	}
+}
+
+// TestStampMalformed: повреждённый файл даёт ошибку или целый результат, но не панику
+func TestStampMalformed(t *testing.T) {
+	valid := classicPDF("/Root 1 0 R",
+		fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+		fixtureObject{2, "<</Type /Pages /Kids [3 0 R] /Count 1>>"},
+		fixtureObject{3, "<</Type /Page /Parent 2 0 R /Resources <</Font <</F1 5 0 R>>>> /Contents 4 0 R>>"},
+		fixtureObject{4, streamBody("/Filter /FlateDecode", deflate(t, []byte(content1)))},
+		fixtureObject{5, "<</Type /Font /Subtype /Type1 /BaseFont /Helvetica>>"},
+	)
+	compressed := compressedPDF(t,
+		[]fixtureObject{{1, "<</Type /Catalog /Pages 2 0 R>>"}, {4, streamBody("", []byte(content1))}},
+		[]fixtureObject{{2, "<</Type /Pages /Kids [3 0 R] /Count 1>>"}, {3, "<</Type /Page /Parent 2 0 R /Contents 4 0 R>>"}},
+	)
+
+	stampSafely := func(t *testing.T, name string, src []byte) ([]byte, error) {
+		t.Helper()
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("%s: Stamp panicked: %v", name, r)
+			}
+		}()
+		return Stamp(src, testLines)
+	}
+
+	// Обрезанный файл: либо ошибка, либо восстановленный по объектам документ
+	for _, src := range [][]byte{valid, compressed} {
+		for n := 0; n < len(src); n += 7 {
+			out, err := stampSafely(t, fmt.Sprintf("first %d bytes", n), src[:n])
+			if err == nil {
+				strictParse(t, out)
+			}
+		}
+	}
+
+	for name, src := range map[string][]byte{
+		"empty":               nil,
+		"not a pdf":           []byte("hello, world"),
+		"header only":         []byte("%PDF-1.7\n"),
+		"no catalog":          classicPDF("/Root 1 0 R", fixtureObject{1, "<</Type /Pages /Kids [] /Count 0>>"}),
+		"no pages":            classicPDF("/Root 1 0 R", fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"}, fixtureObject{2, "<</Type /Pages /Kids [] /Count 0>>"}),
+		"page tree cycle":     classicPDF("/Root 1 0 R", fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"}, fixtureObject{2, "<</Type /Pages /Kids [3 0 R] /Count 1>>"}, fixtureObject{3, "<</Type /Pages /Kids [2 0 R] /Count 1>>"}),
+		"direct kid":          classicPDF("/Root 1 0 R", fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"}, fixtureObject{2, "<</Type /Pages /Kids [<</Type /Page>>] /Count 1>>"}),
+		"self reference":      classicPDF("/Root 1 0 R", fixtureObject{1, "1 0 R"}),
+		"unterminated string": append(bytes.Clone(valid[:bytes.Index(valid, []byte("4 0 obj"))]), "4 0 obj\n(never closed"...),
+		"bad stream filter": classicPDF("/Root 1 0 R",
+			fixtureObject{1, "<</Type /Catalog /Pages 2 0 R>>"},
+			fixtureObject{2, "<</Type /Pages /Kids [3 0 R] /Count 1>>"},
+			fixtureObject{3, "<</Type /Page /Parent 2 0 R /Contents 4 0 R>>"},
+			fixtureObject{4, streamBody("/Filter /FlateDecode /Length 999999", []byte("not zlib"))},
+		),
+	} {
+		out, err := stampSafely(t, name, src)
+		switch name {
+		case "unterminated string", "bad stream filter":
+			// Повреждено только содержимое страницы: знак всё равно наносится
+			if err == nil {
+				strictParse(t, out)
+			}
+		default:
+			if err == nil {
+				t.Errorf("%s: Stamp succeeded, want an error", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package pdfstamp
+
+import (
+	"strings"
+	"unicode"
+)
+
+// translit - латинская запись русских букв. Стандартный шрифт Helvetica
+// не содержит кириллицы, а встраивать шрифт ради водяного знака дорого.
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// encodeText переводит строку в байты WinAnsi: ASCII остаётся как есть,
+// кириллица транслитерируется, прочие символы заменяются на '?'
+func encodeText(s string) []byte {
+	var b []byte
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			b = append(b, byte(r))
+			continue
+		}
+		lower := unicode.ToLower(r)
+		t, ok := translit[lower]
+		switch {
+		case !ok:
+			b = append(b, '?')
+		case lower != r && t != "":
+			b = append(b, strings.ToUpper(t[:1])+t[1:]...)
+		default:
+			b = append(b, t...)
+		}
+	}
+	return b
+}
+
+// helveticaWidths - ширина символов 32..126 шрифта Helvetica в тысячных долях кегля
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth возвращает ширину текста при кегле size
+func textWidth(text []byte, size float64) float64 {
+	total := 0
+	for _, c := range text {
+		if c >= 32 && c <= 126 {
+			total += helveticaWidths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
@@ -0,0 +1,335 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+
+	"myapp/internal/models"
+)
+
+// Action - действие, право на которое проверяет политика
+type Action string
+
+const (
+	ActionViewUser       Action = "user:view"            // просмотр пользователя и его данных
+	ActionUpdateUserData Action = "user:update-data"     // изменение ссылок и модулей пользователя
+	ActionRegisterUser   Action = "user:register"        // регистрация нового пользователя
+	ActionUpdateUser     Action = "user:update"          // имя, филиал и пароль
+	ActionChangeStatus   Action = "user:status"          // заморозка, удаление и восстановление
+	ActionChangeRole     Action = "user:role"            // смена роли
+	ActionPurgeUser      Action = "user:purge"           // безвозвратное удаление
+	ActionRevokeSessions Action = "user:revoke-sessions" // отзыв всех сессий
+	ActionResetPassword  Action = "user:reset-password"  // выдача кода сброса пароля
+	ActionReset2FA       Action = "user:reset-2fa"       // сброс второго фактора при потере устройства
+	ActionTransferUser   Action = "user:transfer"        // перевод пользователя в другой филиал
+	ActionListOwnModules Action = "modules:list-own"     // список модулей, выданных тьютору
+	ActionViewModule     Action = "modules:view"         // файлы модуля
+	ActionManageModules  Action = "modules:manage"       // каталог модулей: создание, изменение, архив, порядок
+	ActionGrantModules   Action = "modules:grant"        // выдача, продление и отзыв доступа тьютора к модулю
+	ActionEnroll         Action = "enrollments:manage"   // запись ученика на модуль, смена тьютора, отчисление
+	ActionViewProgress   Action = "progress:view"        // прогресс ученика по модулю
+	ActionUpdateProgress Action = "progress:update"      // отметки об уроках
+	ActionManageGroups   Action = "groups:manage"        // создание и изменение учебных групп
+	ActionViewGroup      Action = "groups:view"          // группа, расписание и занятия
+	ActionMarkAttendance Action = "attendance:mark"      // отметки о посещении занятий группы
+	ActionViewAttendance Action = "attendance:view"      // история посещений ученика
+	ActionViewFile       Action = "files:view"           // просмотр PDF урока
+	ActionManageFiles    Action = "files:manage"         // загрузка, замена и удаление PDF уроков
+	ActionViewDownloads  Action = "files:downloads"      // журнал скачиваний PDF уроков
+	ActionBackup         Action = "store:backup"         // скачивание резервной копии всех данных
+	ActionRestore        Action = "store:restore"        // восстановление данных из резервной копии
+	ActionManageFilials  Action = "filials:manage"       // создание, изменение и удаление филиалов
+	ActionFilialStats    Action = "filials:stats"        // число пользователей филиала по ролям и статусам
+	ActionViewAudit      Action = "audit:view"           // журнал аудита
+	ActionManageLockouts Action = "auth:lockouts"        // список и снятие блокировок входа
+)
+
+// RoleAnonymous - роль неавторизованного пользователя (пустая роль)
+const RoleAnonymous models.UserRole = ""
+
+// Rule описывает, над какими целями роль может выполнять действие.
+// Для действий без целевого пользователя учитывается только наличие правила.
+type Rule struct {
+	OwnFilial      bool              // цель должна быть из филиала актора
+	TargetRoles    []models.UserRole // допустимые роли цели, пусто - любые
+	IncludeDeleted bool              // разрешены ли цели со статусом deleted
+}
+
+var (
+	anyTarget      = Rule{IncludeDeleted: true}
+	filialStaff    = []models.UserRole{models.RoleUser, models.RoleTutor, models.RoleHelper}
+	filialStudents = []models.UserRole{models.RoleUser}
+	tutorsOnly     = []models.UserRole{models.RoleTutor}
+	// Новые учётные данные владельца получил бы тот, кто их сбросил:
+	// owner не сбрасывает пароль и 2FA другому owner
+	nonOwners = []models.UserRole{models.RoleAdmin, models.RoleHelper, models.RoleTutor, models.RoleUser}
+)
+
+// table - единственный источник правил доступа: действие -> роль актора -> правило.
+// Отсутствие роли в таблице означает запрет.
+var table = map[Action]map[models.UserRole]Rule{
+	ActionViewUser: {
+		models.RoleOwner:  anyTarget,
+		models.RoleAdmin:  {OwnFilial: true, IncludeDeleted: true},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	ActionUpdateUserData: {
+		models.RoleOwner:  anyTarget,
+		models.RoleAdmin:  {OwnFilial: true, IncludeDeleted: true},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	ActionRegisterUser: {
+		models.RoleOwner:  anyTarget,
+		models.RoleAdmin:  {OwnFilial: true, TargetRoles: filialStaff},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+		RoleAnonymous:     {TargetRoles: filialStudents},
+	},
+	ActionUpdateUser: {
+		models.RoleOwner:  anyTarget,
+		models.RoleAdmin:  {OwnFilial: true, TargetRoles: filialStaff},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	// Helper может замораживать и размораживать учеников, но не удалять их
+	ActionChangeStatus: {
+		models.RoleOwner:  anyTarget,
+		models.RoleAdmin:  {OwnFilial: true, TargetRoles: filialStaff, IncludeDeleted: true},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	ActionChangeRole: {
+		models.RoleOwner: anyTarget,
+		models.RoleAdmin: {OwnFilial: true, TargetRoles: filialStaff},
+	},
+	ActionPurgeUser: {
+		models.RoleOwner: anyTarget,
+	},
+	ActionRevokeSessions: {
+		models.RoleOwner: anyTarget,
+	},
+	ActionResetPassword: {
+		models.RoleOwner:  {TargetRoles: nonOwners},
+		models.RoleAdmin:  {OwnFilial: true, TargetRoles: filialStaff},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	ActionReset2FA: {
+		models.RoleOwner: {TargetRoles: nonOwners},
+	},
+	ActionTransferUser: {
+		models.RoleOwner: {},
+	},
+	ActionListOwnModules: {
+		models.RoleTutor: {},
+	},
+	ActionViewModule: {
+		models.RoleOwner: {},
+		models.RoleTutor: {},
+	},
+	ActionManageModules: {
+		models.RoleOwner: {},
+	},
+	ActionGrantModules: {
+		models.RoleOwner: {TargetRoles: tutorsOnly},
+		models.RoleAdmin: {OwnFilial: true, TargetRoles: tutorsOnly},
+	},
+	// Ученик и назначенный тьютор получают доступ через CanAccessEnrollment
+	ActionEnroll: {
+		models.RoleOwner: {TargetRoles: filialStudents, IncludeDeleted: true},
+		models.RoleAdmin: {OwnFilial: true, TargetRoles: filialStudents, IncludeDeleted: true},
+	},
+	ActionViewProgress: {
+		models.RoleOwner: {TargetRoles: filialStudents, IncludeDeleted: true},
+		models.RoleAdmin: {OwnFilial: true, TargetRoles: filialStudents, IncludeDeleted: true},
+	},
+	ActionUpdateProgress: {
+		models.RoleOwner: {TargetRoles: filialStudents},
+		models.RoleAdmin: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	// Правила групп проверяются по филиалу группы (CanAccessGroup);
+	// тьютор группы и её ученики получают доступ через связь с группой
+	ActionManageGroups: {
+		models.RoleOwner:  {},
+		models.RoleAdmin:  {OwnFilial: true},
+		models.RoleHelper: {OwnFilial: true},
+	},
+	ActionViewGroup: {
+		models.RoleOwner:  {},
+		models.RoleAdmin:  {OwnFilial: true},
+		models.RoleHelper: {OwnFilial: true},
+	},
+	ActionMarkAttendance: {
+		models.RoleOwner:  {},
+		models.RoleAdmin:  {OwnFilial: true},
+		models.RoleHelper: {OwnFilial: true},
+	},
+	ActionViewAttendance: {
+		models.RoleOwner:  {TargetRoles: filialStudents, IncludeDeleted: true},
+		models.RoleAdmin:  {OwnFilial: true, TargetRoles: filialStudents, IncludeDeleted: true},
+		models.RoleHelper: {OwnFilial: true, TargetRoles: filialStudents},
+	},
+	ActionViewFile: {
+		models.RoleOwner: {},
+		models.RoleTutor: {},
+	},
+	ActionManageFiles: {
+		models.RoleOwner: {},
+	},
+	// Проверяется по пользователю, скачавшему файл
+	ActionViewDownloads: {
+		models.RoleOwner: anyTarget,
+		models.RoleAdmin: {OwnFilial: true, IncludeDeleted: true},
+	},
+	ActionBackup: {
+		models.RoleOwner: {},
+	},
+	ActionRestore: {
+		models.RoleOwner: {},
+	},
+	ActionManageFilials: {
+		models.RoleOwner: {},
+	},
+	ActionViewAudit: {
+		models.RoleOwner: {},
+	},
+	ActionManageLockouts: {
+		models.RoleOwner: {},
+	},
+	// Проверяется по филиалу (CanInFilial)
+	ActionFilialStats: {
+		models.RoleOwner: {},
+		models.RoleAdmin: {OwnFilial: true},
+	},
+}
+
+// twoFactorRoles - роли, которым без второго фактора доступны только его
+// настройка, смена пароля и выход
+var twoFactorRoles = []models.UserRole{models.RoleOwner, models.RoleAdmin}
+
+// RequiresTwoFactor сообщает, обязательна ли для роли двухфакторная аутентификация
+func RequiresTwoFactor(role models.UserRole) bool {
+	return slices.Contains(twoFactorRoles, role)
+}
+
+// DeniedError - отказ политики с причиной
+type DeniedError struct {
+	Action Action
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return "Forbidden: " + e.Reason
+}
+
+// Allowed сообщает, есть ли у роли право на действие хотя бы над какой-то целью
+func Allowed(role models.UserRole, action Action) bool {
+	_, ok := table[action][role]
+	return ok
+}
+
+// Can проверяет, может ли actor выполнить action над target.
+// Для анонимного запроса передается нулевой models.User, для действий без цели - nil target.
+// Замороженному или удалённому актору запрещено всё.
+func Can(actor models.User, action Action, target *models.User) error {
+	if err := checkActor(actor, action); err != nil {
+		return err
+	}
+	rule, ok := table[action][actor.Role]
+	if !ok {
+		return deny(action, "action is not allowed for role %q", actor.Role)
+	}
+
+	if target == nil {
+		return nil
+	}
+
+	if rule.OwnFilial && target.Filial != actor.Filial {
+		return deny(action, "can only access users in your filial")
+	}
+	if len(rule.TargetRoles) > 0 && !slices.Contains(rule.TargetRoles, target.Role) {
+		return deny(action, "not allowed for users with role %q", target.Role)
+	}
+	if !rule.IncludeDeleted && target.Status == models.StatusDeleted {
+		return deny(action, "user is deleted")
+	}
+
+	return nil
+}
+
+// CanChange проверяет изменение пользователя: правило должно допускать
+// цель и до изменения, и после него (например, admin не может перевести
+// пользователя в чужой филиал или назначить роль admin).
+func CanChange(actor models.User, action Action, before, after models.User) error {
+	if err := Can(actor, action, &before); err != nil {
+		return err
+	}
+	return Can(actor, action, &after)
+}
+
+// CanAccessEnrollment проверяет доступ к записи ученика на модуль:
+// ученик видит свой прогресс, назначенный тьютор видит и отмечает его,
+// остальные роли - по таблице для student как цели.
+func CanAccessEnrollment(actor models.User, action Action, student models.User, tutorID string) error {
+	if err := checkActor(actor, action); err != nil {
+		return err
+	}
+	switch {
+	case action == ActionViewProgress && actor.ID == student.ID:
+		return nil
+	case (action == ActionViewProgress || action == ActionUpdateProgress) &&
+		actor.Role == models.RoleTutor && actor.ID == tutorID:
+		return nil
+	}
+	return Can(actor, action, &student)
+}
+
+// CanInFilial проверяет действие над объектом филиала filial (не пользователем)
+func CanInFilial(actor models.User, action Action, filial string) error {
+	if err := checkActor(actor, action); err != nil {
+		return err
+	}
+	rule, ok := table[action][actor.Role]
+	if !ok {
+		return deny(action, "action is not allowed for role %q", actor.Role)
+	}
+	if rule.OwnFilial && filial != actor.Filial {
+		return deny(action, "can only access your filial")
+	}
+	return nil
+}
+
+// CanAccessGroup проверяет доступ к учебной группе: тьютор группы видит её
+// и отмечает посещения, ученики группы видят её, остальные роли - по филиалу группы.
+func CanAccessGroup(actor models.User, action Action, group models.Group) error {
+	if err := checkActor(actor, action); err != nil {
+		return err
+	}
+	isTutor := actor.Role == models.RoleTutor && actor.ID == group.TutorID
+	switch {
+	case isTutor && (action == ActionViewGroup || action == ActionMarkAttendance):
+		return nil
+	case action == ActionViewGroup && slices.Contains(group.StudentIDs, actor.ID):
+		return nil
+	}
+	return CanInFilial(actor, action, group.Filial)
+}
+
+// Filter оставляет только тех пользователей, над которыми actor может выполнить action
+func Filter(actor models.User, action Action, users []models.User) []models.User {
+	var result []models.User
+	for i := range users {
+		if Can(actor, action, &users[i]) == nil {
+			result = append(result, users[i])
+		}
+	}
+	return result
+}
+
+// checkActor отклоняет замороженного или удалённого актора; у анонимного статуса нет
+func checkActor(actor models.User, action Action) error {
+	if actor.Role != RoleAnonymous && actor.Status != models.StatusActive {
+		return deny(action, "your account is not active")
+	}
+	return nil
+}
+
+func deny(action Action, format string, args ...interface{}) error {
+	return &DeniedError{Action: action, Reason: fmt.Sprintf(format, args...)}
+}
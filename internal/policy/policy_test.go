@@ -0,0 +1,487 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"myapp/internal/models"
+)
+
+// Пользователи сценариев: филиал 1 - свой для большинства акторов, филиал 2 - чужой
+var (
+	owner        = models.User{ID: "o", Role: models.RoleOwner, Filial: "1", Status: models.StatusActive}
+	otherOwner   = models.User{ID: "o2", Role: models.RoleOwner, Filial: "2", Status: models.StatusActive}
+	peerOwner    = models.User{ID: "o3", Role: models.RoleOwner, Filial: "1", Status: models.StatusActive}
+	admin        = models.User{ID: "a", Role: models.RoleAdmin, Filial: "1", Status: models.StatusActive}
+	otherAdmin   = models.User{ID: "a2", Role: models.RoleAdmin, Filial: "2", Status: models.StatusActive}
+	peerAdmin    = models.User{ID: "a3", Role: models.RoleAdmin, Filial: "1", Status: models.StatusActive}
+	helper       = models.User{ID: "h", Role: models.RoleHelper, Filial: "1", Status: models.StatusActive}
+	otherHelper  = models.User{ID: "h2", Role: models.RoleHelper, Filial: "2", Status: models.StatusActive}
+	tutor        = models.User{ID: "t", Role: models.RoleTutor, Filial: "1", Status: models.StatusActive}
+	otherTutor   = models.User{ID: "t2", Role: models.RoleTutor, Filial: "2", Status: models.StatusActive}
+	student      = models.User{ID: "s", Role: models.RoleUser, Filial: "1", Status: models.StatusActive}
+	otherStudent = models.User{ID: "s2", Role: models.RoleUser, Filial: "2", Status: models.StatusActive}
+	anonymous    = models.User{}
+
+	frozenStudent  = models.User{ID: "s3", Role: models.RoleUser, Filial: "1", Status: models.StatusFrozen}
+	deletedStudent = models.User{ID: "s4", Role: models.RoleUser, Filial: "1", Status: models.StatusDeleted}
+	deletedTutor   = models.User{ID: "t3", Role: models.RoleTutor, Filial: "1", Status: models.StatusDeleted}
+	deletedOther   = models.User{ID: "s5", Role: models.RoleUser, Filial: "2", Status: models.StatusDeleted}
+)
+
+func ptr(u models.User) *models.User { return &u }
+
+// userScenarios - ожидания из постановки и обработчиков, записанные как
+// поведение, а не как копия таблицы правил. nil target - действие без цели.
+var userScenarios = []struct {
+	name   string
+	actor  models.User
+	action Action
+	target *models.User
+	allow  bool
+}{
+	// Просмотр: список (GetAllUsers) и карточка (GetUserData) подчиняются одному правилу
+	{"owner views a user of another filial", owner, ActionViewUser, ptr(otherStudent), true},
+	{"owner views a deleted user", owner, ActionViewUser, ptr(deletedOther), true},
+	{"admin views a student of own filial", admin, ActionViewUser, ptr(student), true},
+	{"admin views a deleted user of own filial", admin, ActionViewUser, ptr(deletedStudent), true},
+	{"admin in another filial cannot see the user", otherAdmin, ActionViewUser, ptr(student), false},
+	{"helper views a student of own filial", helper, ActionViewUser, ptr(student), true},
+	{"helper cannot view a tutor", helper, ActionViewUser, ptr(tutor), false},
+	{"helper cannot view a deleted student", helper, ActionViewUser, ptr(deletedStudent), false},
+	{"helper in another filial cannot see the student", otherHelper, ActionViewUser, ptr(student), false},
+	{"tutor cannot view users", tutor, ActionViewUser, ptr(student), false},
+	{"student cannot view users", student, ActionViewUser, ptr(student), false},
+	{"anonymous cannot view users", anonymous, ActionViewUser, ptr(student), false},
+
+	{"admin updates data of a tutor in own filial", admin, ActionUpdateUserData, ptr(tutor), true},
+	{"admin cannot update data in another filial", otherAdmin, ActionUpdateUserData, ptr(tutor), false},
+	{"helper updates data of a student", helper, ActionUpdateUserData, ptr(student), true},
+	{"helper cannot update data of a tutor", helper, ActionUpdateUserData, ptr(tutor), false},
+	{"tutor cannot update user data", tutor, ActionUpdateUserData, ptr(student), false},
+
+	// Регистрация
+	{"anonymous registers a student", anonymous, ActionRegisterUser, ptr(otherStudent), true},
+	{"anonymous cannot register a tutor", anonymous, ActionRegisterUser, ptr(tutor), false},
+	{"helper registers a student", helper, ActionRegisterUser, ptr(student), true},
+	{"helper cannot register a helper", helper, ActionRegisterUser, ptr(helper), false},
+	{"admin registers a tutor in own filial", admin, ActionRegisterUser, ptr(tutor), true},
+	{"admin cannot register an admin", admin, ActionRegisterUser, ptr(peerAdmin), false},
+	{"admin cannot register in another filial", admin, ActionRegisterUser, ptr(otherTutor), false},
+	{"owner registers an admin anywhere", owner, ActionRegisterUser, ptr(otherAdmin), true},
+	{"tutor cannot register users", tutor, ActionRegisterUser, ptr(student), false},
+
+	// Изменение пользователя
+	{"owner updates another owner", owner, ActionUpdateUser, ptr(otherOwner), true},
+	{"admin updates a helper in own filial", admin, ActionUpdateUser, ptr(helper), true},
+	{"admin cannot update another admin", admin, ActionUpdateUser, ptr(peerAdmin), false},
+	{"admin cannot update the owner", admin, ActionUpdateUser, ptr(owner), false},
+	{"admin cannot update a deleted tutor", admin, ActionUpdateUser, ptr(deletedTutor), false},
+	{"helper updates a student", helper, ActionUpdateUser, ptr(student), true},
+	{"helper cannot update a tutor", helper, ActionUpdateUser, ptr(tutor), false},
+
+	{"admin restores a deleted tutor", admin, ActionChangeStatus, ptr(deletedTutor), true},
+	{"admin cannot change status in another filial", otherAdmin, ActionChangeStatus, ptr(student), false},
+	{"helper freezes a student", helper, ActionChangeStatus, ptr(student), true},
+	{"helper unfreezes a frozen student", helper, ActionChangeStatus, ptr(frozenStudent), true},
+	{"helper cannot restore a deleted student", helper, ActionChangeStatus, ptr(deletedStudent), false},
+	{"helper cannot change status of a tutor", helper, ActionChangeStatus, ptr(tutor), false},
+	{"tutor cannot change status", tutor, ActionChangeStatus, ptr(student), false},
+
+	{"owner changes the role of an admin", owner, ActionChangeRole, ptr(otherAdmin), true},
+	{"admin changes the role of a tutor", admin, ActionChangeRole, ptr(tutor), true},
+	{"admin cannot change the role of an admin", admin, ActionChangeRole, ptr(peerAdmin), false},
+	{"helper cannot change roles", helper, ActionChangeRole, ptr(student), false},
+
+	{"owner purges a deleted user", owner, ActionPurgeUser, ptr(deletedStudent), true},
+	{"admin cannot purge", admin, ActionPurgeUser, ptr(deletedStudent), false},
+	{"helper cannot purge", helper, ActionPurgeUser, ptr(deletedStudent), false},
+
+	{"owner revokes sessions", owner, ActionRevokeSessions, ptr(admin), true},
+	{"admin cannot revoke sessions", admin, ActionRevokeSessions, ptr(tutor), false},
+
+	{"owner resets the password of an admin", owner, ActionResetPassword, ptr(otherAdmin), true},
+	{"admin resets the password of a tutor", admin, ActionResetPassword, ptr(tutor), true},
+	{"admin cannot reset the password of an admin", admin, ActionResetPassword, ptr(peerAdmin), false},
+	{"admin cannot reset a password in another filial", otherAdmin, ActionResetPassword, ptr(tutor), false},
+	{"helper resets the password of a student", helper, ActionResetPassword, ptr(student), true},
+	{"helper cannot reset the password of a tutor", helper, ActionResetPassword, ptr(tutor), false},
+	{"nobody resets the password of a deleted user", owner, ActionResetPassword, ptr(deletedStudent), false},
+	{"owner cannot reset the password of another owner", owner, ActionResetPassword, ptr(otherOwner), false},
+	{"owner cannot reset the password of an owner in own filial", owner, ActionResetPassword, ptr(peerOwner), false},
+	{"admin cannot reset the password of the owner", admin, ActionResetPassword, ptr(owner), false},
+
+	{"owner resets 2FA of an admin", owner, ActionReset2FA, ptr(otherAdmin), true},
+	{"owner resets 2FA of a tutor in another filial", owner, ActionReset2FA, ptr(otherTutor), true},
+	{"admin cannot reset 2FA", admin, ActionReset2FA, ptr(helper), false},
+	{"owner cannot reset 2FA of another owner", owner, ActionReset2FA, ptr(otherOwner), false},
+	{"owner cannot reset 2FA of an owner in own filial", owner, ActionReset2FA, ptr(peerOwner), false},
+
+	{"owner transfers a user", owner, ActionTransferUser, ptr(student), true},
+	{"admin cannot transfer users", admin, ActionTransferUser, ptr(student), false},
+
+	// Модули и файлы
+	{"tutor lists own modules", tutor, ActionListOwnModules, nil, true},
+	{"student has no module list", student, ActionListOwnModules, nil, false},
+	{"tutor views a module", tutor, ActionViewModule, nil, true},
+	{"admin cannot view module files", admin, ActionViewModule, nil, false},
+	{"owner manages modules", owner, ActionManageModules, nil, true},
+	{"admin cannot manage modules", admin, ActionManageModules, nil, false},
+	{"admin grants modules to a tutor of own filial", admin, ActionGrantModules, ptr(tutor), true},
+	{"admin cannot grant modules in another filial", admin, ActionGrantModules, ptr(otherTutor), false},
+	{"owner cannot grant modules to a student", owner, ActionGrantModules, ptr(student), false},
+	{"helper cannot grant modules", helper, ActionGrantModules, ptr(tutor), false},
+	{"tutor views lesson files", tutor, ActionViewFile, nil, true},
+	{"student cannot view lesson files", student, ActionViewFile, nil, false},
+	{"owner manages lesson files", owner, ActionManageFiles, nil, true},
+	{"tutor cannot manage lesson files", tutor, ActionManageFiles, nil, false},
+	{"admin views downloads of own filial", admin, ActionViewDownloads, ptr(tutor), true},
+	{"admin cannot view downloads of another filial", admin, ActionViewDownloads, ptr(otherTutor), false},
+	{"helper cannot view downloads", helper, ActionViewDownloads, ptr(tutor), false},
+
+	// Записи на модули и посещения
+	{"admin enrolls a student of own filial", admin, ActionEnroll, ptr(student), true},
+	{"admin cannot enroll a tutor", admin, ActionEnroll, ptr(tutor), false},
+	{"helper cannot enroll", helper, ActionEnroll, ptr(student), false},
+	{"owner views progress of a deleted student", owner, ActionViewProgress, ptr(deletedStudent), true},
+	{"admin cannot view progress in another filial", admin, ActionViewProgress, ptr(otherStudent), false},
+	{"admin updates progress", admin, ActionUpdateProgress, ptr(student), true},
+	{"progress of a deleted student is read-only", admin, ActionUpdateProgress, ptr(deletedStudent), false},
+	{"helper views attendance of a student", helper, ActionViewAttendance, ptr(student), true},
+	{"helper cannot view attendance of a deleted student", helper, ActionViewAttendance, ptr(deletedStudent), false},
+	{"admin views attendance of a deleted student", admin, ActionViewAttendance, ptr(deletedStudent), true},
+	{"tutor has no attendance history by role", tutor, ActionViewAttendance, ptr(student), false},
+
+	// Данные сервера
+	{"owner downloads a backup", owner, ActionBackup, nil, true},
+	{"admin cannot download a backup", admin, ActionBackup, nil, false},
+	{"owner restores a backup", owner, ActionRestore, nil, true},
+	{"admin cannot restore a backup", admin, ActionRestore, nil, false},
+	{"owner manages filials", owner, ActionManageFilials, nil, true},
+	{"admin cannot manage filials", admin, ActionManageFilials, nil, false},
+	{"owner views the audit log", owner, ActionViewAudit, nil, true},
+	{"admin cannot view the audit log", admin, ActionViewAudit, nil, false},
+	{"owner manages lockouts", owner, ActionManageLockouts, nil, true},
+	{"admin cannot manage lockouts", admin, ActionManageLockouts, nil, false},
+
+	// Статус самого актора
+	{"a frozen owner is rejected", withStatus(owner, models.StatusFrozen), ActionViewUser, ptr(student), false},
+	{"a deleted admin is rejected", withStatus(admin, models.StatusDeleted), ActionViewUser, ptr(student), false},
+	{"a frozen helper is rejected", withStatus(helper, models.StatusFrozen), ActionChangeStatus, ptr(student), false},
+	{"a frozen tutor is rejected", withStatus(tutor, models.StatusFrozen), ActionViewFile, nil, false},
+}
+
+// filialScenarios - действия над объектами филиала (группы, статистика)
+var filialScenarios = []struct {
+	name   string
+	actor  models.User
+	action Action
+	filial string
+	allow  bool
+}{
+	{"owner manages groups anywhere", owner, ActionManageGroups, "2", true},
+	{"admin manages groups of own filial", admin, ActionManageGroups, "1", true},
+	{"admin cannot manage groups of another filial", admin, ActionManageGroups, "2", false},
+	{"helper manages groups of own filial", helper, ActionManageGroups, "1", true},
+	{"tutor cannot manage groups by role", tutor, ActionManageGroups, "1", false},
+	{"helper views groups of own filial", helper, ActionViewGroup, "1", true},
+	{"helper cannot view groups of another filial", helper, ActionViewGroup, "2", false},
+	{"admin marks attendance in own filial", admin, ActionMarkAttendance, "1", true},
+	{"admin cannot mark attendance in another filial", admin, ActionMarkAttendance, "2", false},
+	{"owner sees stats of any filial", owner, ActionFilialStats, "2", true},
+	{"admin sees stats of own filial", admin, ActionFilialStats, "1", true},
+	{"admin cannot see stats of another filial", admin, ActionFilialStats, "2", false},
+	{"helper cannot see filial stats", helper, ActionFilialStats, "1", false},
+	{"a frozen admin cannot see stats", withStatus(admin, models.StatusFrozen), ActionFilialStats, "1", false},
+}
+
+func withStatus(u models.User, status models.UserStatus) models.User {
+	u.Status = status
+	return u
+}
+
+func TestCanScenarios(t *testing.T) {
+	for _, tt := range userScenarios {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Can(tt.actor, tt.action, tt.target)
+			if (err == nil) != tt.allow {
+				t.Fatalf("Can = %v, want allowed=%v", err, tt.allow)
+			}
+			var denied *DeniedError
+			if err != nil && (!errors.As(err, &denied) || denied.Action != tt.action) {
+				t.Errorf("error %v is not a DeniedError for %s", err, tt.action)
+			}
+		})
+	}
+}
+
+func TestCanInFilialScenarios(t *testing.T) {
+	for _, tt := range filialScenarios {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanInFilial(tt.actor, tt.action, tt.filial); (err == nil) != tt.allow {
+				t.Errorf("CanInFilial = %v, want allowed=%v", err, tt.allow)
+			}
+		})
+	}
+}
+
+// TestScenariosCoverEveryAction: у каждого действия есть хотя бы один
+// разрешающий и один запрещающий сценарий
+func TestScenariosCoverEveryAction(t *testing.T) {
+	allowed, denied := map[Action]bool{}, map[Action]bool{}
+	for _, s := range userScenarios {
+		if s.allow {
+			allowed[s.action] = true
+		} else {
+			denied[s.action] = true
+		}
+	}
+	for _, s := range filialScenarios {
+		if s.allow {
+			allowed[s.action] = true
+		} else {
+			denied[s.action] = true
+		}
+	}
+	for action := range table {
+		if !allowed[action] || !denied[action] {
+			t.Errorf("action %s needs both an allowed and a denied scenario", action)
+		}
+	}
+}
+
+// TestInactiveActor: замороженный или удалённый актор не может ничего,
+// какая бы у него ни была роль
+func TestInactiveActor(t *testing.T) {
+	group := models.Group{ID: "g", Filial: "1", TutorID: "t", StudentIDs: []string{"s"}}
+	for _, actor := range []models.User{owner, admin, helper, tutor, student} {
+		for _, status := range []models.UserStatus{models.StatusFrozen, models.StatusDeleted} {
+			inactive := withStatus(actor, status)
+			for action := range table {
+				if err := Can(inactive, action, nil); err == nil {
+					t.Errorf("%s %s: Can(%s, nil) allowed", status, actor.Role, action)
+				}
+				if err := Can(inactive, action, ptr(student)); err == nil {
+					t.Errorf("%s %s: Can(%s, student) allowed", status, actor.Role, action)
+				}
+				if err := CanInFilial(inactive, action, "1"); err == nil {
+					t.Errorf("%s %s: CanInFilial(%s) allowed", status, actor.Role, action)
+				}
+				if err := CanAccessEnrollment(inactive, action, student, "t"); err == nil {
+					t.Errorf("%s %s: CanAccessEnrollment(%s) allowed", status, actor.Role, action)
+				}
+				if err := CanAccessGroup(inactive, action, group); err == nil {
+					t.Errorf("%s %s: CanAccessGroup(%s) allowed", status, actor.Role, action)
+				}
+			}
+		}
+	}
+}
+
+// TestStaffStayInOwnFilial: admin и helper не действуют за пределами своего филиала
+func TestStaffStayInOwnFilial(t *testing.T) {
+	targets := []models.User{otherOwner, otherAdmin, otherHelper, otherTutor, otherStudent, deletedOther}
+	for _, actor := range []models.User{admin, helper} {
+		for action := range table {
+			for _, target := range targets {
+				if err := Can(actor, action, &target); err == nil {
+					t.Errorf("%s of filial 1 may %s user %s of filial 2", actor.Role, action, target.ID)
+				}
+			}
+			if err := CanInFilial(actor, action, "2"); err == nil {
+				t.Errorf("%s of filial 1 may %s in filial 2", actor.Role, action)
+			}
+		}
+	}
+}
+
+// TestAnonymousOnlyRegistersStudents: без входа доступна только регистрация ученика
+func TestAnonymousOnlyRegistersStudents(t *testing.T) {
+	for action := range table {
+		for _, target := range []models.User{owner, admin, helper, tutor, student} {
+			want := action == ActionRegisterUser && target.Role == models.RoleUser
+			if err := Can(anonymous, action, &target); (err == nil) != want {
+				t.Errorf("anonymous %s on %s: %v, want allowed=%v", action, target.Role, err, want)
+			}
+		}
+	}
+}
+
+// TestAllowedMatchesCan: Allowed совпадает с Can без цели для активного актора
+func TestAllowedMatchesCan(t *testing.T) {
+	for action := range table {
+		for _, actor := range []models.User{anonymous, owner, admin, helper, tutor, student} {
+			want := Can(actor, action, nil) == nil
+			if got := Allowed(actor.Role, action); got != want {
+				t.Errorf("Allowed(%q, %s) = %v, Can(nil) allowed=%v", actor.Role, action, got, want)
+			}
+		}
+	}
+}
+
+// TestListAndGetAgree: список пользователей и карточка пользователя видят
+// одних и тех же людей, включая удалённых
+func TestListAndGetAgree(t *testing.T) {
+	users := []models.User{student, deletedStudent, frozenStudent, tutor, deletedTutor, otherStudent, deletedOther}
+	for _, actor := range []models.User{owner, admin, helper, tutor, student} {
+		listed := Filter(actor, ActionViewUser, users)
+		for _, u := range users {
+			inList := slices.ContainsFunc(listed, func(l models.User) bool { return l.ID == u.ID })
+			if canGet := Can(actor, ActionViewUser, &u) == nil; inList != canGet {
+				t.Errorf("%s: user %s listed=%v, get allowed=%v", actor.Role, u.ID, inList, canGet)
+			}
+		}
+	}
+
+	ownerList := Filter(owner, ActionViewUser, users)
+	for _, u := range []models.User{deletedStudent, deletedOther} {
+		if !slices.ContainsFunc(ownerList, func(l models.User) bool { return l.ID == u.ID }) {
+			t.Errorf("owner does not list deleted user %s", u.ID)
+		}
+		if err := Can(owner, ActionViewUser, &u); err != nil {
+			t.Errorf("owner cannot get deleted user %s: %v", u.ID, err)
+		}
+	}
+}
+
+func TestCanChange(t *testing.T) {
+	promoted := withRole(tutor, models.RoleAdmin)
+	demoted := withRole(tutor, models.RoleHelper)
+	moved := tutor
+	moved.Filial = "2"
+
+	tests := []struct {
+		name          string
+		actor         models.User
+		action        Action
+		before, after models.User
+		allow         bool
+	}{
+		{"admin demotes tutor to helper", admin, ActionChangeRole, tutor, demoted, true},
+		{"admin cannot promote to admin", admin, ActionChangeRole, tutor, promoted, false},
+		{"admin cannot demote an admin", admin, ActionChangeRole, promoted, tutor, false},
+		{"admin cannot move a user to another filial", admin, ActionUpdateUser, tutor, moved, false},
+		{"admin cannot take a user from another filial", admin, ActionUpdateUser, moved, tutor, false},
+		{"admin deletes a tutor", admin, ActionChangeStatus, tutor, withStatus(tutor, models.StatusDeleted), true},
+		{"helper freezes a student", helper, ActionChangeStatus, student, withStatus(student, models.StatusFrozen), true},
+		{"helper cannot delete a student", helper, ActionChangeStatus, student, withStatus(student, models.StatusDeleted), false},
+		{"helper cannot restore a student", helper, ActionChangeStatus, deletedStudent, withStatus(deletedStudent, models.StatusActive), false},
+		{"owner promotes to admin", owner, ActionChangeRole, tutor, promoted, true},
+		{"owner moves a user", owner, ActionUpdateUser, tutor, moved, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanChange(tt.actor, tt.action, tt.before, tt.after); (err == nil) != tt.allow {
+				t.Errorf("CanChange = %v, want allowed=%v", err, tt.allow)
+			}
+		})
+	}
+}
+
+func withRole(u models.User, role models.UserRole) models.User {
+	u.Role = role
+	return u
+}
+
+func TestCanAccessEnrollment(t *testing.T) {
+	assigned := models.User{ID: "t", Role: models.RoleTutor, Filial: "2", Status: models.StatusActive}
+
+	tests := []struct {
+		name   string
+		actor  models.User
+		action Action
+		allow  bool
+	}{
+		{"student views own progress", student, ActionViewProgress, true},
+		{"student cannot update own progress", student, ActionUpdateProgress, false},
+		{"student cannot enroll self", student, ActionEnroll, false},
+		{"frozen student cannot view own progress", withStatus(student, models.StatusFrozen), ActionViewProgress, false},
+		{"other student cannot view progress", otherStudent, ActionViewProgress, false},
+		{"assigned tutor views progress from any filial", assigned, ActionViewProgress, true},
+		{"assigned tutor updates progress", assigned, ActionUpdateProgress, true},
+		{"assigned tutor cannot enroll", assigned, ActionEnroll, false},
+		{"frozen assigned tutor is denied", withStatus(assigned, models.StatusFrozen), ActionViewProgress, false},
+		{"unassigned tutor is denied", otherTutor, ActionUpdateProgress, false},
+		{"admin of student filial enrolls", admin, ActionEnroll, true},
+		{"admin of other filial is denied", otherAdmin, ActionViewProgress, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanAccessEnrollment(tt.actor, tt.action, student, "t"); (err == nil) != tt.allow {
+				t.Errorf("CanAccessEnrollment = %v, want allowed=%v", err, tt.allow)
+			}
+		})
+	}
+}
+
+func TestCanAccessGroup(t *testing.T) {
+	group := models.Group{ID: "g", Filial: "1", TutorID: "t2", StudentIDs: []string{"s"}}
+
+	tests := []struct {
+		name   string
+		actor  models.User
+		action Action
+		allow  bool
+	}{
+		{"group tutor from another filial views", otherTutor, ActionViewGroup, true},
+		{"group tutor marks attendance", otherTutor, ActionMarkAttendance, true},
+		{"group tutor cannot manage", otherTutor, ActionManageGroups, false},
+		{"frozen group tutor is denied", withStatus(otherTutor, models.StatusFrozen), ActionViewGroup, false},
+		{"other tutor is denied", tutor, ActionViewGroup, false},
+		{"member views", student, ActionViewGroup, true},
+		{"member cannot mark attendance", student, ActionMarkAttendance, false},
+		{"frozen member is denied", withStatus(student, models.StatusFrozen), ActionViewGroup, false},
+		{"non-member is denied", frozenStudent, ActionViewGroup, false},
+		{"helper of group filial manages", helper, ActionManageGroups, true},
+		{"helper of group filial marks attendance", helper, ActionMarkAttendance, true},
+		{"helper of other filial is denied", otherHelper, ActionViewGroup, false},
+		{"owner of another filial manages any group", otherOwner, ActionManageGroups, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanAccessGroup(tt.actor, tt.action, group); (err == nil) != tt.allow {
+				t.Errorf("CanAccessGroup = %v, want allowed=%v", err, tt.allow)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	users := []models.User{student, tutor, otherStudent, deletedStudent, admin}
+	ids := func(users []models.User) []string {
+		var result []string
+		for _, u := range users {
+			result = append(result, u.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		actor models.User
+		want  []string
+	}{
+		{otherOwner, []string{"s", "t", "s2", "s4", "a"}},
+		{peerAdmin, []string{"s", "t", "s4", "a"}},
+		{helper, []string{"s"}},
+		{tutor, nil},
+		{student, nil},
+		{withStatus(peerAdmin, models.StatusFrozen), nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.actor.Role)+"/"+string(tt.actor.Status), func(t *testing.T) {
+			if got := ids(Filter(tt.actor, ActionViewUser, users)); !slices.Equal(got, tt.want) {
+				t.Errorf("Filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiresTwoFactor(t *testing.T) {
+	for _, role := range []models.UserRole{RoleAnonymous, models.RoleOwner, models.RoleAdmin, models.RoleHelper, models.RoleTutor, models.RoleUser} {
+		want := role == models.RoleOwner || role == models.RoleAdmin
+		if got := RequiresTwoFactor(role); got != want {
+			t.Errorf("RequiresTwoFactor(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
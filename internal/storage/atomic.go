@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteFileAtomic безопасно заменяет содержимое файла: данные пишутся во
+// временный файл рядом, сбрасываются на диск и переименовываются поверх
+// исходного. Предыдущие версии сохраняются как <path>.bak.1 (последняя)
+// ... <path>.bak.N, где N - backupGenerations.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	_, err := writeAtomic(path, bytes.NewReader(data), perm, true)
+	return err
+}
+
+// WriteReaderAtomic так же атомарно записывает в path всё содержимое r, но
+// без копии .bak - для больших загружаемых файлов. Возвращает число байт.
+func WriteReaderAtomic(path string, r io.Reader, perm os.FileMode) (int64, error) {
+	return writeAtomic(path, r, perm, false)
+}
+
+func writeAtomic(path string, r io.Reader, perm os.FileMode, backup bool) (int64, error) {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpName := tmp.Name()
+	// Если что-то пошло не так, временный файл не должен остаться в каталоге
+	defer os.Remove(tmpName)
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if backup {
+		if err := backupFile(path); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return 0, err
+	}
+
+	return n, syncDir(dir)
+}
+
+// backupGenerations - сколько предыдущих версий файла хранится
+const backupGenerations = 5
+
+// backupName возвращает имя копии поколения n (1 - последняя версия)
+func backupName(path string, n int) string {
+	return path + ".bak." + strconv.Itoa(n)
+}
+
+// corruptedError сообщает о повреждённом файле и о том, где искать его предыдущие версии
+func corruptedError(path string, err error) error {
+	return fmt.Errorf("%s is corrupted (previous versions are kept in %s.bak.1 to .bak.%d): %w",
+		path, path, backupGenerations, err)
+}
+
+// backupFile сдвигает поколения копий и сохраняет текущую версию файла как <path>.bak.1
+func backupFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.Remove(backupName(path, backupGenerations)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := backupGenerations - 1; n >= 1; n-- {
+		if err := os.Rename(backupName(path, n), backupName(path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	bak := backupName(path, 1)
+
+	// Жёсткая ссылка не копирует данные; rename новой версии её не затронет
+	err := os.Link(path, bak)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	return copyFile(path, bak)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir сбрасывает на диск запись каталога, чтобы rename пережил сбой питания
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// Не все платформы поддерживают fsync каталога, это не критично
+	_ = d.Sync()
+	return nil
+}
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"myapp/internal/models"
+)
+
+var (
+	// ErrVersionConflict возвращается, если запись изменили после того, как её прочитал клиент
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrInvalidOrder возвращается, если новый порядок не перечисляет каждую запись ровно один раз
+	ErrInvalidOrder = errors.New("order must list every module exactly once")
+)
+
+// DataKind - вид профильных данных; у каждой роли свой набор
+type DataKind string
+
+const (
+	DataUser   DataKind = "user"
+	DataAdmin  DataKind = "admin" // общие данные admin и owner
+	DataTutor  DataKind = "tutor"
+	DataHelper DataKind = "helper"
+)
+
+// DataKinds перечисляет все виды профильных данных
+var DataKinds = []DataKind{DataUser, DataAdmin, DataTutor, DataHelper}
+
+// roleKinds - единственное место, где роль сопоставляется с видом профильных данных
+var roleKinds = map[models.UserRole]DataKind{
+	models.RoleUser:   DataUser,
+	models.RoleAdmin:  DataAdmin,
+	models.RoleOwner:  DataAdmin,
+	models.RoleTutor:  DataTutor,
+	models.RoleHelper: DataHelper,
+}
+
+// KindForRole возвращает вид профильных данных для роли
+func KindForRole(role models.UserRole) (DataKind, error) {
+	kind, ok := roleKinds[role]
+	if !ok {
+		return "", fmt.Errorf("unknown user role %q", role)
+	}
+	return kind, nil
+}
+
+// Backend - хранилище всех данных приложения
+type Backend interface {
+	Users() UserRepository
+	UserData() UserDataRepository
+	Modules() ModuleRepository
+	ModuleFiles() ModuleFileRepository
+	GrantAudit() GrantAuditRepository
+	Enrollments() EnrollmentRepository
+	Groups() GroupRepository
+	Attendance() AttendanceRepository
+	Filials() FilialRepository
+	Downloads() DownloadLogRepository
+	AuditLog() AuditLogRepository
+	TwoFactor() TwoFactorRepository
+	Close() error
+}
+
+// UserRepository хранит учётные записи пользователей
+type UserRepository interface {
+	CreateUser(user models.User) error
+	GetUserByID(id string) (models.User, error)
+	GetUserByLogin(login string) (models.User, error)
+	GetAllUsers() ([]models.User, error)
+	SaveAllUsers(users []models.User) error
+	UpdateUser(user models.User) error
+	DeleteUser(id string) error
+}
+
+// UserDataRepository хранит профильные данные пользователей.
+// Get, Upsert и Delete выбирают вид данных по роли пользователя;
+// отсутствующая запись - os.ErrNotExist.
+type UserDataRepository interface {
+	Get(role models.UserRole, userID string) (models.UserData, error)
+	Upsert(role models.UserRole, data models.UserData) error
+	Delete(role models.UserRole, userID string) error
+	List(kind DataKind) ([]models.UserData, error)
+	SaveAll(kind DataKind, data []models.UserData) error
+}
+
+// ModuleRepository хранит описание учебных модулей в порядке показа.
+// Отсутствующий модуль - os.ErrNotExist.
+type ModuleRepository interface {
+	List() ([]models.Module, error)
+	Get(id int) (models.Module, error)
+	// Create назначает модулю новый ID и версию 1 и добавляет его в конец каталога
+	Create(module models.Module) (models.Module, error)
+	// Update заменяет модуль, если его Version совпадает с сохранённой,
+	// иначе возвращает ErrVersionConflict; возвращает модуль с новой версией
+	Update(module models.Module) (models.Module, error)
+	// Reorder расставляет модули в порядке ids; ids должны перечислять все модули
+	Reorder(ids []int) error
+	SaveAll(modules []models.Module) error
+}
+
+// ModuleFileRepository хранит списки файлов уроков по модулям
+type ModuleFileRepository interface {
+	List() ([]models.FileGroup, error)
+	GetByModule(moduleID int) ([]models.FileItem, error)
+	// SetModuleFiles заменяет список файлов модуля; пустой список удаляет группу
+	SetModuleFiles(moduleID int, files []models.FileItem) error
+	SaveAll(groups []models.FileGroup) error
+}
+
+// GrantAuditRepository - журнал выдачи тьюторам доступа к модулям.
+// Записи только добавляются; List возвращает их в порядке добавления.
+type GrantAuditRepository interface {
+	Append(event models.GrantEvent) error
+	List() ([]models.GrantEvent, error)
+	SaveAll(events []models.GrantEvent) error
+}
+
+// EnrollmentRepository хранит записи учеников на модули вместе с прогрессом.
+// Отсутствующая запись - os.ErrNotExist.
+type EnrollmentRepository interface {
+	List() ([]models.Enrollment, error)
+	Get(id string) (models.Enrollment, error)
+	Create(enrollment models.Enrollment) error
+	Update(enrollment models.Enrollment) error
+	SaveAll(enrollments []models.Enrollment) error
+}
+
+// GroupRepository хранит учебные группы с расписанием.
+// Отсутствующая группа - os.ErrNotExist.
+type GroupRepository interface {
+	List() ([]models.Group, error)
+	Get(id string) (models.Group, error)
+	Create(group models.Group) error
+	Update(group models.Group) error
+	SaveAll(groups []models.Group) error
+}
+
+// AttendanceRepository хранит отметки о посещении занятий
+type AttendanceRepository interface {
+	List() ([]models.Attendance, error)
+	// Mark добавляет отметки, заменяя прежние отметки того же ученика на том же занятии
+	Mark(records []models.Attendance) error
+	SaveAll(records []models.Attendance) error
+}
+
+// FilialRepository хранит справочник филиалов.
+// Отсутствующий филиал - os.ErrNotExist.
+type FilialRepository interface {
+	List() ([]models.Filial, error)
+	Get(id string) (models.Filial, error)
+	Create(filial models.Filial) error
+	Update(filial models.Filial) error
+	Delete(id string) error
+	SaveAll(filials []models.Filial) error
+}
+
+// DownloadLogRepository - журнал скачиваний файлов уроков.
+// Записи только добавляются; List возвращает их в порядке добавления.
+type DownloadLogRepository interface {
+	Append(download models.Download) error
+	List() ([]models.Download, error)
+	SaveAll(downloads []models.Download) error
+}
+
+// AuditLogRepository - журнал аудита действий с пользователями и данными.
+// Записи только добавляются, заменить или удалить их нельзя; List возвращает
+// их в порядке добавления. Append добавляет несколько записей одной операцией.
+type AuditLogRepository interface {
+	Append(events ...models.AuditEvent) error
+	List() ([]models.AuditEvent, error)
+}
+
+// TwoFactorRepository хранит настройки двухфакторной аутентификации,
+// по одной записи на пользователя. Отсутствующая запись - os.ErrNotExist.
+type TwoFactorRepository interface {
+	Get(userID string) (models.TwoFactor, error)
+	// Save добавляет или заменяет запись пользователя
+	Save(record models.TwoFactor) error
+	Delete(userID string) error
+	List() ([]models.TwoFactor, error)
+	SaveAll(records []models.TwoFactor) error
+}
+
+// ReorderModules возвращает modules в порядке ids
+func ReorderModules(modules []models.Module, ids []int) ([]models.Module, error) {
+	if len(ids) != len(modules) {
+		return nil, ErrInvalidOrder
+	}
+
+	byID := make(map[int]models.Module, len(modules))
+	for _, m := range modules {
+		byID[m.ID] = m
+	}
+
+	result := make([]models.Module, 0, len(ids))
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok {
+			return nil, ErrInvalidOrder
+		}
+		delete(byID, id)
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// Copy переносит всё содержимое src в dst, заменяя данные dst. Журнал аудита
+// не заменяется: его переносит AppendAuditLog.
+func Copy(dst, src Backend) error {
+	users, err := src.Users().GetAllUsers()
+	if err != nil {
+		return err
+	}
+	if err := dst.Users().SaveAllUsers(users); err != nil {
+		return err
+	}
+
+	for _, kind := range DataKinds {
+		data, err := src.UserData().List(kind)
+		if err != nil {
+			return err
+		}
+		if err := dst.UserData().SaveAll(kind, data); err != nil {
+			return err
+		}
+	}
+
+	modules, err := src.Modules().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Modules().SaveAll(modules); err != nil {
+		return err
+	}
+
+	groups, err := src.ModuleFiles().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.ModuleFiles().SaveAll(groups); err != nil {
+		return err
+	}
+
+	events, err := src.GrantAudit().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.GrantAudit().SaveAll(events); err != nil {
+		return err
+	}
+
+	enrollments, err := src.Enrollments().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Enrollments().SaveAll(enrollments); err != nil {
+		return err
+	}
+
+	groupList, err := src.Groups().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Groups().SaveAll(groupList); err != nil {
+		return err
+	}
+
+	attendance, err := src.Attendance().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Attendance().SaveAll(attendance); err != nil {
+		return err
+	}
+
+	filials, err := src.Filials().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Filials().SaveAll(filials); err != nil {
+		return err
+	}
+
+	downloads, err := src.Downloads().List()
+	if err != nil {
+		return err
+	}
+	if err := dst.Downloads().SaveAll(downloads); err != nil {
+		return err
+	}
+
+	twoFactor, err := src.TwoFactor().List()
+	if err != nil {
+		return err
+	}
+	return dst.TwoFactor().SaveAll(twoFactor)
+}
+
+// AppendAuditLog дописывает в журнал аудита dst записи src, которых в нём
+// ещё нет, сохраняя их порядок. Записи dst не меняются.
+func AppendAuditLog(dst, src Backend) error {
+	events, err := src.AuditLog().List()
+	if err != nil {
+		return err
+	}
+	existing, err := dst.AuditLog().List()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		seen[e.ID] = true
+	}
+	var added []models.AuditEvent
+	for _, e := range events {
+		if !seen[e.ID] {
+			added = append(added, e)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	return dst.AuditLog().Append(added...)
+}
@@ -0,0 +1,408 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+	"myapp/internal/storage/sqlstore"
+)
+
+// backends - реализации storage.Backend, которые должны вести себя одинаково
+var backends = []struct {
+	name string
+	open func(dir string) (storage.Backend, error)
+}{
+	{"json", func(dir string) (storage.Backend, error) { return storage.NewJSONBackend(dir) }},
+	{"sqlite", func(dir string) (storage.Backend, error) { return sqlstore.Open(filepath.Join(dir, "app.db")) }},
+}
+
+// forEachBackend запускает fn на пустом хранилище каждой реализации
+func forEachBackend(t *testing.T, fn func(t *testing.T, b storage.Backend)) {
+	for _, impl := range backends {
+		t.Run(impl.name, func(t *testing.T) {
+			b, err := impl.open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { b.Close() })
+			fn(t, b)
+		})
+	}
+}
+
+func TestBackendUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storage.Backend) {
+		users := b.Users()
+		alice := models.User{ID: "1", Login: "alice", Password: "hash", Name: "Alice", Filial: "1", Role: models.RoleTutor, Status: models.StatusActive}
+		bob := models.User{ID: "2", Login: "bob", Password: "hash", Name: "Bob", Filial: "2", Role: models.RoleUser, Status: models.StatusActive, MustChangePassword: true, ResetExpiresAt: 42}
+		for _, u := range []models.User{alice, bob} {
+			if err := users.CreateUser(u); err != nil {
+				t.Fatalf("CreateUser(%s) = %v", u.Login, err)
+			}
+		}
+		if err := users.CreateUser(models.User{ID: "3", Login: "alice"}); err == nil {
+			t.Error("CreateUser with a taken login succeeded")
+		}
+
+		if got, err := users.GetUserByID(bob.ID); err != nil || got != bob {
+			t.Errorf("GetUserByID = %+v, %v; want %+v", got, err, bob)
+		}
+		if got, err := users.GetUserByLogin("alice"); err != nil || got != alice {
+			t.Errorf("GetUserByLogin = %+v, %v; want %+v", got, err, alice)
+		}
+		if _, err := users.GetUserByID("404"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("GetUserByID(missing) = %v, want os.ErrNotExist", err)
+		}
+		if _, err := users.GetUserByLogin("nobody"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("GetUserByLogin(missing) = %v, want os.ErrNotExist", err)
+		}
+
+		alice.Name, alice.Status = "Alice B.", models.StatusFrozen
+		if err := users.UpdateUser(alice); err != nil {
+			t.Fatalf("UpdateUser = %v", err)
+		}
+		if err := users.UpdateUser(models.User{ID: "404", Login: "ghost"}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("UpdateUser(missing) = %v, want os.ErrNotExist", err)
+		}
+		if err := users.DeleteUser(bob.ID); err != nil {
+			t.Fatalf("DeleteUser = %v", err)
+		}
+		if err := users.DeleteUser(bob.ID); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("second DeleteUser = %v, want os.ErrNotExist", err)
+		}
+
+		all, err := users.GetAllUsers()
+		if err != nil || !slices.Equal(all, []models.User{alice}) {
+			t.Errorf("GetAllUsers = %+v, %v; want only %+v", all, err, alice)
+		}
+	})
+}
+
+func TestBackendUserData(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storage.Backend) {
+		data := b.UserData()
+		tutor := models.UserData{ID: "1", Links: []models.Link{{URL: "https://example.com", Type: "site"}}, Modules: []models.ModuleInfo{{Module: 5, Date: 253370764800000}}}
+		if err := data.Upsert(models.RoleTutor, tutor); err != nil {
+			t.Fatal(err)
+		}
+		// Владелец и администратор делят один вид данных
+		owner := models.UserData{ID: "2", Links: []models.Link{{URL: "https://example.org", Type: "blog"}}}
+		if err := data.Upsert(models.RoleOwner, owner); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, err := data.Get(models.RoleTutor, "1"); err != nil || !sameValue(got, tutor) {
+			t.Errorf("Get(tutor) = %+v, %v; want %+v", got, err, tutor)
+		}
+		if got, err := data.Get(models.RoleAdmin, "2"); err != nil || !sameValue(got, owner) {
+			t.Errorf("Get(admin) of the owner's data = %+v, %v; want %+v", got, err, owner)
+		}
+		if _, err := data.Get(models.RoleUser, "1"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Get with another role = %v, want os.ErrNotExist", err)
+		}
+
+		tutor.Modules = append(tutor.Modules, models.ModuleInfo{Module: 7, Date: 1})
+		if err := data.Upsert(models.RoleTutor, tutor); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := data.List(storage.DataTutor); err != nil || !sameValue(list, []models.UserData{tutor}) {
+			t.Errorf("List(tutor) after an update = %+v, %v", list, err)
+		}
+
+		if err := data.Delete(models.RoleTutor, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := data.Delete(models.RoleTutor, "1"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("second Delete = %v, want os.ErrNotExist", err)
+		}
+	})
+}
+
+func TestBackendModules(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storage.Backend) {
+		modules := b.Modules()
+		var ids []int
+		for _, name := range []string{"first", "second", "third"} {
+			m, err := modules.Create(models.Module{Name: name, TotalClasses: 8})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Version != 1 || slices.Contains(ids, m.ID) {
+				t.Fatalf("Create(%s) = %+v; want a new ID and version 1", name, m)
+			}
+			ids = append(ids, m.ID)
+		}
+		if _, err := modules.Get(-1); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Get(missing) = %v, want os.ErrNotExist", err)
+		}
+
+		// Оптимистичная блокировка: устаревшая версия не перезаписывает изменения
+		m, _ := modules.Get(ids[0])
+		m.Name = "renamed"
+		updated, err := modules.Update(m)
+		if err != nil || updated.Version != 2 {
+			t.Fatalf("Update = %+v, %v; want version 2", updated, err)
+		}
+		m.Name = "stale"
+		if _, err := modules.Update(m); !errors.Is(err, storage.ErrVersionConflict) {
+			t.Errorf("Update with a stale version = %v, want ErrVersionConflict", err)
+		}
+		if got, _ := modules.Get(ids[0]); got.Name != "renamed" || got.Version != 2 {
+			t.Errorf("after a conflict the module is %+v", got)
+		}
+		if _, err := modules.Update(models.Module{ID: -1, Version: 1}); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Update(missing) = %v, want os.ErrNotExist", err)
+		}
+
+		order := func() []int {
+			t.Helper()
+			list, err := modules.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, m := range list {
+				got = append(got, m.ID)
+			}
+			return got
+		}
+		reversed := []int{ids[2], ids[1], ids[0]}
+		if err := modules.Reorder(reversed); err != nil {
+			t.Fatalf("Reorder = %v", err)
+		}
+		if got := order(); !slices.Equal(got, reversed) {
+			t.Errorf("order after Reorder = %v, want %v", got, reversed)
+		}
+		for _, bad := range [][]int{
+			{ids[0], ids[1]},
+			{ids[0], ids[1], ids[1]},
+			{ids[0], ids[1], -1},
+			{ids[0], ids[1], ids[2], -1},
+		} {
+			if err := modules.Reorder(bad); !errors.Is(err, storage.ErrInvalidOrder) {
+				t.Errorf("Reorder(%v) = %v, want ErrInvalidOrder", bad, err)
+			}
+		}
+		if got := order(); !slices.Equal(got, reversed) {
+			t.Errorf("a rejected Reorder changed the order to %v", got)
+		}
+	})
+}
+
+func TestBackendRecords(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b storage.Backend) {
+		if _, err := b.Enrollments().Get("404"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Enrollments().Get(missing) = %v, want os.ErrNotExist", err)
+		}
+		if _, err := b.Groups().Get("404"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Groups().Get(missing) = %v, want os.ErrNotExist", err)
+		}
+		if _, err := b.Filials().Get("404"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Filials().Get(missing) = %v, want os.ErrNotExist", err)
+		}
+		if _, err := b.TwoFactor().Get("404"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("TwoFactor().Get(missing) = %v, want os.ErrNotExist", err)
+		}
+
+		f := models.Filial{ID: "1", Name: "Центр", Timezone: "Europe/Moscow", Active: true}
+		if err := b.Filials().Create(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Active = false
+		if err := b.Filials().Update(f); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.Filials().Get("1"); err != nil || got != f {
+			t.Errorf("Filials().Get = %+v, %v; want %+v", got, err, f)
+		}
+		if err := b.Filials().Delete("1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Filials().Delete("1"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("second Filials().Delete = %v, want os.ErrNotExist", err)
+		}
+
+		e := sampleEnrollment()
+		if err := b.Enrollments().Create(e); err != nil {
+			t.Fatal(err)
+		}
+		e.Status = models.EnrollmentDropped
+		if err := b.Enrollments().Update(e); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.Enrollments().Get(e.ID); err != nil || !sameValue(got, e) {
+			t.Errorf("Enrollments().Get = %+v, %v; want %+v", got, err, e)
+		}
+	})
+}
+
+// TestCopy: Copy переносит всё, кроме журнала аудита, из любой реализации в
+// любую, а AppendAuditLog только дописывает недостающие записи
+func TestCopy(t *testing.T) {
+	for _, from := range backends {
+		for _, to := range backends {
+			t.Run(from.name+"->"+to.name, func(t *testing.T) {
+				src, err := from.open(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer src.Close()
+				dst, err := to.open(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer dst.Close()
+
+				fillBackend(t, src)
+				// Данные dst заменяются, а его журнал аудита сохраняется
+				if err := dst.Users().CreateUser(models.User{ID: "99", Login: "old"}); err != nil {
+					t.Fatal(err)
+				}
+				own := models.AuditEvent{ID: "dst-1", At: 1, Action: "login"}
+				shared := models.AuditEvent{ID: "audit-1", At: 2, Action: "create"}
+				if err := dst.AuditLog().Append(own, shared); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := storage.Copy(dst, src); err != nil {
+					t.Fatalf("Copy = %v", err)
+				}
+				assertSameData(t, dst, src)
+				if log, _ := dst.AuditLog().List(); len(log) != 2 {
+					t.Errorf("Copy changed the audit log of dst: %+v", log)
+				}
+
+				for i := 0; i < 2; i++ {
+					if err := storage.AppendAuditLog(dst, src); err != nil {
+						t.Fatalf("AppendAuditLog = %v", err)
+					}
+				}
+				log, err := dst.AuditLog().List()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, e := range log {
+					got = append(got, e.ID)
+				}
+				if want := []string{"dst-1", "audit-1", "audit-2"}; !slices.Equal(got, want) {
+					t.Errorf("audit log after AppendAuditLog = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func sampleEnrollment() models.Enrollment {
+	return models.Enrollment{
+		ID: "e1", StudentID: "2", Module: 1, TutorID: "1", Status: models.EnrollmentActive,
+		EnrolledAt: 100, EnrolledBy: "1",
+		Progress: []models.LessonProgress{{FileName: "lesson1", State: models.LessonCompleted, UpdatedAt: 200, UpdatedBy: "1"}},
+	}
+}
+
+// fillBackend заполняет каждое хранилище b непустыми данными
+func fillBackend(t *testing.T, b storage.Backend) {
+	t.Helper()
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(b.Users().SaveAllUsers([]models.User{
+		{ID: "1", Login: "tutor", Password: "hash", Name: "Tutor", Filial: "1", Role: models.RoleTutor, Status: models.StatusActive},
+		{ID: "2", Login: "student", Password: "hash", Name: "Student", Filial: "1", Role: models.RoleUser, Status: models.StatusActive, MustChangePassword: true, ResetExpiresAt: 42},
+	}))
+	check(b.UserData().SaveAll(storage.DataTutor, []models.UserData{{ID: "1", Links: []models.Link{{URL: "https://example.com", Type: "site"}}, Modules: []models.ModuleInfo{{Module: 1, Date: 253370764800000}}}}))
+	check(b.UserData().SaveAll(storage.DataUser, []models.UserData{{ID: "2", Links: []models.Link{{URL: "https://example.org", Type: "blog"}}}}))
+	check(b.Modules().SaveAll([]models.Module{
+		{ID: 2, Name: "second", TotalClasses: 4, Version: 3},
+		{ID: 1, Name: "first", TotalClasses: 8, Archived: true, Version: 1},
+	}))
+	check(b.ModuleFiles().SaveAll([]models.FileGroup{{ID: 1, Files: []models.FileItem{{Title: "Урок 1", FileName: "lesson1"}, {Title: "Урок 2", FileName: "lesson2"}}}}))
+	check(b.GrantAudit().SaveAll([]models.GrantEvent{{ID: "g1", At: 10, ActorID: "9", ActorLogin: "owner", TutorID: "1", Module: 1, Action: models.GrantGranted, Until: 253370764800000}}))
+	check(b.Enrollments().SaveAll([]models.Enrollment{sampleEnrollment()}))
+	check(b.Groups().SaveAll([]models.Group{{ID: "g1", Name: "Группа", Filial: "1", Module: 1, TutorID: "1", StudentIDs: []string{"2"}, Schedule: []models.ScheduleSlot{{Weekday: 1, Start: "10:00", Duration: 90}}, StartsOn: "2026-09-01"}}))
+	check(b.Attendance().SaveAll([]models.Attendance{{GroupID: "g1", Date: "2026-09-07", Start: "10:00", StudentID: "2", Status: models.AttendanceLate, MarkedBy: "1", MarkedAt: 300}}))
+	check(b.Filials().SaveAll([]models.Filial{{ID: "1", Name: "Центр", Timezone: "Europe/Moscow", Active: true}}))
+	check(b.Downloads().SaveAll([]models.Download{{ID: "d1", At: 400, UserID: "2", UserLogin: "student", FileName: "lesson1", Module: 1, Via: "link", RemoteAddr: "10.0.0.1"}}))
+	check(b.TwoFactor().SaveAll([]models.TwoFactor{{UserID: "1", Secret: "JBSWY3DPEHPK3PXP", Enabled: true, EnabledAt: 500, RecoveryCodes: []string{"abc"}, LastStep: 7}}))
+	check(b.AuditLog().Append(
+		models.AuditEvent{ID: "audit-1", At: 2, Action: "create"},
+		models.AuditEvent{ID: "audit-2", At: 3, ActorID: "9", Action: "update", TargetID: "2", Changes: []models.AuditChange{{Field: "name", Before: json.RawMessage(`"a"`), After: json.RawMessage(`"b"`)}}},
+	))
+}
+
+// assertSameData сравнивает содержимое всех хранилищ, кроме журнала аудита
+func assertSameData(t *testing.T, got, want storage.Backend) {
+	t.Helper()
+	compare := func(name string, read func(b storage.Backend) (any, error)) {
+		t.Helper()
+		w, err := read(want)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		g, err := read(got)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !sameValue(g, w) {
+			t.Errorf("%s = %+v, want %+v", name, g, w)
+		}
+	}
+	compare("users", func(b storage.Backend) (any, error) { return b.Users().GetAllUsers() })
+	for _, kind := range storage.DataKinds {
+		compare(string(kind)+" data", func(b storage.Backend) (any, error) { return b.UserData().List(kind) })
+	}
+	compare("modules", func(b storage.Backend) (any, error) { return b.Modules().List() })
+	compare("module files", func(b storage.Backend) (any, error) { return b.ModuleFiles().List() })
+	compare("grant audit", func(b storage.Backend) (any, error) { return b.GrantAudit().List() })
+	compare("enrollments", func(b storage.Backend) (any, error) { return b.Enrollments().List() })
+	compare("groups", func(b storage.Backend) (any, error) { return b.Groups().List() })
+	compare("attendance", func(b storage.Backend) (any, error) { return b.Attendance().List() })
+	compare("filials", func(b storage.Backend) (any, error) { return b.Filials().List() })
+	compare("downloads", func(b storage.Backend) (any, error) { return b.Downloads().List() })
+	compare("two-factor", func(b storage.Backend) (any, error) { return b.TwoFactor().List() })
+}
+
+// sameValue сравнивает значения как reflect.DeepEqual, но считает пустой и
+// nil-срез одинаковыми: JSON хранит их как [] или опускает поле, а SQL-хранилище
+// читает JSON-колонки в пустые срезы
+func sameValue(a, b any) bool {
+	return sameReflect(reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func sameReflect(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() || a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameReflect(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameReflect(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
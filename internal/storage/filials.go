@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"myapp/internal/models"
+)
+
+// jsonFilials хранит справочник филиалов в filials.json
+type jsonFilials struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type filialsFile struct {
+	Filials []models.Filial `json:"filials"`
+}
+
+func (s *jsonFilials) load() ([]models.Filial, error) {
+	var file filialsFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Filials, nil
+}
+
+func (s *jsonFilials) save(filials []models.Filial) error {
+	if filials == nil {
+		filials = []models.Filial{}
+	}
+	return writeJSONFile(s.filePath, filialsFile{Filials: filials})
+}
+
+func (s *jsonFilials) List() ([]models.Filial, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonFilials) Get(id string) (models.Filial, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filials, err := s.load()
+	if err != nil {
+		return models.Filial{}, err
+	}
+	if i := slices.IndexFunc(filials, func(f models.Filial) bool { return f.ID == id }); i >= 0 {
+		return filials[i], nil
+	}
+	return models.Filial{}, os.ErrNotExist
+}
+
+func (s *jsonFilials) Create(filial models.Filial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filials, err := s.load()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(filials, func(f models.Filial) bool { return f.ID == filial.ID }) {
+		return fmt.Errorf("filial with ID %s already exists", filial.ID)
+	}
+	return s.save(append(filials, filial))
+}
+
+func (s *jsonFilials) Update(filial models.Filial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filials, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(filials, func(f models.Filial) bool { return f.ID == filial.ID })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	filials[i] = filial
+	return s.save(filials)
+}
+
+func (s *jsonFilials) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filials, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(filials, func(f models.Filial) bool { return f.ID == id })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	return s.save(slices.Delete(filials, i, i+1))
+}
+
+func (s *jsonFilials) SaveAll(filials []models.Filial) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(filials)
+}
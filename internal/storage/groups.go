@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"myapp/internal/models"
+)
+
+// jsonGroups хранит учебные группы в groups.json
+type jsonGroups struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type groupsFile struct {
+	Groups []models.Group `json:"groups"`
+}
+
+func (s *jsonGroups) load() ([]models.Group, error) {
+	var file groupsFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Groups, nil
+}
+
+func (s *jsonGroups) save(groups []models.Group) error {
+	if groups == nil {
+		groups = []models.Group{}
+	}
+	return writeJSONFile(s.filePath, groupsFile{Groups: groups})
+}
+
+func (s *jsonGroups) List() ([]models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonGroups) Get(id string) (models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.load()
+	if err != nil {
+		return models.Group{}, err
+	}
+	if i := slices.IndexFunc(groups, func(g models.Group) bool { return g.ID == id }); i >= 0 {
+		return groups[i], nil
+	}
+	return models.Group{}, os.ErrNotExist
+}
+
+func (s *jsonGroups) Create(group models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.load()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(groups, func(g models.Group) bool { return g.ID == group.ID }) {
+		return fmt.Errorf("group with ID %s already exists", group.ID)
+	}
+	return s.save(append(groups, group))
+}
+
+func (s *jsonGroups) Update(group models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(groups, func(g models.Group) bool { return g.ID == group.ID })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	groups[i] = group
+	return s.save(groups)
+}
+
+func (s *jsonGroups) SaveAll(groups []models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(groups)
+}
+
+// jsonAttendance хранит отметки о посещении в attendance.json
+type jsonAttendance struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type attendanceFile struct {
+	Records []models.Attendance `json:"records"`
+}
+
+func (s *jsonAttendance) load() ([]models.Attendance, error) {
+	var file attendanceFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Records, nil
+}
+
+func (s *jsonAttendance) save(records []models.Attendance) error {
+	if records == nil {
+		records = []models.Attendance{}
+	}
+	return writeJSONFile(s.filePath, attendanceFile{Records: records})
+}
+
+func (s *jsonAttendance) List() ([]models.Attendance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonAttendance) Mark(marks []models.Attendance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, mark := range marks {
+		records = slices.DeleteFunc(records, func(r models.Attendance) bool { return sameClassMark(r, mark) })
+		records = append(records, mark)
+	}
+	return s.save(records)
+}
+
+func (s *jsonAttendance) SaveAll(records []models.Attendance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(records)
+}
+
+// sameClassMark сообщает, относятся ли отметки к одному ученику на одном занятии
+func sameClassMark(a, b models.Attendance) bool {
+	return a.GroupID == b.GroupID && a.Date == b.Date && a.Start == b.Start && a.StudentID == b.StudentID
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// readJSONFile читает JSON-файл в v; отсутствующий файл не считается ошибкой
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return corruptedError(path, err)
+	}
+	return nil
+}
+
+// writeJSONFile атомарно записывает v в файл с отступами
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0644)
+}
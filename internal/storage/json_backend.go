@@ -0,0 +1,508 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"myapp/internal/models"
+)
+
+// Имена файлов JSON-хранилища
+const (
+	UsersFile       = "users.json"
+	ModulesFile     = "modules-description.json"
+	ModuleFilesFile = "modules-files.json"
+	GrantAuditFile  = "grants-audit.json"
+	EnrollmentsFile = "enrollments.json"
+	GroupsFile      = "groups.json"
+	AttendanceFile  = "attendance.json"
+	FilialsFile     = "filials.json"
+	DownloadsFile   = "downloads.json"
+	AuditLogFile    = "audit-log.json"
+	TwoFactorFile   = "two-factor.json"
+)
+
+// dataFiles сопоставляет вид профильных данных с файлом
+var dataFiles = map[DataKind]string{
+	DataUser:   "user-data.json",
+	DataAdmin:  "admin-data.json",
+	DataTutor:  "tutor-data.json",
+	DataHelper: "helper-data.json",
+}
+
+// JSONBackend хранит данные в JSON-файлах одного каталога
+type JSONBackend struct {
+	users       *JSONUserStorage
+	userData    *jsonUserData
+	modules     *jsonModules
+	moduleFiles *jsonModuleFiles
+	grantAudit  *jsonGrantAudit
+	enrollments *jsonEnrollments
+	groups      *jsonGroups
+	attendance  *jsonAttendance
+	filials     *jsonFilials
+	downloads   *jsonDownloads
+	auditLog    *jsonAuditLog
+	twoFactor   *jsonTwoFactor
+}
+
+// NewJSONBackend открывает JSON-хранилище в каталоге dir
+func NewJSONBackend(dir string) (*JSONBackend, error) {
+	users, err := NewJSONUserStorage(filepath.Join(dir, UsersFile))
+	if err != nil {
+		return nil, fmt.Errorf("load users: %w", err)
+	}
+
+	return &JSONBackend{
+		users:       users,
+		userData:    newJSONUserData(dir),
+		modules:     &jsonModules{filePath: filepath.Join(dir, ModulesFile)},
+		moduleFiles: &jsonModuleFiles{filePath: filepath.Join(dir, ModuleFilesFile)},
+		grantAudit:  &jsonGrantAudit{filePath: filepath.Join(dir, GrantAuditFile)},
+		enrollments: &jsonEnrollments{filePath: filepath.Join(dir, EnrollmentsFile)},
+		groups:      &jsonGroups{filePath: filepath.Join(dir, GroupsFile)},
+		attendance:  &jsonAttendance{filePath: filepath.Join(dir, AttendanceFile)},
+		filials:     &jsonFilials{filePath: filepath.Join(dir, FilialsFile)},
+		downloads:   &jsonDownloads{filePath: filepath.Join(dir, DownloadsFile)},
+		auditLog:    &jsonAuditLog{filePath: filepath.Join(dir, AuditLogFile)},
+		twoFactor:   &jsonTwoFactor{filePath: filepath.Join(dir, TwoFactorFile)},
+	}, nil
+}
+
+func (b *JSONBackend) Users() UserRepository             { return b.users }
+func (b *JSONBackend) UserData() UserDataRepository      { return b.userData }
+func (b *JSONBackend) Modules() ModuleRepository         { return b.modules }
+func (b *JSONBackend) ModuleFiles() ModuleFileRepository { return b.moduleFiles }
+func (b *JSONBackend) GrantAudit() GrantAuditRepository  { return b.grantAudit }
+func (b *JSONBackend) Enrollments() EnrollmentRepository { return b.enrollments }
+func (b *JSONBackend) Groups() GroupRepository           { return b.groups }
+func (b *JSONBackend) Attendance() AttendanceRepository  { return b.attendance }
+func (b *JSONBackend) Filials() FilialRepository         { return b.filials }
+func (b *JSONBackend) Downloads() DownloadLogRepository  { return b.downloads }
+func (b *JSONBackend) AuditLog() AuditLogRepository      { return b.auditLog }
+func (b *JSONBackend) TwoFactor() TwoFactorRepository    { return b.twoFactor }
+func (b *JSONBackend) Close() error                      { return nil }
+
+// jsonModules хранит модули в modules-description.json
+type jsonModules struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type modulesFile struct {
+	LearningModules []models.Module `json:"learningModules"`
+}
+
+// load читает каталог; модули из старых файлов без версии получают версию 1.
+// Вызывается под s.mu.
+func (s *jsonModules) load() ([]models.Module, error) {
+	var file modulesFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	for i := range file.LearningModules {
+		if file.LearningModules[i].Version == 0 {
+			file.LearningModules[i].Version = 1
+		}
+	}
+	return file.LearningModules, nil
+}
+
+func (s *jsonModules) save(modules []models.Module) error {
+	if modules == nil {
+		modules = []models.Module{}
+	}
+	return writeJSONFile(s.filePath, modulesFile{LearningModules: modules})
+}
+
+func (s *jsonModules) List() ([]models.Module, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonModules) Get(id int) (models.Module, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modules, err := s.load()
+	if err != nil {
+		return models.Module{}, err
+	}
+	if i := slices.IndexFunc(modules, func(m models.Module) bool { return m.ID == id }); i >= 0 {
+		return modules[i], nil
+	}
+	return models.Module{}, os.ErrNotExist
+}
+
+func (s *jsonModules) Create(module models.Module) (models.Module, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modules, err := s.load()
+	if err != nil {
+		return models.Module{}, err
+	}
+
+	module.ID = 1
+	for _, m := range modules {
+		module.ID = max(module.ID, m.ID+1)
+	}
+	module.Version = 1
+
+	if err := s.save(append(modules, module)); err != nil {
+		return models.Module{}, err
+	}
+	return module, nil
+}
+
+func (s *jsonModules) Update(module models.Module) (models.Module, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modules, err := s.load()
+	if err != nil {
+		return models.Module{}, err
+	}
+
+	i := slices.IndexFunc(modules, func(m models.Module) bool { return m.ID == module.ID })
+	if i < 0 {
+		return models.Module{}, os.ErrNotExist
+	}
+	if modules[i].Version != module.Version {
+		return models.Module{}, ErrVersionConflict
+	}
+
+	module.Version++
+	modules[i] = module
+	if err := s.save(modules); err != nil {
+		return models.Module{}, err
+	}
+	return module, nil
+}
+
+func (s *jsonModules) Reorder(ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	modules, err := s.load()
+	if err != nil {
+		return err
+	}
+	ordered, err := ReorderModules(modules, ids)
+	if err != nil {
+		return err
+	}
+	return s.save(ordered)
+}
+
+func (s *jsonModules) SaveAll(modules []models.Module) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(modules)
+}
+
+// jsonModuleFiles хранит списки файлов в modules-files.json.
+// Формат файла исторически использует поля с заглавной буквы ("ID", "Files").
+type jsonModuleFiles struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type moduleFilesFile struct {
+	Files []fileGroupRecord `json:"files"`
+}
+
+type fileGroupRecord struct {
+	ID    int              `json:"ID"`
+	Files []fileItemRecord `json:"Files"`
+}
+
+type fileItemRecord struct {
+	Title    string `json:"Title"`
+	FileName string `json:"FileName"`
+}
+
+func (s *jsonModuleFiles) load() ([]models.FileGroup, error) {
+	var file moduleFilesFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+
+	groups := make([]models.FileGroup, 0, len(file.Files))
+	for _, rec := range file.Files {
+		group := models.FileGroup{ID: rec.ID, Files: make([]models.FileItem, 0, len(rec.Files))}
+		for _, f := range rec.Files {
+			group.Files = append(group.Files, models.FileItem{Title: f.Title, FileName: f.FileName})
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+func (s *jsonModuleFiles) List() ([]models.FileGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonModuleFiles) GetByModule(moduleID int) ([]models.FileItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.ID == moduleID {
+			return group.Files, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *jsonModuleFiles) SetModuleFiles(moduleID int, files []models.FileItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(groups, func(g models.FileGroup) bool { return g.ID == moduleID })
+	switch {
+	case len(files) == 0 && i >= 0:
+		groups = slices.Delete(groups, i, i+1)
+	case len(files) == 0:
+		return nil
+	case i >= 0:
+		groups[i].Files = files
+	default:
+		groups = append(groups, models.FileGroup{ID: moduleID, Files: files})
+	}
+	return s.save(groups)
+}
+
+func (s *jsonModuleFiles) SaveAll(groups []models.FileGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(groups)
+}
+
+// save записывает группы в исторический формат. Вызывается под s.mu.
+func (s *jsonModuleFiles) save(groups []models.FileGroup) error {
+	file := moduleFilesFile{Files: make([]fileGroupRecord, 0, len(groups))}
+	for _, group := range groups {
+		rec := fileGroupRecord{ID: group.ID, Files: make([]fileItemRecord, 0, len(group.Files))}
+		for _, f := range group.Files {
+			rec.Files = append(rec.Files, fileItemRecord{Title: f.Title, FileName: f.FileName})
+		}
+		file.Files = append(file.Files, rec)
+	}
+	return writeJSONFile(s.filePath, file)
+}
+
+// jsonGrantAudit хранит журнал выдачи доступа в grants-audit.json
+type jsonGrantAudit struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type grantAuditFile struct {
+	Events []models.GrantEvent `json:"events"`
+}
+
+func (s *jsonGrantAudit) Append(event models.GrantEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file grantAuditFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return err
+	}
+	file.Events = append(file.Events, event)
+	return writeJSONFile(s.filePath, file)
+}
+
+func (s *jsonGrantAudit) List() ([]models.GrantEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file grantAuditFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Events, nil
+}
+
+func (s *jsonGrantAudit) SaveAll(events []models.GrantEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if events == nil {
+		events = []models.GrantEvent{}
+	}
+	return writeJSONFile(s.filePath, grantAuditFile{Events: events})
+}
+
+// jsonDownloads хранит журнал скачиваний в downloads.json
+type jsonDownloads struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type downloadsFile struct {
+	Downloads []models.Download `json:"downloads"`
+}
+
+func (s *jsonDownloads) Append(download models.Download) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file downloadsFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return err
+	}
+	file.Downloads = append(file.Downloads, download)
+	return writeJSONFile(s.filePath, file)
+}
+
+func (s *jsonDownloads) List() ([]models.Download, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file downloadsFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Downloads, nil
+}
+
+func (s *jsonDownloads) SaveAll(downloads []models.Download) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if downloads == nil {
+		downloads = []models.Download{}
+	}
+	return writeJSONFile(s.filePath, downloadsFile{Downloads: downloads})
+}
+
+// jsonAuditLog хранит журнал аудита в audit-log.json
+type jsonAuditLog struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type auditLogFile struct {
+	Events []models.AuditEvent `json:"events"`
+}
+
+func (s *jsonAuditLog) Append(events ...models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file auditLogFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return err
+	}
+	file.Events = append(file.Events, events...)
+	return writeJSONFile(s.filePath, file)
+}
+
+func (s *jsonAuditLog) List() ([]models.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var file auditLogFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Events, nil
+}
+
+// jsonEnrollments хранит записи на модули в enrollments.json
+type jsonEnrollments struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type enrollmentsFile struct {
+	Enrollments []models.Enrollment `json:"enrollments"`
+}
+
+func (s *jsonEnrollments) load() ([]models.Enrollment, error) {
+	var file enrollmentsFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.Enrollments, nil
+}
+
+func (s *jsonEnrollments) save(enrollments []models.Enrollment) error {
+	if enrollments == nil {
+		enrollments = []models.Enrollment{}
+	}
+	return writeJSONFile(s.filePath, enrollmentsFile{Enrollments: enrollments})
+}
+
+func (s *jsonEnrollments) List() ([]models.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonEnrollments) Get(id string) (models.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollments, err := s.load()
+	if err != nil {
+		return models.Enrollment{}, err
+	}
+	if i := slices.IndexFunc(enrollments, func(e models.Enrollment) bool { return e.ID == id }); i >= 0 {
+		return enrollments[i], nil
+	}
+	return models.Enrollment{}, os.ErrNotExist
+}
+
+func (s *jsonEnrollments) Create(enrollment models.Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollments, err := s.load()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(enrollments, func(e models.Enrollment) bool { return e.ID == enrollment.ID }) {
+		return fmt.Errorf("enrollment with ID %s already exists", enrollment.ID)
+	}
+	return s.save(append(enrollments, enrollment))
+}
+
+func (s *jsonEnrollments) Update(enrollment models.Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollments, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(enrollments, func(e models.Enrollment) bool { return e.ID == enrollment.ID })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	enrollments[i] = enrollment
+	return s.save(enrollments)
+}
+
+func (s *jsonEnrollments) SaveAll(enrollments []models.Enrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(enrollments)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked возвращается, если каталог хранилища уже занят другим процессом
+var ErrLocked = errors.New("storage directory is locked by another process")
+
+// DirLock - эксклюзивная рекомендательная блокировка каталога хранилища
+type DirLock struct {
+	file *os.File
+}
+
+// LockDir захватывает блокировку каталога dir (файл dir/.lock).
+// Второй процесс сервера с тем же каталогом получит ErrLocked.
+func LockDir(dir string) (*DirLock, error) {
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &DirLock{file: f}, nil
+}
+
+// Unlock освобождает блокировку
+func (l *DirLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	unlockFile(l.file)
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
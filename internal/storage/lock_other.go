@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// На платформах без flock блокировка не поддерживается
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) {}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"slices"
+
+	"myapp/internal/models"
+)
+
+// ProvisionUserData создает пустой профиль пользователя в файле его роли,
+// если профиля ещё нет
+func ProvisionUserData(repo UserDataRepository, user models.User) error {
+	_, err := repo.Get(user.Role, user.ID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return repo.Upsert(user.Role, models.UserData{ID: user.ID, Links: []models.Link{}})
+}
+
+// MoveUserData переносит профиль пользователя в файл новой роли.
+// Выданные модули есть только у тьютора, при смене роли они не переносятся.
+func MoveUserData(repo UserDataRepository, userID string, from, to models.UserRole) error {
+	fromKind, err := KindForRole(from)
+	if err != nil {
+		return err
+	}
+	toKind, err := KindForRole(to)
+	if err != nil {
+		return err
+	}
+	if fromKind == toKind {
+		return nil
+	}
+
+	data, err := repo.Get(from, userID)
+	if errors.Is(err, os.ErrNotExist) {
+		data = models.UserData{ID: userID, Links: []models.Link{}}
+	} else if err != nil {
+		return err
+	}
+
+	if toKind != DataTutor {
+		data.Modules = nil
+	}
+
+	// Сначала пишем в новый файл: при сбое профиль окажется в обоих, но не потеряется
+	if err := repo.Upsert(to, data); err != nil {
+		return err
+	}
+	if err := repo.Delete(from, userID); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SeedFilials заполняет пустой справочник филиалов ID, которые уже указаны
+// у пользователей, чтобы существующие данные остались корректными.
+// Возвращает число созданных филиалов.
+func SeedFilials(b Backend) (int, error) {
+	filials, err := b.Filials().List()
+	if err != nil || len(filials) > 0 {
+		return 0, err
+	}
+
+	users, err := b.Users().GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for _, u := range users {
+		if u.Filial != "" && !slices.Contains(ids, u.Filial) {
+			ids = append(ids, u.Filial)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		filials = append(filials, models.Filial{ID: id, Name: "Филиал " + id, Active: true})
+	}
+	if len(filials) == 0 {
+		return 0, nil
+	}
+	return len(filials), b.Filials().SaveAll(filials)
+}
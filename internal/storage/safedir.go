@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrUnsafeName - имя файла не прошло проверку; для клиента неотличимо от отсутствия файла
+var ErrUnsafeName = fmt.Errorf("unsafe file name: %w", fs.ErrNotExist)
+
+// maxNameLength - предельная длина имени файла в SafeDir
+const maxNameLength = 255
+
+// SafeDir открывает файлы только непосредственно внутри каталога. Имена
+// приходят из URL, поэтому допускаются лишь латинские буквы, цифры, '.', '_'
+// и '-' без точки в начале: разделители путей, "..", скрытые и служебные файлы
+// (.lock, временные файлы атомарной записи) и закодированные символы отвергаются.
+// Каталог открывается через os.Root, а символические ссылки не открываются,
+// даже если указывают внутрь каталога.
+type SafeDir string
+
+// ValidName сообщает, можно ли открыть файл name через SafeDir
+func ValidName(name string) bool {
+	if name == "" || len(name) > maxNameLength || name[0] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Open открывает обычный файл name для чтения. Любая причина отказа -
+// недопустимое имя, ссылка, каталог или отсутствие файла - даёт ошибку,
+// для которой errors.Is(err, fs.ErrNotExist) истинно.
+func (d SafeDir) Open(name string) (*os.File, error) {
+	if !ValidName(name) {
+		return nil, ErrUnsafeName
+	}
+	root, err := os.OpenRoot(string(d))
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	info, err := root.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, ErrUnsafeName
+	}
+
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	// Файл могли подменить ссылкой между проверкой и открытием
+	opened, err := f.Stat()
+	if err != nil || !os.SameFile(info, opened) {
+		f.Close()
+		return nil, errors.Join(ErrUnsafeName, err)
+	}
+	return f, nil
+}
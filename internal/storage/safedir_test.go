@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// hostileNames - имена, которые не должны ни пройти ValidName, ни открыть файл
+var hostileNames = []string{
+	"",
+	".",
+	"..",
+	"../x",
+	"../secret.pdf",
+	"../../etc/passwd",
+	"..\\x",
+	"a/../../secret.pdf",
+	"sub/file.pdf",
+	"sub\\file.pdf",
+	"/etc/passwd",
+	"/abs.pdf",
+	"\\abs.pdf",
+	"C:\\secret.pdf",
+	"C:secret.pdf",
+	"%2e%2e%2fsecret.pdf",
+	"..%2fsecret.pdf",
+	"%2e%2e",
+	"file%00.pdf",
+	"file.pdf\x00",
+	"file\x00.pdf",
+	"\x00",
+	".bak",
+	".lock",
+	".hidden.pdf",
+	".users.json.tmp-123456",
+	".tmp-1",
+	"file .pdf",
+	"file\n.pdf",
+	"file\t.pdf",
+	"файл.pdf",
+	"file\u2215x.pdf", // division slash
+	"file\uff0fx.pdf", // fullwidth solidus
+	"file:stream.pdf",
+	"file*.pdf",
+	"file?.pdf",
+	"~/file.pdf",
+	strings.Repeat("a", maxNameLength+1),
+	strings.Repeat("a", maxNameLength-3) + ".pdf",
+}
+
+func TestValidName(t *testing.T) {
+	for _, name := range hostileNames {
+		if ValidName(name) {
+			t.Errorf("ValidName(%q) = true, want false", name)
+		}
+	}
+
+	for _, name := range []string{
+		"lesson.pdf",
+		"Lesson_01-final.pdf",
+		"a",
+		"a..b.pdf",
+		"file.",
+		"users.json.bak",
+		strings.Repeat("a", maxNameLength),
+	} {
+		if !ValidName(name) {
+			t.Errorf("ValidName(%q) = false, want true", name)
+		}
+	}
+}
+
+// safeDirFixture создаёт root/files с файлами и ссылками и файл root/secret.pdf вне каталога
+func safeDirFixture(t *testing.T) SafeDir {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "files")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(root, "secret.pdf"), "outside")
+	write(filepath.Join(dir, "lesson.pdf"), "lesson")
+	write(filepath.Join(dir, ".lock"), "")
+	write(filepath.Join(dir, ".bak"), "backup")
+	write(filepath.Join(dir, ".lesson.pdf.tmp-42"), "partial")
+	write(filepath.Join(dir, "subdir", "nested.pdf"), "nested")
+
+	links := map[string]string{
+		"inside.pdf":    "lesson.pdf",
+		"outside.pdf":   "../secret.pdf",
+		"absolute.pdf":  filepath.Join(root, "secret.pdf"),
+		"dangling.pdf":  "missing.pdf",
+		"dirlink":       "subdir",
+		"parentdir.pdf": "..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+	return SafeDir(dir)
+}
+
+func TestSafeDirOpen(t *testing.T) {
+	dir := safeDirFixture(t)
+
+	f, err := dir.Open("lesson.pdf")
+	if err != nil {
+		t.Fatalf("Open(lesson.pdf) = %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "lesson" {
+		t.Errorf("Open(lesson.pdf) read %q", data)
+	}
+
+	rejected := append(slices.Clone(hostileNames),
+		"missing.pdf",
+		"subdir",
+		"inside.pdf",
+		"outside.pdf",
+		"absolute.pdf",
+		"dangling.pdf",
+		"dirlink",
+		"parentdir.pdf",
+	)
+	for _, name := range rejected {
+		f, err := dir.Open(name)
+		if err == nil {
+			f.Close()
+			t.Errorf("Open(%q) succeeded, want an error", name)
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want an error matching fs.ErrNotExist", name, err)
+		}
+	}
+}
+
+func TestSafeDirMissingRoot(t *testing.T) {
+	dir := SafeDir(filepath.Join(t.TempDir(), "missing"))
+	if _, err := dir.Open("lesson.pdf"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open in a missing directory = %v, want fs.ErrNotExist", err)
+	}
+}
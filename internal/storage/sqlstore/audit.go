@@ -0,0 +1,67 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"myapp/internal/models"
+)
+
+const auditColumns = `id, at, actor_id, actor_login, action, target_id, target_login, filial, changes, detail, remote_addr`
+
+type auditLogRepository struct {
+	db *sql.DB
+}
+
+func (r *auditLogRepository) Append(events ...models.AuditEvent) error {
+	if len(events) == 1 {
+		return insertAuditEvent(r.db, events[0])
+	}
+	return withTx(r.db, func(tx *sql.Tx) error {
+		for _, e := range events {
+			if err := insertAuditEvent(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *auditLogRepository) List() ([]models.AuditEvent, error) {
+	rows, err := r.db.Query(`SELECT ` + auditColumns + ` FROM audit_log ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var e models.AuditEvent
+		var changes string
+		if err := rows.Scan(&e.ID, &e.At, &e.ActorID, &e.ActorLogin, &e.Action, &e.TargetID,
+			&e.TargetLogin, &e.Filial, &changes, &e.Detail, &e.RemoteAddr); err != nil {
+			return nil, err
+		}
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func insertAuditEvent(db execer, e models.AuditEvent) error {
+	var changes []byte
+	if len(e.Changes) > 0 {
+		var err error
+		if changes, err = json.Marshal(e.Changes); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`INSERT INTO audit_log (`+auditColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.At, e.ActorID, e.ActorLogin, e.Action, e.TargetID, e.TargetLogin, e.Filial,
+		string(changes), e.Detail, e.RemoteAddr)
+	return err
+}
@@ -0,0 +1,139 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+)
+
+type userDataRepository struct {
+	db *sql.DB
+}
+
+func (r *userDataRepository) List(kind storage.DataKind) ([]models.UserData, error) {
+	rows, err := r.db.Query(`SELECT id, links, modules FROM user_data WHERE kind = ? ORDER BY rowid`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.UserData
+	for rows.Next() {
+		var (
+			data           models.UserData
+			links, modules string
+		)
+		if err := rows.Scan(&data.ID, &links, &modules); err != nil {
+			return nil, err
+		}
+		if err := decodeUserData(&data, links, modules); err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, rows.Err()
+}
+
+func (r *userDataRepository) SaveAll(kind storage.DataKind, data []models.UserData) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM user_data WHERE kind = ?`, kind); err != nil {
+			return err
+		}
+		for _, d := range data {
+			links, modules, err := encodeUserData(d)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO user_data (kind, id, links, modules) VALUES (?, ?, ?, ?)`,
+				kind, d.ID, links, modules)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// encodeUserData сериализует вложенные списки профиля в JSON-колонки
+func encodeUserData(d models.UserData) (string, string, error) {
+	if d.Links == nil {
+		d.Links = []models.Link{}
+	}
+	if d.Modules == nil {
+		d.Modules = []models.ModuleInfo{}
+	}
+	links, err := json.Marshal(d.Links)
+	if err != nil {
+		return "", "", err
+	}
+	modules, err := json.Marshal(d.Modules)
+	if err != nil {
+		return "", "", err
+	}
+	return string(links), string(modules), nil
+}
+
+func (r *userDataRepository) Get(role models.UserRole, userID string) (models.UserData, error) {
+	kind, err := storage.KindForRole(role)
+	if err != nil {
+		return models.UserData{}, err
+	}
+
+	var (
+		data           = models.UserData{ID: userID}
+		links, modules string
+	)
+	err = r.db.QueryRow(`SELECT links, modules FROM user_data WHERE kind = ? AND id = ?`, kind, userID).
+		Scan(&links, &modules)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserData{}, os.ErrNotExist
+	}
+	if err != nil {
+		return models.UserData{}, err
+	}
+	if err := decodeUserData(&data, links, modules); err != nil {
+		return models.UserData{}, err
+	}
+	return data, nil
+}
+
+func (r *userDataRepository) Upsert(role models.UserRole, data models.UserData) error {
+	kind, err := storage.KindForRole(role)
+	if err != nil {
+		return err
+	}
+
+	links, modules, err := encodeUserData(data)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`INSERT INTO user_data (kind, id, links, modules) VALUES (?, ?, ?, ?)
+		ON CONFLICT (kind, id) DO UPDATE SET links = excluded.links, modules = excluded.modules`,
+		kind, data.ID, links, modules)
+	return err
+}
+
+func (r *userDataRepository) Delete(role models.UserRole, userID string) error {
+	kind, err := storage.KindForRole(role)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`DELETE FROM user_data WHERE kind = ? AND id = ?`, kind, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// decodeUserData разбирает JSON-колонки профиля
+func decodeUserData(data *models.UserData, links, modules string) error {
+	if err := json.Unmarshal([]byte(links), &data.Links); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(modules), &data.Modules)
+}
@@ -0,0 +1,56 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"myapp/internal/models"
+)
+
+const downloadColumns = `id, at, user_id, user_login, file_name, module, via, remote_addr`
+
+type downloadRepository struct {
+	db *sql.DB
+}
+
+func (r *downloadRepository) Append(d models.Download) error {
+	return insertDownload(r.db, d)
+}
+
+func (r *downloadRepository) List() ([]models.Download, error) {
+	rows, err := r.db.Query(`SELECT ` + downloadColumns + ` FROM downloads ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var downloads []models.Download
+	for rows.Next() {
+		var d models.Download
+		if err := rows.Scan(&d.ID, &d.At, &d.UserID, &d.UserLogin, &d.FileName,
+			&d.Module, &d.Via, &d.RemoteAddr); err != nil {
+			return nil, err
+		}
+		downloads = append(downloads, d)
+	}
+	return downloads, rows.Err()
+}
+
+func (r *downloadRepository) SaveAll(downloads []models.Download) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM downloads`); err != nil {
+			return err
+		}
+		for _, d := range downloads {
+			if err := insertDownload(tx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertDownload(db execer, d models.Download) error {
+	_, err := db.Exec(`INSERT INTO downloads (`+downloadColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.At, d.UserID, d.UserLogin, d.FileName, d.Module, d.Via, d.RemoteAddr)
+	return err
+}
@@ -0,0 +1,104 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+)
+
+const enrollmentColumns = `id, student_id, module, tutor_id, status, enrolled_at, enrolled_by, progress`
+
+type enrollmentRepository struct {
+	db *sql.DB
+}
+
+func scanEnrollment(row rowScanner) (models.Enrollment, error) {
+	var (
+		e        models.Enrollment
+		progress string
+	)
+	err := row.Scan(&e.ID, &e.StudentID, &e.Module, &e.TutorID, &e.Status, &e.EnrolledAt, &e.EnrolledBy, &progress)
+	if err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal([]byte(progress), &e.Progress)
+}
+
+func (r *enrollmentRepository) List() ([]models.Enrollment, error) {
+	rows, err := r.db.Query(`SELECT ` + enrollmentColumns + ` FROM enrollments ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Enrollment
+	for rows.Next() {
+		e, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+func (r *enrollmentRepository) Get(id string) (models.Enrollment, error) {
+	e, err := scanEnrollment(r.db.QueryRow(`SELECT `+enrollmentColumns+` FROM enrollments WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Enrollment{}, os.ErrNotExist
+	}
+	return e, err
+}
+
+func (r *enrollmentRepository) Create(e models.Enrollment) error {
+	return insertEnrollment(r.db, e)
+}
+
+func (r *enrollmentRepository) Update(e models.Enrollment) error {
+	progress, err := encodeProgress(e.Progress)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE enrollments SET student_id = ?, module = ?, tutor_id = ?, status = ?,
+		enrolled_at = ?, enrolled_by = ?, progress = ? WHERE id = ?`,
+		e.StudentID, e.Module, e.TutorID, e.Status, e.EnrolledAt, e.EnrolledBy, progress, e.ID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *enrollmentRepository) SaveAll(enrollments []models.Enrollment) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM enrollments`); err != nil {
+			return err
+		}
+		for _, e := range enrollments {
+			if err := insertEnrollment(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertEnrollment(db execer, e models.Enrollment) error {
+	progress, err := encodeProgress(e.Progress)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO enrollments (`+enrollmentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.StudentID, e.Module, e.TutorID, e.Status, e.EnrolledAt, e.EnrolledBy, progress)
+	return err
+}
+
+func encodeProgress(progress []models.LessonProgress) (string, error) {
+	if progress == nil {
+		progress = []models.LessonProgress{}
+	}
+	data, err := json.Marshal(progress)
+	return string(data), err
+}
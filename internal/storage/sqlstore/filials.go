@@ -0,0 +1,88 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+)
+
+const filialColumns = `id, name, address, timezone, active`
+
+type filialRepository struct {
+	db *sql.DB
+}
+
+func scanFilial(row rowScanner) (models.Filial, error) {
+	var f models.Filial
+	err := row.Scan(&f.ID, &f.Name, &f.Address, &f.Timezone, &f.Active)
+	return f, err
+}
+
+func (r *filialRepository) List() ([]models.Filial, error) {
+	rows, err := r.db.Query(`SELECT ` + filialColumns + ` FROM filials ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Filial
+	for rows.Next() {
+		f, err := scanFilial(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
+func (r *filialRepository) Get(id string) (models.Filial, error) {
+	f, err := scanFilial(r.db.QueryRow(`SELECT `+filialColumns+` FROM filials WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Filial{}, os.ErrNotExist
+	}
+	return f, err
+}
+
+func (r *filialRepository) Create(f models.Filial) error {
+	return insertFilial(r.db, f)
+}
+
+func (r *filialRepository) Update(f models.Filial) error {
+	res, err := r.db.Exec(`UPDATE filials SET name = ?, address = ?, timezone = ?, active = ? WHERE id = ?`,
+		f.Name, f.Address, f.Timezone, f.Active, f.ID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *filialRepository) Delete(id string) error {
+	res, err := r.db.Exec(`DELETE FROM filials WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *filialRepository) SaveAll(filials []models.Filial) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM filials`); err != nil {
+			return err
+		}
+		for _, f := range filials {
+			if err := insertFilial(tx, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertFilial(db execer, f models.Filial) error {
+	_, err := db.Exec(`INSERT INTO filials (`+filialColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		f.ID, f.Name, f.Address, f.Timezone, f.Active)
+	return err
+}
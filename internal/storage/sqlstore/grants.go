@@ -0,0 +1,60 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"myapp/internal/models"
+)
+
+const grantColumns = `id, at, actor_id, actor_login, tutor_id, module, action, until, prev_until`
+
+type grantAuditRepository struct {
+	db *sql.DB
+}
+
+func (r *grantAuditRepository) Append(event models.GrantEvent) error {
+	return insertGrantEvent(r.db, event)
+}
+
+func (r *grantAuditRepository) List() ([]models.GrantEvent, error) {
+	rows, err := r.db.Query(`SELECT ` + grantColumns + ` FROM grant_audit ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.GrantEvent
+	for rows.Next() {
+		var e models.GrantEvent
+		if err := rows.Scan(&e.ID, &e.At, &e.ActorID, &e.ActorLogin, &e.TutorID,
+			&e.Module, &e.Action, &e.Until, &e.PrevUntil); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (r *grantAuditRepository) SaveAll(events []models.GrantEvent) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM grant_audit`); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := insertGrantEvent(tx, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertGrantEvent(db execer, e models.GrantEvent) error {
+	_, err := db.Exec(`INSERT INTO grant_audit (`+grantColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.At, e.ActorID, e.ActorLogin, e.TutorID, e.Module, e.Action, e.Until, e.PrevUntil)
+	return err
+}
@@ -0,0 +1,172 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+)
+
+const groupColumns = `id, name, filial, module, tutor_id, students, schedule, starts_on, ends_on, archived`
+
+type groupRepository struct {
+	db *sql.DB
+}
+
+func scanGroup(row rowScanner) (models.Group, error) {
+	var (
+		g                  models.Group
+		students, schedule string
+	)
+	err := row.Scan(&g.ID, &g.Name, &g.Filial, &g.Module, &g.TutorID, &students, &schedule, &g.StartsOn, &g.EndsOn, &g.Archived)
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal([]byte(students), &g.StudentIDs); err != nil {
+		return g, err
+	}
+	return g, json.Unmarshal([]byte(schedule), &g.Schedule)
+}
+
+func (r *groupRepository) List() ([]models.Group, error) {
+	rows, err := r.db.Query(`SELECT ` + groupColumns + ` FROM study_groups ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, g)
+	}
+	return result, rows.Err()
+}
+
+func (r *groupRepository) Get(id string) (models.Group, error) {
+	g, err := scanGroup(r.db.QueryRow(`SELECT `+groupColumns+` FROM study_groups WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Group{}, os.ErrNotExist
+	}
+	return g, err
+}
+
+func (r *groupRepository) Create(g models.Group) error {
+	return insertGroup(r.db, g)
+}
+
+func (r *groupRepository) Update(g models.Group) error {
+	students, schedule, err := encodeGroup(g)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.Exec(`UPDATE study_groups SET name = ?, filial = ?, module = ?, tutor_id = ?, students = ?,
+		schedule = ?, starts_on = ?, ends_on = ?, archived = ? WHERE id = ?`,
+		g.Name, g.Filial, g.Module, g.TutorID, students, schedule, g.StartsOn, g.EndsOn, g.Archived, g.ID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *groupRepository) SaveAll(groups []models.Group) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM study_groups`); err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if err := insertGroup(tx, g); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertGroup(db execer, g models.Group) error {
+	students, schedule, err := encodeGroup(g)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO study_groups (`+groupColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.ID, g.Name, g.Filial, g.Module, g.TutorID, students, schedule, g.StartsOn, g.EndsOn, g.Archived)
+	return err
+}
+
+func encodeGroup(g models.Group) (students, schedule string, err error) {
+	if g.StudentIDs == nil {
+		g.StudentIDs = []string{}
+	}
+	if g.Schedule == nil {
+		g.Schedule = []models.ScheduleSlot{}
+	}
+	s, err := json.Marshal(g.StudentIDs)
+	if err != nil {
+		return "", "", err
+	}
+	c, err := json.Marshal(g.Schedule)
+	if err != nil {
+		return "", "", err
+	}
+	return string(s), string(c), nil
+}
+
+const attendanceColumns = `group_id, class_date, class_time, student_id, status, marked_by, marked_at`
+
+type attendanceRepository struct {
+	db *sql.DB
+}
+
+func (r *attendanceRepository) List() ([]models.Attendance, error) {
+	rows, err := r.db.Query(`SELECT ` + attendanceColumns + ` FROM attendance ORDER BY class_date, class_time, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Attendance
+	for rows.Next() {
+		var a models.Attendance
+		if err := rows.Scan(&a.GroupID, &a.Date, &a.Start, &a.StudentID, &a.Status, &a.MarkedBy, &a.MarkedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+func (r *attendanceRepository) Mark(records []models.Attendance) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		for _, a := range records {
+			_, err := tx.Exec(`INSERT INTO attendance (`+attendanceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (group_id, class_date, class_time, student_id)
+				DO UPDATE SET status = excluded.status, marked_by = excluded.marked_by, marked_at = excluded.marked_at`,
+				a.GroupID, a.Date, a.Start, a.StudentID, a.Status, a.MarkedBy, a.MarkedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *attendanceRepository) SaveAll(records []models.Attendance) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM attendance`); err != nil {
+			return err
+		}
+		for _, a := range records {
+			_, err := tx.Exec(`INSERT INTO attendance (`+attendanceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				a.GroupID, a.Date, a.Start, a.StudentID, a.Status, a.MarkedBy, a.MarkedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,223 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+)
+
+const moduleColumns = `id, name, description_min, description_max, total_classes, total_duration, link_to_folder, archived, version`
+
+type moduleRepository struct {
+	db *sql.DB
+}
+
+func scanModule(row rowScanner) (models.Module, error) {
+	var m models.Module
+	err := row.Scan(&m.ID, &m.Name, &m.DescriptionMin, &m.DescriptionMax,
+		&m.TotalClasses, &m.TotalDuration, &m.LinkToFolder, &m.Archived, &m.Version)
+	return m, err
+}
+
+func (r *moduleRepository) List() ([]models.Module, error) {
+	return listModules(r.db)
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func listModules(q queryer) ([]models.Module, error) {
+	rows, err := q.Query(`SELECT ` + moduleColumns + ` FROM modules ORDER BY position, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modules []models.Module
+	for rows.Next() {
+		m, err := scanModule(rows)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, rows.Err()
+}
+
+func (r *moduleRepository) Get(id int) (models.Module, error) {
+	m, err := scanModule(r.db.QueryRow(`SELECT `+moduleColumns+` FROM modules WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Module{}, os.ErrNotExist
+	}
+	return m, err
+}
+
+func (r *moduleRepository) Create(module models.Module) (models.Module, error) {
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		var position int
+		err := tx.QueryRow(`SELECT COALESCE(MAX(id), 0) + 1, COALESCE(MAX(position), -1) + 1 FROM modules`).
+			Scan(&module.ID, &position)
+		if err != nil {
+			return err
+		}
+		module.Version = 1
+		return insertModule(tx, module, position)
+	})
+	if err != nil {
+		return models.Module{}, err
+	}
+	return module, nil
+}
+
+func (r *moduleRepository) Update(module models.Module) (models.Module, error) {
+	err := withTx(r.db, func(tx *sql.Tx) error {
+		var version int
+		err := tx.QueryRow(`SELECT version FROM modules WHERE id = ?`, module.ID).Scan(&version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return os.ErrNotExist
+		}
+		if err != nil {
+			return err
+		}
+		if version != module.Version {
+			return storage.ErrVersionConflict
+		}
+
+		module.Version++
+		_, err = tx.Exec(`UPDATE modules SET name = ?, description_min = ?, description_max = ?, total_classes = ?,
+			total_duration = ?, link_to_folder = ?, archived = ?, version = ? WHERE id = ?`,
+			module.Name, module.DescriptionMin, module.DescriptionMax, module.TotalClasses,
+			module.TotalDuration, module.LinkToFolder, module.Archived, module.Version, module.ID)
+		return err
+	})
+	if err != nil {
+		return models.Module{}, err
+	}
+	return module, nil
+}
+
+func (r *moduleRepository) Reorder(ids []int) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		modules, err := listModules(tx)
+		if err != nil {
+			return err
+		}
+		if _, err := storage.ReorderModules(modules, ids); err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if _, err := tx.Exec(`UPDATE modules SET position = ? WHERE id = ?`, i, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *moduleRepository) SaveAll(modules []models.Module) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM modules`); err != nil {
+			return err
+		}
+		for i, m := range modules {
+			if m.Version == 0 {
+				m.Version = 1
+			}
+			if err := insertModule(tx, m, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertModule(tx *sql.Tx, m models.Module, position int) error {
+	_, err := tx.Exec(`INSERT INTO modules (position, `+moduleColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		position, m.ID, m.Name, m.DescriptionMin, m.DescriptionMax, m.TotalClasses, m.TotalDuration,
+		m.LinkToFolder, m.Archived, m.Version)
+	return err
+}
+
+type moduleFileRepository struct {
+	db *sql.DB
+}
+
+func (r *moduleFileRepository) List() ([]models.FileGroup, error) {
+	rows, err := r.db.Query(`SELECT module_id, title, file_name FROM module_files ORDER BY module_id, position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.FileGroup
+	for rows.Next() {
+		var (
+			moduleID int
+			item     models.FileItem
+		)
+		if err := rows.Scan(&moduleID, &item.Title, &item.FileName); err != nil {
+			return nil, err
+		}
+		if n := len(groups); n == 0 || groups[n-1].ID != moduleID {
+			groups = append(groups, models.FileGroup{ID: moduleID})
+		}
+		groups[len(groups)-1].Files = append(groups[len(groups)-1].Files, item)
+	}
+	return groups, rows.Err()
+}
+
+func (r *moduleFileRepository) GetByModule(moduleID int) ([]models.FileItem, error) {
+	rows, err := r.db.Query(`SELECT title, file_name FROM module_files WHERE module_id = ? ORDER BY position`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.FileItem
+	for rows.Next() {
+		var item models.FileItem
+		if err := rows.Scan(&item.Title, &item.FileName); err != nil {
+			return nil, err
+		}
+		files = append(files, item)
+	}
+	return files, rows.Err()
+}
+
+func (r *moduleFileRepository) SetModuleFiles(moduleID int, files []models.FileItem) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM module_files WHERE module_id = ?`, moduleID); err != nil {
+			return err
+		}
+		return insertModuleFiles(tx, moduleID, files)
+	})
+}
+
+func (r *moduleFileRepository) SaveAll(groups []models.FileGroup) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM module_files`); err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if err := insertModuleFiles(tx, group.ID, group.Files); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertModuleFiles(tx *sql.Tx, moduleID int, files []models.FileItem) error {
+	for i, f := range files {
+		_, err := tx.Exec(`INSERT INTO module_files (module_id, position, title, file_name) VALUES (?, ?, ?, ?)`,
+			moduleID, i, f.Title, f.FileName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
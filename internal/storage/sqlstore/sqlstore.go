@@ -0,0 +1,263 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"myapp/internal/storage"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations - схема базы по версиям; новые изменения только добавляются в конец
+var migrations = []string{
+	// 1: исходная схема
+	`CREATE TABLE users (
+		id       TEXT PRIMARY KEY,
+		login    TEXT NOT NULL UNIQUE,
+		password TEXT NOT NULL,
+		name     TEXT NOT NULL,
+		filial   TEXT NOT NULL,
+		role     TEXT NOT NULL,
+		status   TEXT NOT NULL
+	);
+	CREATE TABLE user_data (
+		kind    TEXT NOT NULL,
+		id      INTEGER NOT NULL,
+		links   TEXT NOT NULL DEFAULT '[]',
+		modules TEXT NOT NULL DEFAULT '[]',
+		PRIMARY KEY (kind, id)
+	);
+	CREATE TABLE modules (
+		id              INTEGER PRIMARY KEY,
+		position        INTEGER NOT NULL,
+		name            TEXT NOT NULL,
+		description_min TEXT NOT NULL,
+		description_max TEXT NOT NULL,
+		total_classes   INTEGER NOT NULL,
+		total_duration  TEXT NOT NULL,
+		link_to_folder  TEXT NOT NULL
+	);
+	CREATE TABLE module_files (
+		module_id INTEGER NOT NULL,
+		position  INTEGER NOT NULL,
+		title     TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		PRIMARY KEY (module_id, position)
+	);`,
+	// 2: ID профиля совпадает со строковым ID пользователя
+	`CREATE TABLE user_data_v2 (
+		kind    TEXT NOT NULL,
+		id      TEXT NOT NULL,
+		links   TEXT NOT NULL DEFAULT '[]',
+		modules TEXT NOT NULL DEFAULT '[]',
+		PRIMARY KEY (kind, id)
+	);
+	INSERT INTO user_data_v2 (kind, id, links, modules)
+		SELECT kind, CAST(id AS TEXT), links, modules FROM user_data ORDER BY rowid;
+	DROP TABLE user_data;
+	ALTER TABLE user_data_v2 RENAME TO user_data;`,
+	// 3: архивирование и версия модулей
+	`ALTER TABLE modules ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE modules ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+	// 4: журнал выдачи доступа к модулям
+	`CREATE TABLE grant_audit (
+		id          TEXT PRIMARY KEY,
+		at          INTEGER NOT NULL,
+		actor_id    TEXT NOT NULL,
+		actor_login TEXT NOT NULL,
+		tutor_id    TEXT NOT NULL,
+		module      INTEGER NOT NULL,
+		action      TEXT NOT NULL,
+		until       INTEGER NOT NULL,
+		prev_until  INTEGER NOT NULL
+	);
+	CREATE INDEX grant_audit_tutor ON grant_audit (tutor_id);`,
+	// 5: записи учеников на модули; прогресс по урокам хранится как JSON
+	`CREATE TABLE enrollments (
+		id          TEXT PRIMARY KEY,
+		student_id  TEXT NOT NULL,
+		module      INTEGER NOT NULL,
+		tutor_id    TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		enrolled_at INTEGER NOT NULL,
+		enrolled_by TEXT NOT NULL,
+		progress    TEXT NOT NULL DEFAULT '[]'
+	);
+	CREATE INDEX enrollments_student ON enrollments (student_id);`,
+	// 6: учебные группы и посещаемость
+	`CREATE TABLE study_groups (
+		id        TEXT PRIMARY KEY,
+		name      TEXT NOT NULL,
+		filial    TEXT NOT NULL,
+		module    INTEGER NOT NULL,
+		tutor_id  TEXT NOT NULL,
+		students  TEXT NOT NULL DEFAULT '[]',
+		schedule  TEXT NOT NULL DEFAULT '[]',
+		starts_on TEXT NOT NULL,
+		ends_on   TEXT NOT NULL,
+		archived  INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE attendance (
+		group_id   TEXT NOT NULL,
+		class_date TEXT NOT NULL,
+		class_time TEXT NOT NULL,
+		student_id TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		marked_by  TEXT NOT NULL,
+		marked_at  INTEGER NOT NULL,
+		PRIMARY KEY (group_id, class_date, class_time, student_id)
+	);
+	CREATE INDEX attendance_student ON attendance (student_id);`,
+	// 7: справочник филиалов
+	`CREATE TABLE filials (
+		id       TEXT PRIMARY KEY,
+		name     TEXT NOT NULL,
+		address  TEXT NOT NULL DEFAULT '',
+		timezone TEXT NOT NULL DEFAULT '',
+		active   INTEGER NOT NULL DEFAULT 1
+	);`,
+	// 8: журнал скачиваний файлов уроков
+	`CREATE TABLE downloads (
+		id          TEXT PRIMARY KEY,
+		at          INTEGER NOT NULL,
+		user_id     TEXT NOT NULL,
+		user_login  TEXT NOT NULL,
+		file_name   TEXT NOT NULL,
+		module      INTEGER NOT NULL,
+		via         TEXT NOT NULL,
+		remote_addr TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX downloads_user ON downloads (user_id);`,
+	// 9: журнал аудита; изменения полей хранятся в JSON
+	`CREATE TABLE audit_log (
+		id           TEXT PRIMARY KEY,
+		at           INTEGER NOT NULL,
+		actor_id     TEXT NOT NULL DEFAULT '',
+		actor_login  TEXT NOT NULL DEFAULT '',
+		action       TEXT NOT NULL,
+		target_id    TEXT NOT NULL DEFAULT '',
+		target_login TEXT NOT NULL DEFAULT '',
+		filial       TEXT NOT NULL DEFAULT '',
+		changes      TEXT NOT NULL DEFAULT '',
+		detail       TEXT NOT NULL DEFAULT '',
+		remote_addr  TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX audit_log_target ON audit_log (target_id);
+	CREATE INDEX audit_log_actor ON audit_log (actor_id);`,
+	// 10: принудительная смена пароля и срок кода сброса
+	`ALTER TABLE users ADD COLUMN must_change_password INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN reset_expires_at INTEGER NOT NULL DEFAULT 0;`,
+	// 11: двухфакторная аутентификация; коды восстановления хранятся как JSON
+	`CREATE TABLE two_factor (
+		user_id        TEXT PRIMARY KEY,
+		secret         TEXT NOT NULL,
+		enabled        INTEGER NOT NULL DEFAULT 0,
+		enabled_at     INTEGER NOT NULL DEFAULT 0,
+		recovery_codes TEXT NOT NULL DEFAULT '[]',
+		last_step      INTEGER NOT NULL DEFAULT 0
+	);`,
+}
+
+// Backend хранит данные во встроенной базе SQLite
+type Backend struct {
+	db          *sql.DB
+	users       *userRepository
+	userData    *userDataRepository
+	modules     *moduleRepository
+	moduleFiles *moduleFileRepository
+	grantAudit  *grantAuditRepository
+	enrollments *enrollmentRepository
+	groups      *groupRepository
+	attendance  *attendanceRepository
+	filials     *filialRepository
+	downloads   *downloadRepository
+	auditLog    *auditLogRepository
+	twoFactor   *twoFactorRepository
+}
+
+// Open открывает (или создает) базу по пути path и применяет миграции
+func Open(path string) (*Backend, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает одного писателя; одно соединение исключает SQLITE_BUSY внутри процесса
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+
+	return &Backend{
+		db:          db,
+		users:       &userRepository{db: db},
+		userData:    &userDataRepository{db: db},
+		modules:     &moduleRepository{db: db},
+		moduleFiles: &moduleFileRepository{db: db},
+		grantAudit:  &grantAuditRepository{db: db},
+		enrollments: &enrollmentRepository{db: db},
+		groups:      &groupRepository{db: db},
+		attendance:  &attendanceRepository{db: db},
+		filials:     &filialRepository{db: db},
+		downloads:   &downloadRepository{db: db},
+		auditLog:    &auditLogRepository{db: db},
+		twoFactor:   &twoFactorRepository{db: db},
+	}, nil
+}
+
+func (b *Backend) Users() storage.UserRepository             { return b.users }
+func (b *Backend) UserData() storage.UserDataRepository      { return b.userData }
+func (b *Backend) Modules() storage.ModuleRepository         { return b.modules }
+func (b *Backend) ModuleFiles() storage.ModuleFileRepository { return b.moduleFiles }
+func (b *Backend) GrantAudit() storage.GrantAuditRepository  { return b.grantAudit }
+func (b *Backend) Enrollments() storage.EnrollmentRepository { return b.enrollments }
+func (b *Backend) Groups() storage.GroupRepository           { return b.groups }
+func (b *Backend) Attendance() storage.AttendanceRepository  { return b.attendance }
+func (b *Backend) Filials() storage.FilialRepository         { return b.filials }
+func (b *Backend) Downloads() storage.DownloadLogRepository  { return b.downloads }
+func (b *Backend) AuditLog() storage.AuditLogRepository      { return b.auditLog }
+func (b *Backend) TwoFactor() storage.TwoFactorRepository    { return b.twoFactor }
+func (b *Backend) Close() error                              { return b.db.Close() }
+
+// migrate применяет к базе все ещё не применённые миграции
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		err := withTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// withTx выполняет fn в транзакции
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,104 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"myapp/internal/models"
+	"myapp/internal/storage"
+)
+
+// TestMigrateV1 открывает базу с исходной схемой и данными: миграция 2 должна
+// перевести числовые ID профилей в строки, а остальные - дополнить схему
+func TestMigrateV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`,
+		migrations[0],
+		`INSERT INTO schema_migrations (version) VALUES (1)`,
+		`INSERT INTO users (id, login, password, name, filial, role, status)
+			VALUES ('1752565715430', 'tutor', 'hash', 'Tutor', '3', 'tutor', 'active')`,
+		`INSERT INTO user_data (kind, id, links, modules) VALUES
+			('tutor', 1752565715430, '[{"url":"https://example.com","type":"site"}]', '[{"module":5,"date":253370764800000}]'),
+			('user', 1752563796386, '[]', '[]')`,
+		`INSERT INTO modules (id, position, name, description_min, description_max, total_classes, total_duration, link_to_folder)
+			VALUES (5, 0, 'CodeMonkey', 'min', 'max', 8, '8h', 'https://example.com/folder')`,
+		`INSERT INTO module_files (module_id, position, title, file_name) VALUES (5, 0, 'Урок 1', 'lesson1')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("prepare v1 database: %v", err)
+		}
+	}
+	db.Close()
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open v1 database = %v", err)
+	}
+	defer b.Close()
+
+	var version int
+	if err := b.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || version != len(migrations) {
+		t.Errorf("schema version = %d, %v; want %d", version, err, len(migrations))
+	}
+
+	var idType string
+	if err := b.db.QueryRow(`SELECT typeof(id) FROM user_data WHERE kind = 'tutor'`).Scan(&idType); err != nil || idType != "text" {
+		t.Errorf("user_data.id is stored as %q, %v; want text", idType, err)
+	}
+	data, err := b.UserData().Get(models.RoleTutor, "1752565715430")
+	want := models.UserData{
+		ID:      "1752565715430",
+		Links:   []models.Link{{URL: "https://example.com", Type: "site"}},
+		Modules: []models.ModuleInfo{{Module: 5, Date: 253370764800000}},
+	}
+	if err != nil || !reflect.DeepEqual(data, want) {
+		t.Errorf("tutor data after migration = %+v, %v; want %+v", data, err, want)
+	}
+	if _, err := b.UserData().Get(models.RoleUser, "1752563796386"); err != nil {
+		t.Errorf("student data after migration = %v", err)
+	}
+
+	m, err := b.Modules().Get(5)
+	if err != nil || m.Version != 1 || m.Archived || m.Name != "CodeMonkey" {
+		t.Errorf("module after migration = %+v, %v; want version 1, not archived", m, err)
+	}
+	if files, err := b.ModuleFiles().GetByModule(5); err != nil || len(files) != 1 || files[0].FileName != "lesson1" {
+		t.Errorf("module files after migration = %+v, %v", files, err)
+	}
+
+	u, err := b.Users().GetUserByID("1752565715430")
+	if err != nil || u.MustChangePassword || u.ResetExpiresAt != 0 {
+		t.Errorf("user after migration = %+v, %v", u, err)
+	}
+
+	// Таблицы из следующих миграций созданы и пусты
+	for name, list := range map[string]func() (int, error){
+		"enrollments": func() (int, error) { l, err := b.Enrollments().List(); return len(l), err },
+		"groups":      func() (int, error) { l, err := b.Groups().List(); return len(l), err },
+		"filials":     func() (int, error) { l, err := b.Filials().List(); return len(l), err },
+		"audit log":   func() (int, error) { l, err := b.AuditLog().List(); return len(l), err },
+		"two-factor":  func() (int, error) { l, err := b.TwoFactor().List(); return len(l), err },
+	} {
+		if n, err := list(); err != nil || n != 0 {
+			t.Errorf("%s after migration = %d records, %v", name, n, err)
+		}
+	}
+
+	// Повторное открытие не применяет миграции заново
+	b.Close()
+	again, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen = %v", err)
+	}
+	defer again.Close()
+	if list, err := again.UserData().List(storage.DataTutor); err != nil || len(list) != 1 {
+		t.Errorf("tutor data after reopening = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,98 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"myapp/internal/models"
+)
+
+const twoFactorColumns = `user_id, secret, enabled, enabled_at, recovery_codes, last_step`
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+func scanTwoFactor(row rowScanner) (models.TwoFactor, error) {
+	var t models.TwoFactor
+	var codes string
+	if err := row.Scan(&t.UserID, &t.Secret, &t.Enabled, &t.EnabledAt, &codes, &t.LastStep); err != nil {
+		return models.TwoFactor{}, err
+	}
+	if err := json.Unmarshal([]byte(codes), &t.RecoveryCodes); err != nil {
+		return models.TwoFactor{}, err
+	}
+	return t, nil
+}
+
+func (r *twoFactorRepository) Get(userID string) (models.TwoFactor, error) {
+	t, err := scanTwoFactor(r.db.QueryRow(`SELECT `+twoFactorColumns+` FROM two_factor WHERE user_id = ?`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.TwoFactor{}, os.ErrNotExist
+	}
+	return t, err
+}
+
+func (r *twoFactorRepository) Save(t models.TwoFactor) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, t.UserID); err != nil {
+			return err
+		}
+		return insertTwoFactor(tx, t)
+	})
+}
+
+func (r *twoFactorRepository) Delete(userID string) error {
+	res, err := r.db.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *twoFactorRepository) List() ([]models.TwoFactor, error) {
+	rows, err := r.db.Query(`SELECT ` + twoFactorColumns + ` FROM two_factor ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.TwoFactor
+	for rows.Next() {
+		t, err := scanTwoFactor(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func (r *twoFactorRepository) SaveAll(records []models.TwoFactor) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM two_factor`); err != nil {
+			return err
+		}
+		for _, t := range records {
+			if err := insertTwoFactor(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertTwoFactor(db execer, t models.TwoFactor) error {
+	codes, err := json.Marshal(t.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+	if t.RecoveryCodes == nil {
+		codes = []byte("[]")
+	}
+	_, err = db.Exec(`INSERT INTO two_factor (`+twoFactorColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Secret, t.Enabled, t.EnabledAt, string(codes), t.LastStep)
+	return err
+}
@@ -0,0 +1,122 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"myapp/internal/models"
+)
+
+const userColumns = `id, login, password, name, filial, role, status, must_change_password, reset_expires_at`
+
+type userRepository struct {
+	db *sql.DB
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Login, &u.Password, &u.Name, &u.Filial, &u.Role, &u.Status, &u.MustChangePassword, &u.ResetExpiresAt)
+	return u, err
+}
+
+func (r *userRepository) CreateUser(user models.User) error {
+	var exists int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM users WHERE login = ?`, user.Login).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return fmt.Errorf("user with login %s already exists", user.Login)
+	}
+
+	_, err = r.db.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Login, user.Password, user.Name, user.Filial, user.Role, user.Status, user.MustChangePassword, user.ResetExpiresAt)
+	return err
+}
+
+func (r *userRepository) getOne(query string, arg interface{}) (models.User, error) {
+	user, err := scanUser(r.db.QueryRow(query, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, os.ErrNotExist
+	}
+	return user, err
+}
+
+func (r *userRepository) GetUserByID(id string) (models.User, error) {
+	return r.getOne(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (r *userRepository) GetUserByLogin(login string) (models.User, error) {
+	return r.getOne(`SELECT `+userColumns+` FROM users WHERE login = ?`, login)
+}
+
+func (r *userRepository) GetAllUsers() ([]models.User, error) {
+	rows, err := r.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *userRepository) SaveAllUsers(users []models.User) error {
+	return withTx(r.db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM users`); err != nil {
+			return err
+		}
+		for _, user := range users {
+			_, err := tx.Exec(`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				user.ID, user.Login, user.Password, user.Name, user.Filial, user.Role, user.Status, user.MustChangePassword, user.ResetExpiresAt)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", user.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *userRepository) UpdateUser(user models.User) error {
+	res, err := r.db.Exec(`UPDATE users SET login = ?, password = ?, name = ?, filial = ?, role = ?, status = ?,
+		must_change_password = ?, reset_expires_at = ? WHERE id = ?`,
+		user.Login, user.Password, user.Name, user.Filial, user.Role, user.Status,
+		user.MustChangePassword, user.ResetExpiresAt, user.ID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (r *userRepository) DeleteUser(id string) error {
+	res, err := r.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// requireRow возвращает os.ErrNotExist, если запрос не затронул ни одной строки
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+
+	"myapp/internal/models"
+)
+
+// jsonTwoFactor хранит настройки TOTP в two-factor.json.
+// Файл содержит секреты, поэтому доступен только владельцу.
+type jsonTwoFactor struct {
+	filePath string
+	mu       sync.Mutex
+}
+
+type twoFactorFile struct {
+	TwoFactor []models.TwoFactor `json:"twoFactor"`
+}
+
+func (s *jsonTwoFactor) load() ([]models.TwoFactor, error) {
+	var file twoFactorFile
+	if err := readJSONFile(s.filePath, &file); err != nil {
+		return nil, err
+	}
+	return file.TwoFactor, nil
+}
+
+func (s *jsonTwoFactor) save(records []models.TwoFactor) error {
+	if records == nil {
+		records = []models.TwoFactor{}
+	}
+	data, err := json.MarshalIndent(twoFactorFile{TwoFactor: records}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.filePath, data, 0600)
+}
+
+func (s *jsonTwoFactor) Get(userID string) (models.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return models.TwoFactor{}, err
+	}
+	if i := slices.IndexFunc(records, func(t models.TwoFactor) bool { return t.UserID == userID }); i >= 0 {
+		return records[i], nil
+	}
+	return models.TwoFactor{}, os.ErrNotExist
+}
+
+func (s *jsonTwoFactor) Save(record models.TwoFactor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(records, func(t models.TwoFactor) bool { return t.UserID == record.UserID }); i >= 0 {
+		records[i] = record
+	} else {
+		records = append(records, record)
+	}
+	return s.save(records)
+}
+
+func (s *jsonTwoFactor) Delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.load()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(records, func(t models.TwoFactor) bool { return t.UserID == userID })
+	if i < 0 {
+		return os.ErrNotExist
+	}
+	return s.save(slices.Delete(records, i, i+1))
+}
+
+func (s *jsonTwoFactor) List() ([]models.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+func (s *jsonTwoFactor) SaveAll(records []models.TwoFactor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(records)
+}
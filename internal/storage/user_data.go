@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"myapp/internal/models"
+)
+
+// jsonUserData хранит профильные данные в файлах вида <role>-data.json.
+// Каждый файл кэшируется в памяти с индексом по ID и перечитывается,
+// только если изменился на диске.
+type jsonUserData struct {
+	dir   string
+	mu    sync.Mutex
+	files map[DataKind]*userDataCache
+}
+
+type userDataFile struct {
+	Users []models.UserData `json:"users"`
+}
+
+// userDataCache - загруженное содержимое одного файла профильных данных
+type userDataCache struct {
+	path    string
+	modTime time.Time
+	size    int64
+	records []models.UserData
+	index   map[string]int // ID -> позиция в records
+}
+
+func newJSONUserData(dir string) *jsonUserData {
+	return &jsonUserData{dir: dir, files: make(map[DataKind]*userDataCache)}
+}
+
+// cache возвращает актуальный кэш файла вида kind. Вызывается под s.mu.
+func (s *jsonUserData) cache(kind DataKind) (*userDataCache, error) {
+	name, ok := dataFiles[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown data kind %q", kind)
+	}
+
+	c, ok := s.files[kind]
+	if !ok {
+		c = &userDataCache{path: filepath.Join(s.dir, name)}
+		s.files[kind] = c
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// refresh перечитывает файл, если он изменился с последней загрузки
+func (c *userDataCache) refresh() error {
+	info, err := os.Stat(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && c.index != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return nil
+	}
+
+	var file userDataFile
+	if err := readJSONFile(c.path, &file); err != nil {
+		return err
+	}
+
+	c.setRecords(file.Users)
+	if info != nil {
+		c.modTime, c.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+func (c *userDataCache) setRecords(records []models.UserData) {
+	c.records = records
+	c.index = make(map[string]int, len(records))
+	for i, r := range records {
+		c.index[r.ID] = i
+	}
+}
+
+// save записывает records в файл и только после успешной записи заменяет
+// ими кэш и запоминает версию файла
+func (c *userDataCache) save(records []models.UserData) error {
+	if records == nil {
+		records = []models.UserData{}
+	}
+	if err := writeJSONFile(c.path, userDataFile{Users: records}); err != nil {
+		return err
+	}
+	c.setRecords(records)
+	if info, err := os.Stat(c.path); err == nil {
+		c.modTime, c.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// cloneUserData копирует вложенные срезы, чтобы вызывающий не менял кэш
+func cloneUserData(d models.UserData) models.UserData {
+	d.Links = slices.Clone(d.Links)
+	d.Modules = slices.Clone(d.Modules)
+	return d
+}
+
+func (s *jsonUserData) Get(role models.UserRole, userID string) (models.UserData, error) {
+	kind, err := KindForRole(role)
+	if err != nil {
+		return models.UserData{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cache(kind)
+	if err != nil {
+		return models.UserData{}, err
+	}
+	i, ok := c.index[userID]
+	if !ok {
+		return models.UserData{}, os.ErrNotExist
+	}
+	return cloneUserData(c.records[i]), nil
+}
+
+func (s *jsonUserData) Upsert(role models.UserRole, data models.UserData) error {
+	kind, err := KindForRole(role)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cache(kind)
+	if err != nil {
+		return err
+	}
+
+	records := slices.Clone(c.records)
+	if i, ok := c.index[data.ID]; ok {
+		records[i] = cloneUserData(data)
+	} else {
+		records = append(records, cloneUserData(data))
+	}
+	return c.save(records)
+}
+
+func (s *jsonUserData) Delete(role models.UserRole, userID string) error {
+	kind, err := KindForRole(role)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cache(kind)
+	if err != nil {
+		return err
+	}
+	i, ok := c.index[userID]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	return c.save(slices.Delete(slices.Clone(c.records), i, i+1))
+}
+
+func (s *jsonUserData) List(kind DataKind) ([]models.UserData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cache(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.UserData, 0, len(c.records))
+	for _, r := range c.records {
+		result = append(result, cloneUserData(r))
+	}
+	return result, nil
+}
+
+func (s *jsonUserData) SaveAll(kind DataKind, data []models.UserData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.cache(kind)
+	if err != nil {
+		return err
+	}
+
+	records := make([]models.UserData, 0, len(data))
+	for _, d := range data {
+		records = append(records, cloneUserData(d))
+	}
+	return c.save(records)
+}
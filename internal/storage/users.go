@@ -2,16 +2,36 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"myapp/internal/models"
 	"os"
+	"slices"
 	"sync"
+	"time"
 )
 
-// JSONUserStorage реализует UserStorage для хранения в JSON
+// JSONUserStorage реализует UserRepository для хранения в JSON.
+// Файл - единственный источник истины: кэш в памяти перечитывается,
+// если файл изменили снаружи, а наружу отдаются только копии.
 type JSONUserStorage struct {
 	filePath string
 	mu       sync.Mutex
-	users    []models.User // Храним пользователей в slice
+	users    []models.User // Кэш пользователей в памяти
+	modTime  time.Time     // версия файла, из которой загружен кэш
+	size     int64
+}
+
+// NewJSONUserStorage создает хранилище и загружает пользователей из файла
+func NewJSONUserStorage(filePath string) (*JSONUserStorage, error) {
+	storage := &JSONUserStorage{filePath: filePath}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if err := storage.loadUsers(); err != nil {
+		return nil, err
+	}
+	return storage, nil
 }
 
 // Структура для представления JSON файла
@@ -19,59 +39,101 @@ type usersFile struct {
 	Users []models.User `json:"users"`
 }
 
-// Загружает пользователей из файла
+// loadUsers загружает пользователей из файла. Вызывается под s.mu.
 func (s *JSONUserStorage) loadUsers() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	data, err := os.ReadFile(s.filePath)
+	info, err := os.Stat(s.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			s.users = []models.User{} // Инициализируем пустым slice
+			s.modTime, s.size = time.Time{}, 0
 			return nil
 		}
 		return err
 	}
 
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return err
+	}
+
 	var file usersFile
 	if err := json.Unmarshal(data, &file); err != nil {
-		return err
+		return corruptedError(s.filePath, err)
 	}
 
 	s.users = file.Users
+	s.modTime, s.size = info.ModTime(), info.Size()
 	return nil
 }
 
-// Сохраняет пользователей в файл
-func (s *JSONUserStorage) saveUsers() error {
-	data, err := json.MarshalIndent(usersFile{Users: s.users}, "", "  ")
+// refresh перечитывает файл, если он изменился с момента последней загрузки
+// или записи. Битый файл не затирает кэш. Вызывается под s.mu.
+func (s *JSONUserStorage) refresh() {
+	info, err := os.Stat(s.filePath)
 	if err != nil {
+		if os.IsNotExist(err) && !s.modTime.IsZero() {
+			log.Printf("%s was removed, keeping %d cached users", s.filePath, len(s.users))
+		}
+		return
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return
+	}
+
+	if err := s.loadUsers(); err != nil {
+		log.Printf("failed to reload %s, keeping cached users: %v", s.filePath, err)
+		return
+	}
+	log.Printf("reloaded %d users from %s", len(s.users), s.filePath)
+}
+
+// saveUsers записывает users в файл и только после успешной записи заменяет
+// ими кэш: при ошибке кэш остаётся равным файлу. Вызывается под s.mu.
+func (s *JSONUserStorage) saveUsers(users []models.User) error {
+	if users == nil {
+		users = []models.User{}
+	}
+	if err := writeJSONFile(s.filePath, usersFile{Users: users}); err != nil {
 		return err
 	}
+	s.users = users
 
-	return os.WriteFile(s.filePath, data, 0644)
+	// Запоминаем собственную запись, чтобы не перечитывать её как внешнее изменение
+	if info, err := os.Stat(s.filePath); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// indexByID возвращает позицию пользователя в кэше или -1. Вызывается под s.mu.
+func (s *JSONUserStorage) indexByID(id string) int {
+	return slices.IndexFunc(s.users, func(u models.User) bool { return u.ID == id })
 }
 
 // CreateUser добавляет нового пользователя
 func (s *JSONUserStorage) CreateUser(user models.User) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.refresh()
 
-	// Проверяем, нет ли уже пользователя с таким логином
+	// Проверяем, нет ли уже пользователя с таким логином или ID
 	for _, u := range s.users {
 		if u.Login == user.Login {
-			return os.ErrExist
+			return fmt.Errorf("user with login %s already exists", user.Login)
+		}
+		if u.ID == user.ID {
+			return fmt.Errorf("user with ID %s already exists", user.ID)
 		}
 	}
 
-	s.users = append(s.users, user)
-	return s.saveUsers()
+	return s.saveUsers(append(slices.Clip(s.users), user))
 }
 
 // GetUserByLogin возвращает пользователя по логину
 func (s *JSONUserStorage) GetUserByLogin(login string) (models.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.refresh()
 
 	for _, user := range s.users {
 		if user.Login == login {
@@ -86,59 +148,65 @@ func (s *JSONUserStorage) GetUserByLogin(login string) (models.User, error) {
 func (s *JSONUserStorage) GetUserByID(id string) (models.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.refresh()
 
-	for _, user := range s.users {
-		if user.ID == id {
-			return user, nil
-		}
+	if i := s.indexByID(id); i >= 0 {
+		return s.users[i], nil
 	}
 
 	return models.User{}, os.ErrNotExist
 }
 
-// UpdateUser обновляет данные пользователя
+// UpdateUser обновляет данные пользователя по ID
 func (s *JSONUserStorage) UpdateUser(updatedUser models.User) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.refresh()
+
+	i := s.indexByID(updatedUser.ID)
+	if i < 0 {
+		return os.ErrNotExist
+	}
 
-	for i, user := range s.users {
-		if user.ID == updatedUser.ID {
-			s.users[i] = updatedUser
-			return s.saveUsers()
+	for j, u := range s.users {
+		if j != i && u.Login == updatedUser.Login {
+			return fmt.Errorf("user with login %s already exists", updatedUser.Login)
 		}
 	}
 
-	return os.ErrNotExist
+	// Кэш заменяется копией, чтобы ранее выданные срезы не менялись
+	users := slices.Clone(s.users)
+	users[i] = updatedUser
+	return s.saveUsers(users)
 }
 
-// DeleteUser удаляет пользователя
-func (s *JSONUserStorage) DeleteUser(login string) error {
+// DeleteUser удаляет пользователя по ID
+func (s *JSONUserStorage) DeleteUser(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.refresh()
 
-	for i, user := range s.users {
-		if user.Login == login {
-			// Удаляем пользователя из slice
-			s.users = append(s.users[:i], s.users[i+1:]...)
-			return s.saveUsers()
-		}
+	i := s.indexByID(id)
+	if i < 0 {
+		return os.ErrNotExist
 	}
 
-	return os.ErrNotExist
+	return s.saveUsers(slices.Delete(slices.Clone(s.users), i, i+1))
 }
 
-// GetAllUsers возвращает всех пользователей
+// GetAllUsers возвращает копию списка всех пользователей
 func (s *JSONUserStorage) GetAllUsers() ([]models.User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.users, nil
+	s.refresh()
+
+	return slices.Clone(s.users), nil
 }
 
-// SaveAllUsers сохраняет всех пользователей
+// SaveAllUsers заменяет всех пользователей
 func (s *JSONUserStorage) SaveAllUsers(users []models.User) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.users = users
-	return s.saveUsers()
+	return s.saveUsers(slices.Clone(users))
 }
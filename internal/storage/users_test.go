@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"myapp/internal/models"
+)
+
+// TestUserStorageFailedWrite: если файл записать не удалось, кэш остаётся
+// равным файлу, и следующее чтение не видит несохранённого изменения
+func TestUserStorageFailedWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jsons")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewJSONUserStorage(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := models.User{ID: "1", Login: "alice", Role: models.RoleUser, Status: models.StatusActive}
+	bob := models.User{ID: "2", Login: "bob", Role: models.RoleUser, Status: models.StatusActive}
+	for _, u := range []models.User{alice, bob} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := s.GetAllUsers()
+
+	// Каталога больше нет: любая запись падает, а кэш остаётся последней версией файла
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := alice
+	renamed.Login = "alice2"
+	writes := map[string]func() error{
+		"CreateUser":   func() error { return s.CreateUser(models.User{ID: "3", Login: "carol"}) },
+		"UpdateUser":   func() error { return s.UpdateUser(renamed) },
+		"DeleteUser":   func() error { return s.DeleteUser(bob.ID) },
+		"SaveAllUsers": func() error { return s.SaveAllUsers(nil) },
+	}
+	for name, write := range writes {
+		if err := write(); err == nil {
+			t.Fatalf("%s succeeded without a directory", name)
+		}
+		after, err := s.GetAllUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(after, before) {
+			t.Errorf("after a failed %s the cache is %+v, want %+v", name, after, before)
+		}
+	}
+
+	if _, err := s.GetUserByLogin("carol"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetUserByLogin(carol) = %v, want os.ErrNotExist", err)
+	}
+	if u, err := s.GetUserByID(alice.ID); err != nil || u.Login != "alice" {
+		t.Errorf("GetUserByID(alice) = %+v, %v", u, err)
+	}
+	if _, err := s.GetUserByID(bob.ID); err != nil {
+		t.Errorf("GetUserByID(bob) = %v, want the user to be kept", err)
+	}
+
+	// Когда запись снова возможна, изменения применяются как обычно
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateUser(renamed); err != nil {
+		t.Fatalf("UpdateUser after the directory is back = %v", err)
+	}
+	if u, _ := s.GetUserByID(alice.ID); u.Login != "alice2" {
+		t.Errorf("login after UpdateUser = %q, want alice2", u.Login)
+	}
+}
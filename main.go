@@ -1,34 +1,111 @@
 package main
 
 import (
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"log"
+	"myapp/config"
 	"myapp/handlers"
 	"myapp/internal/auth"
+	"myapp/internal/backup"
+	"myapp/internal/storage"
+	"myapp/internal/storage/sqlstore"
 	"net/http"
+	"os"
+	"path/filepath"
+	_ "time/tzdata" // часовые пояса филиалов проверяются и без zoneinfo в системе
 )
 
 func main() {
+	// Настройки: config.yaml, переменные APP_* и флаги
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Mode == config.ModeDev {
+		log.Println("running in dev mode")
+	}
+
+	// Второй процесс сервера не должен писать в те же файлы
+	lock, err := storage.LockDir(cfg.Storage.JSONDir)
+	if err != nil {
+		log.Fatalf("failed to lock storage: %v", err)
+	}
+	defer lock.Unlock()
+
 	// Инициализация хранилища
-	userStorage := auth.NewJSONUserStorage("storage/jsons/users.json")
+	store, err := openStorage(cfg.Storage)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+	defer store.Close()
+
+	// Справочник филиалов заполняется филиалами существующих пользователей
+	if n, err := storage.SeedFilials(store); err != nil {
+		log.Fatalf("failed to seed filials: %v", err)
+	} else if n > 0 {
+		log.Printf("created %d filials from existing users", n)
+	}
+
+	// Хранилище сессий (refresh-токены)
+	sessionStore, err := auth.NewJSONSessionStore(filepath.Join(cfg.Storage.JSONDir, "sessions.json"))
+	if err != nil {
+		log.Fatalf("failed to load sessions: %v", err)
+	}
 
 	// Инициализация сервиса аутентификации
-	authService := auth.NewAuthService(userStorage, []byte("we-will-rock-you"))
+	signingKey, keys := cfg.Auth.TokenKeys()
+	specs := make([]auth.KeySpec, 0, len(keys))
+	for _, k := range keys {
+		specs = append(specs, auth.KeySpec(k))
+	}
+	keyRing, err := auth.NewKeyRing(signingKey, specs)
+	if err != nil {
+		log.Fatalf("failed to load token signing keys: %v", err)
+	}
+	authService := auth.NewAuthService(store.Users(), sessionStore, store.TwoFactor(), keyRing)
+	authService.AccessTokenTTL = cfg.Auth.AccessTokenTTL
+	authService.RefreshTokenTTL = cfg.Auth.RefreshTokenTTL
+	authService.PasswordResetTTL = cfg.Auth.PasswordResetTTL
+	authService.TOTPIssuer = cfg.Auth.TOTPIssuer
+	authService.Issuer = cfg.Auth.Issuer
+	authService.Audience = cfg.Auth.Audience
 
 	// Создание обработчиков
-	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(authService)
+	loginLimiter := auth.NewLoginLimiter(auth.LoginLimits{
+		MaxFailures:   cfg.Auth.MaxLoginFailures,
+		MaxIPFailures: cfg.Auth.MaxIPLoginFailures,
+		BaseDelay:     cfg.Auth.LoginDelay,
+		Lockout:       cfg.Auth.LoginLockout,
+	})
+	authHandler := handlers.NewAuthHandler(authService, store, loginLimiter)
+	linkKey, linkKeys := cfg.Auth.LinkKeys()
+	linkSpecs := make([]auth.LinkKey, 0, len(linkKeys))
+	for _, k := range linkKeys {
+		linkSpecs = append(linkSpecs, auth.LinkKey(k))
+	}
+	fileLinks, err := auth.NewFileLinks(linkKey, linkSpecs, cfg.Storage.FileLinkTTL)
+	if err != nil {
+		log.Fatalf("failed to load file link keys: %v", err)
+	}
+	maintenance := &handlers.Maintenance{}
+	userHandler := handlers.NewUserHandler(authService, store, fileLinks, maintenance, cfg)
+
+	// Резервные копии по расписанию
+	if cfg.Backup.Interval > 0 {
+		go backup.Schedule(cfg.Backup.Dir, cfg.Backup.Interval, cfg.Backup.Keep, userHandler.WriteBackup)
+	}
 
 	// Создаем маршрутизатор chi
 	r := chi.NewRouter()
 
 	// Basic CORS
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
 		AllowCredentials: false,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		MaxAge:           300,
@@ -38,26 +115,117 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	// Публичные маршруты (без авторизации)
-	r.Post("/login", authHandler.Login)
-	r.Post("/register", authHandler.Register)
+	// Публичные маршруты (без авторизации).
+	// Изменяющие запросы во всех группах, кроме резервных копий, ждут окончания копирования и восстановления
+	r.Group(func(r chi.Router) {
+		r.Use(maintenance.Middleware)
+		r.Post("/login", authHandler.Login)
+		r.Post("/login/2fa", authHandler.LoginTwoFactor)
+		r.Post("/register", authHandler.Register)
+		r.Post("/auth/refresh", authHandler.Refresh)
+		r.Get("/.well-known/jwks.json", authHandler.JWKS)
+		r.Get("/files/{filename}/signed", userHandler.GetSignedFile) // доступ по подписи ссылки
+	})
 
 	// Защищённые маршруты (требуют авторизации)
+	// Доступно и пользователю, который обязан сменить пароль или включить второй фактор
 	r.Group(func(r chi.Router) {
+		r.Use(maintenance.Middleware)
+		r.Use(authService.AuthMiddleware)
+		r.Post("/auth/logout", authHandler.Logout)
+		r.Post("/me/password", authHandler.ChangePassword)
+		r.Get("/me/2fa", authHandler.GetTwoFactor)
+		r.Post("/me/2fa/setup", authHandler.SetupTwoFactor)
+		r.Post("/me/2fa/enable", authHandler.EnableTwoFactor)
+		r.Post("/me/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		r.Delete("/me/2fa", authHandler.DisableTwoFactor)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(maintenance.Middleware)
 		r.Use(authService.AuthMiddleware) // middleware для авторизации
+		r.Use(authService.PasswordChangedMiddleware)
+		r.Use(authService.TwoFactorMiddleware)
 		//r.Use(auth.WithRoleMiddleware)    // middleware для проверки роли
+		r.Post("/users/{id}/password-reset", authHandler.ResetPassword)
+		r.Delete("/users/{id}/2fa", authHandler.ResetUserTwoFactor)
+		r.Delete("/users/{id}/sessions", authHandler.RevokeUserSessions)
+		r.Get("/auth/lockouts", authHandler.ListLockouts)
+		r.Delete("/auth/lockouts/{login}", authHandler.UnlockLogin)
 		r.Get("/users", userHandler.GetAllUsers)
 		r.Get("/users/{id}", userHandler.GetUserData)
 		r.Put("/users/{id}", userHandler.UpdateUserData)
+		r.Patch("/users/{id}", userHandler.UpdateUser)
+		r.Delete("/users/{id}", userHandler.DeleteUser)
+		r.Put("/users/{id}/status", userHandler.UpdateUserStatus)
+		r.Put("/users/{id}/role", userHandler.UpdateUserRole)
+		r.Post("/users/{id}/restore", userHandler.RestoreUser)
+		r.Delete("/users/{id}/purge", userHandler.PurgeUser)
 		r.Get("/profile", userHandler.GetProfile)
 		r.Get("/modules", userHandler.GetModules)
 		r.Get("/modules/{id}", userHandler.GetModulesById)
+		r.Post("/modules", userHandler.CreateModule)
+		r.Put("/modules/order", userHandler.ReorderModules)
+		r.Put("/modules/{id}", userHandler.UpdateModule)
+		r.Put("/modules/{id}/archive", userHandler.SetModuleArchived)
+		r.Post("/modules/{id}/files", userHandler.UploadModuleFile)
+		r.Put("/modules/{id}/files/{filename}", userHandler.ReplaceModuleFile)
+		r.Delete("/modules/{id}/files/{filename}", userHandler.DeleteModuleFile)
+		r.Get("/admin/files/orphans", userHandler.GetFileReport)
+		r.Post("/modules/{id}/grants", userHandler.GrantModuleToFilial)
+		r.Post("/tutors/{id}/grants", userHandler.GrantModule)
+		r.Put("/tutors/{id}/grants/{module}", userHandler.ExtendGrant)
+		r.Delete("/tutors/{id}/grants/{module}", userHandler.RevokeGrant)
+		r.Get("/grants/expiring", userHandler.GetExpiringGrants)
+		r.Get("/grants/audit", userHandler.GetGrantAudit)
+		r.Post("/enrollments", userHandler.CreateEnrollment)
+		r.Get("/enrollments", userHandler.ListEnrollments)
+		r.Get("/enrollments/{id}", userHandler.GetEnrollment)
+		r.Put("/enrollments/{id}/tutor", userHandler.ChangeEnrollmentTutor)
+		r.Delete("/enrollments/{id}", userHandler.DropEnrollment)
+		r.Put("/enrollments/{id}/lessons/{filename}", userHandler.SetLessonProgress)
+		r.Post("/groups", userHandler.CreateGroup)
+		r.Get("/groups", userHandler.ListGroups)
+		r.Get("/groups/{id}", userHandler.GetGroup)
+		r.Put("/groups/{id}", userHandler.UpdateGroup)
+		r.Delete("/groups/{id}", userHandler.ArchiveGroup)
+		r.Get("/groups/{id}/classes", userHandler.GetGroupClasses)
+		r.Put("/groups/{id}/attendance", userHandler.MarkAttendance)
+		r.Get("/users/{id}/attendance", userHandler.GetStudentAttendance)
+		r.Put("/users/{id}/filial", userHandler.TransferUser)
+		r.Get("/filials", userHandler.ListFilials)
+		r.Post("/filials", userHandler.CreateFilial)
+		r.Get("/filials/stats", userHandler.GetFilialStats)
+		r.Get("/filials/{id}", userHandler.GetFilial)
+		r.Put("/filials/{id}", userHandler.UpdateFilial)
+		r.Delete("/filials/{id}", userHandler.DeleteFilial)
 		r.Get("/files/{filename}", userHandler.GetFile)
+		r.Post("/files/{filename}/link", userHandler.CreateFileLink)
+		r.Get("/admin/downloads", userHandler.GetDownloads)
+		r.Get("/admin/audit", userHandler.GetAuditLog)
+	})
 
-		//для ручного бэкапа
-		r.Get("/download/{filename}", userHandler.DownloadFile)
+	// Резервные копии: копирование и восстановление сами останавливают изменяющие запросы
+	r.Group(func(r chi.Router) {
+		r.Use(authService.AuthMiddleware)
+		r.Use(authService.PasswordChangedMiddleware)
+		r.Use(authService.TwoFactorMiddleware)
+		r.Get("/admin/backup", userHandler.GetBackup)
+		r.Post("/admin/restore", userHandler.RestoreBackup)
 	})
 
-	log.Println("Server starting on :8080eee")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	log.Printf("Server starting on %s", cfg.Listen)
+	log.Fatal(http.ListenAndServe(cfg.Listen, r))
+}
+
+// openStorage открывает выбранное хранилище данных
+func openStorage(cfg config.StorageConfig) (storage.Backend, error) {
+	switch cfg.Backend {
+	case "json":
+		return storage.NewJSONBackend(cfg.JSONDir)
+	case "sqlite":
+		return sqlstore.Open(cfg.DBPath)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
 }
@@ -1,34 +0,0 @@
-package jwt
-
-import (
-	"github.com/golang-jwt/jwt/v5"
-	"time"
-)
-
-var secretKey = []byte("we-will-rock-you")
-
-func GenerateToken(userID, email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   userID,
-		"email": email,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	return token.SignedString(secretKey)
-}
-
-func ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, jwt.ErrSignatureInvalid
-}